@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"github.com/braheezy/chip-8/internal/interpreter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var browseCmd = &cobra.Command{
+	Use:   "browse [dir]",
+	Short: "Pick a ROM to run from a directory",
+	Long:  "List the ROMs in a directory with a live preview of each, then run the chosen one",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newDefaultLogger()
+		dir := "."
+		if len(args) == 1 {
+			dir = args[0]
+		}
+
+		db, err := romDatabase()
+		if err != nil {
+			logger.Fatal(err)
+		}
+		roms, err := interpreter.FindRoms(dir, db)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if len(roms) == 0 {
+			logger.Fatalf("No ROMs found in %s", dir)
+		}
+		board, err := interpreter.LoadLeaderboard(viper.GetString("high_scores"))
+		if err != nil {
+			logger.Warn("Could not load high scores", "err", err)
+		}
+		for i := range roms {
+			roms[i].HighScores = board[roms[i].Hash]
+		}
+
+		choice, ok, err := interpreter.RunBrowser(roms, loadOptions)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if !ok {
+			return
+		}
+		if choice.TUI {
+			runTUI(choice.Rom.Path, logger)
+		} else {
+			run(choice.Rom.Path, logger)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(browseCmd)
+}
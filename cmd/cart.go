@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/braheezy/chip-8/internal/interpreter"
+
+	"github.com/spf13/cobra"
+)
+
+var cartCmd = &cobra.Command{
+	Use:   "cart",
+	Short: "Work with Octo cartridges",
+	Long:  "Octo cartridges are GIFs with a program and its settings hidden inside. chip8 runs them like any other ROM.",
+}
+
+var cartExportCmd = &cobra.Command{
+	Use:   "export <rom>",
+	Short: "Pack a ROM and its settings into an Octo cartridge",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newDefaultLogger()
+		rom := readRom(args[0], logger)
+		opts, err := loadOptions(rom)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		output, _ := cmd.Flags().GetString("output")
+		if output == "" {
+			output = strings.TrimSuffix(rom.Name, filepath.Ext(rom.Name)) + ".gif"
+		}
+		if output == args[0] {
+			logger.Fatal("Refusing to overwrite the ROM, choose another output with --output")
+		}
+
+		f, err := os.Create(output)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer f.Close()
+		if err := interpreter.EncodeCartridge(f, rom.Program, opts); err != nil {
+			logger.Fatal(err)
+		}
+		logger.Info("Exported cartridge", "file", output)
+	},
+}
+
+func init() {
+	cartExportCmd.Flags().StringP("output", "o", "", "Cartridge file to write (default: the ROM's name with .gif)")
+
+	cartCmd.AddCommand(cartExportCmd)
+	rootCmd.AddCommand(cartCmd)
+}
@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	_ "net/http/pprof"
 	"os"
-	"path/filepath"
+	"os/user"
+	"slices"
+	"strings"
 
 	"github.com/braheezy/chip-8/internal/interpreter"
 
@@ -30,6 +34,12 @@ var rootCmd = &cobra.Command{
 		}
 		return nil
 	},
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if profileFmt != "" && !slices.Contains(interpreter.ProfileFormats, profileFmt) {
+			return fmt.Errorf("unknown profile format %q, expected %s", profileFmt, strings.Join(interpreter.ProfileFormats, ", "))
+		}
+		return validateConfig()
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		logger := newDefaultLogger()
 		if viper.GetBool("write-config") {
@@ -64,10 +74,28 @@ func Execute() {
 	}
 }
 
-var debug bool
+var (
+	debug       bool
+	tracePath   string
+	traceFormat string
+	watches     []string
+	gdbAddress  string
+	profilePath string
+	profileFmt  string
+	cheatsPath  string
+	scriptPath  string
+)
 
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "Show debug messages")
+	rootCmd.PersistentFlags().StringVar(&tracePath, "trace", "", "Write a record of every instruction executed to this file")
+	rootCmd.PersistentFlags().StringVar(&traceFormat, "trace-format", "", "Trace format: jsonl or binary (default: binary for .bin files, otherwise jsonl)")
+	rootCmd.PersistentFlags().StringArrayVar(&watches, "watch", nil, "Pause when a watchpoint is hit, like \"write 0x300-0x302\", \"V3\" or \"V3 == 0x10\" (repeatable)")
+	rootCmd.PersistentFlags().StringVar(&profilePath, "profile", "", "Count the instructions executed and write a coverage and hot spot report to this file")
+	rootCmd.PersistentFlags().StringVar(&profileFmt, "profile-format", "", "Profile format: text, json or asm (default: json for .json files, asm for .asm, otherwise text)")
+	rootCmd.PersistentFlags().StringVar(&cheatsPath, "cheats", "", "Freeze memory at the values in this cheat file, toggled with F12")
+	rootCmd.PersistentFlags().StringVar(&scriptPath, "script", "", "Run this Lua script alongside the ROM, to automate it")
+	rootCmd.PersistentFlags().StringVar(&gdbAddress, "gdb", "", "Wait for a GDB connection on this address, like :1234, before running")
 
 	rootCmd.Flags().BoolP("cosmac", "c", false, "Run in COSMAC VIP mode")
 	viper.BindPFlag("cosmac-vip.enabled", rootCmd.Flags().Lookup("cosmac"))
@@ -82,31 +110,236 @@ func init() {
 }
 
 func run(romFilePath string, logger *log.Logger) {
-	chipFileName := filepath.Base(romFilePath)
-	chipData, err := os.ReadFile(romFilePath)
-	if err != nil {
-		logger.Fatal(err)
-	}
 	if debug {
 		logger.SetLevel(log.DebugLevel)
 	}
 
-	opts := interpreter.DefaultCHIP8Options()
-	viper.Unmarshal(&opts)
-	chip8 := interpreter.NewCHIP8(&chipData, opts)
-	chip8.Logger = logger
+	rom := readRom(romFilePath, logger)
+	chip8 := newCHIP8(rom, logger)
+	// Last to finish, since it may exit
+	defer startScript(chip8, logger)()
+	defer startHighScores(chip8, logger)()
+	defer startTrace(chip8, logger)()
+	defer startProfile(chip8, logger)()
+	defer startGDB(chip8, logger)()
+	runWindow(chip8, rom.Name, logger)
+}
 
-	if viper.GetBool("cosmac-vip.enabled") {
-		logger.Info("COSMAC VIP mode enabled")
-		chip8.Options.CosmacQuirks.EnableAll()
+// runWindow runs the interpreter in a window until it's closed.
+func runWindow(chip8 *interpreter.CHIP8, title string, logger *log.Logger) {
+	if chip8.Options.Window.Remember {
+		if err := loadWindowGeometry(&chip8.Options.Window); err != nil {
+			logger.Warn("Could not restore window geometry", "err", err)
+		}
 	}
-
-	ebiten.SetWindowSize(interpreter.DisplayWidth*chip8.Options.DisplayScaleFactor, interpreter.DisplayHeight*chip8.Options.DisplayScaleFactor)
-	ebiten.SetWindowTitle(chipFileName)
+	window := chip8.Options.Window
+	if window.Width > 0 && window.Height > 0 {
+		// Restore the last window geometry
+		ebiten.SetWindowSize(window.Width, window.Height)
+		ebiten.SetWindowPosition(window.X, window.Y)
+	} else {
+		ebiten.SetWindowSize(interpreter.DisplayWidth*chip8.Options.DisplayScaleFactor, interpreter.DisplayHeight*chip8.Options.DisplayScaleFactor)
+	}
+	if window.Resizable {
+		ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
+	}
+	ebiten.SetFullscreen(window.Fullscreen)
+	ebiten.SetWindowTitle(title)
 	ebiten.SetTPS(ebiten.SyncWithFPS)
+	if chip8.Netplay != nil {
+		// Lockstep runs a frame per update
+		ebiten.SetTPS(60)
+	}
 
 	if err := ebiten.RunGame(chip8); err != nil && err != ebiten.Termination {
 		logger.Fatal(err)
 	}
 
+	if chip8.Options.Window.Remember {
+		if err := saveWindowGeometry(chip8.Options.Window); err != nil {
+			logger.Warn("Could not save window geometry", "err", err)
+		}
+	}
+}
+
+// startTrace starts tracing instructions if --trace is set, returning a function to
+// finish the trace.
+func startTrace(chip8 *interpreter.CHIP8, logger *log.Logger) func() {
+	if tracePath == "" {
+		return func() {}
+	}
+	format := traceFormat
+	if format == "" {
+		format = interpreter.TraceFormatFor(tracePath)
+	}
+	f, err := os.Create(tracePath)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	tracer, err := interpreter.NewTracer(f, format)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	chip8.Tracer = tracer
+	return func() {
+		if err := tracer.Close(); err != nil {
+			logger.Error("Could not write trace", "err", err)
+		}
+		f.Close()
+	}
+}
+
+// startProfile counts executed instructions if --profile is set, returning a
+// function to write the report.
+func startProfile(chip8 *interpreter.CHIP8, logger *log.Logger) func() {
+	if profilePath == "" {
+		return func() {}
+	}
+	chip8.Profiler = interpreter.NewProfiler()
+	return func() {
+		// Only replace the file once there's a report to put in it
+		var report bytes.Buffer
+		if err := writeProfile(chip8, &report, profilePath); err != nil {
+			logger.Error("Could not write profile", "err", err)
+			return
+		}
+		if err := os.WriteFile(profilePath, report.Bytes(), 0o644); err != nil {
+			logger.Error("Could not write profile", "err", err)
+		}
+	}
+}
+
+// writeProfile writes the profile report in the format from --profile-format, or
+// the one for the file name.
+func writeProfile(chip8 *interpreter.CHIP8, w io.Writer, path string) error {
+	format := profileFmt
+	if format == "" {
+		format = interpreter.ProfileFormatFor(path)
+	}
+	return chip8.Profiler.Report(chip8).Write(w, format)
+}
+
+// startGDB serves the GDB remote protocol if --gdb is set, returning a function to
+// stop serving.
+func startGDB(chip8 *interpreter.CHIP8, logger *log.Logger) func() {
+	if gdbAddress == "" {
+		return func() {}
+	}
+	listener, err := interpreter.ServeGDB(chip8, gdbAddress)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	return func() { listener.Close() }
+}
+
+// startScript runs the Lua script if --script is set, returning a function to stop
+// it that exits with the script's exit code, if it gave one.
+func startScript(chip8 *interpreter.CHIP8, logger *log.Logger) func() {
+	if scriptPath == "" {
+		return func() {}
+	}
+	script, err := interpreter.LoadScript(chip8, scriptPath)
+	if err != nil {
+		logger.Fatal("Could not run script", "err", err)
+	}
+	return func() {
+		script.Close()
+		if code, ok := script.ExitCode(); ok && code != 0 {
+			os.Exit(code)
+		}
+	}
+}
+
+// startHighScores records the ROM's scores if it has a score set, returning a
+// function to record the game in progress.
+func startHighScores(chip8 *interpreter.CHIP8, logger *log.Logger) func() {
+	if chip8.Options.Score == "" {
+		return func() {}
+	}
+	scores, err := interpreter.TrackHighScores(chip8, viper.GetString("high_scores"), playerName())
+	if err != nil {
+		logger.Fatal("Could not track high scores", "err", err)
+	}
+	return scores.Close
+}
+
+// playerName is who high scores are recorded for: player_name, or the user.
+func playerName() string {
+	if name := viper.GetString("player_name"); name != "" {
+		return name
+	}
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		// Windows names include the domain
+		_, name, _ := strings.Cut(u.Username, `\`)
+		if name == "" {
+			name = u.Username
+		}
+		return name
+	}
+	return "Player"
+}
+
+// readRom loads the ROM to run, asking which one to use if it's an archive of several.
+func readRom(romFilePath string, logger *log.Logger) interpreter.Rom {
+	rom, err := interpreter.ReadRom(romFilePath, func(names []string) (int, error) {
+		return chooseRom(names, romFilePath != "-")
+	})
+	if err != nil {
+		logger.Fatal(err)
+	}
+	return rom
+}
+
+// chooseRom asks on the terminal which of the named ROMs to run.
+func chooseRom(names []string, canPrompt bool) (int, error) {
+	if stat, err := os.Stdin.Stat(); err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		canPrompt = false
+	}
+	if !canPrompt {
+		return 0, fmt.Errorf("archive holds several ROMs, extract the one to run: %s", strings.Join(names, ", "))
+	}
+
+	fmt.Fprintln(os.Stderr, "This archive holds several ROMs:")
+	for i, name := range names {
+		fmt.Fprintf(os.Stderr, "%3d) %s\n", i+1, name)
+	}
+	for {
+		fmt.Fprintf(os.Stderr, "Run which? [1-%d] ", len(names))
+		var choice int
+		if _, err := fmt.Scanln(&choice); err == io.EOF {
+			return 0, err
+		} else if err == nil && choice >= 1 && choice <= len(names) {
+			return choice - 1, nil
+		}
+	}
+}
+
+// newCHIP8 creates an interpreter for the ROM using the current configuration,
+// including any overrides for that ROM.
+func newCHIP8(rom interpreter.Rom, logger *log.Logger) *interpreter.CHIP8 {
+	opts, err := loadOptions(rom)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	chip8 := interpreter.NewCHIP8(&rom.Program, opts)
+	chip8.Logger = logger
+	for _, spec := range watches {
+		watchpoint, err := interpreter.ParseWatchpoint(spec)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		chip8.Watchpoints = append(chip8.Watchpoints, watchpoint)
+	}
+	if cheatsPath != "" {
+		chip8.Cheats, err = interpreter.LoadCheats(cheatsPath)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		logger.Info("Loaded cheats", "count", len(chip8.Cheats))
+	}
+	if quirks := opts.CosmacQuirks; quirks.ResetVF && quirks.IncrementI {
+		logger.Info("COSMAC VIP mode enabled")
+	}
+	return chip8
 }
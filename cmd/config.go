@@ -1,8 +1,15 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/braheezy/chip-8/internal/interpreter"
 	"github.com/spf13/viper"
 )
 
@@ -23,10 +30,35 @@ func initConfig() {
 	viper.SetDefault("display_scale_factor", 10)
 	viper.SetDefault("throttle_speed", 0)
 	viper.SetDefault("instruction_limit", -1)
-	viper.SetDefault("off_color", "Iris")
-	viper.SetDefault("on_color", "Pine")
+	viper.SetDefault("palette", "rose-pine")
+	viper.SetDefault("off_color", "")
+	viper.SetDefault("on_color", "")
 	viper.SetDefault("cosmac-vip.reset_vf", false)
 	viper.SetDefault("cosmac-vip.increment_i", false)
+	viper.SetDefault("hud", false)
+	viper.SetDefault("tui.graphics", "cells")
+	viper.SetDefault("rom_database", "")
+	scores, err := stateFile("scores.json")
+	if err != nil {
+		scores = "scores.json"
+	}
+	viper.SetDefault("high_scores", scores)
+	viper.SetDefault("player_name", "")
+	effects := interpreter.DefaultEffectOptions()
+	viper.SetDefault("effects.enabled", effects.Enabled)
+	viper.SetDefault("effects.scanlines", effects.Scanlines)
+	viper.SetDefault("effects.curvature", effects.Curvature)
+	viper.SetDefault("effects.bloom", effects.Bloom)
+	viper.SetDefault("effects.persistence", effects.Persistence)
+	viper.SetDefault("frame_blend.mode", interpreter.BlendOff)
+	viper.SetDefault("frame_blend.frames", 3)
+	window := interpreter.DefaultWindowOptions()
+	viper.SetDefault("window.resizable", window.Resizable)
+	viper.SetDefault("window.integer_scaling", window.IntegerScaling)
+	viper.SetDefault("window.fullscreen", window.Fullscreen)
+	viper.SetDefault("window.border_color", window.BorderColor)
+	viper.SetDefault("window.padding", window.Padding)
+	viper.SetDefault("window.remember", window.Remember)
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
@@ -35,3 +67,168 @@ func initConfig() {
 		}
 	}
 }
+
+// validateConfig catches bad configuration values up front, before any window or TUI
+// is started and hides the error.
+func validateConfig() error {
+	opts := interpreter.DefaultCHIP8Options()
+	if err := viper.Unmarshal(&opts); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	return validateOptions(opts)
+}
+
+func validateOptions(opts interpreter.CHIP8Options) error {
+	if _, err := opts.ResolvePalette(); err != nil {
+		return fmt.Errorf("invalid color config: %w", err)
+	}
+	if err := opts.Effects.Validate(); err != nil {
+		return fmt.Errorf("invalid effects config: %w", err)
+	}
+	if err := opts.FrameBlend.Validate(); err != nil {
+		return fmt.Errorf("invalid frame_blend config: %w", err)
+	}
+	if err := opts.Window.Validate(); err != nil {
+		return fmt.Errorf("invalid window config: %w", err)
+	}
+	if err := opts.Keypad.Validate(); err != nil {
+		return fmt.Errorf("invalid keypad config: %w", err)
+	}
+	if opts.Score != "" {
+		if _, err := interpreter.ParseScore(opts.Score); err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+	}
+	return nil
+}
+
+// romConfig returns the config table overriding settings for a single ROM, or nil if
+// there is none. Tables are keyed by the lowercase file name without its extension,
+// so the settings for pong.ch8 live under [roms.pong].
+func romConfig(romFilePath string) *viper.Viper {
+	name := filepath.Base(romFilePath)
+	name = strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+	if name == "" || strings.Contains(name, ".") {
+		// Dots would be read as nested tables
+		return nil
+	}
+	return viper.Sub("roms." + name)
+}
+
+// The ROM database named in config, loaded on first use
+var (
+	romDB       interpreter.RomDatabase
+	romDBLoaded bool
+)
+
+// romDatabase returns the ROM database named by rom_database, or nil if there isn't one.
+func romDatabase() (interpreter.RomDatabase, error) {
+	path := viper.GetString("rom_database")
+	if romDBLoaded || path == "" {
+		return romDB, nil
+	}
+	db, err := interpreter.LoadRomDatabase(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not load ROM database: %w", err)
+	}
+	romDB, romDBLoaded = db, true
+	return romDB, nil
+}
+
+// loadOptions reads the interpreter options from config. Settings the ROM database
+// and the ROM's cartridge suggest come next, and any overrides for the ROM go on top.
+func loadOptions(rom interpreter.Rom) (interpreter.CHIP8Options, error) {
+	opts := interpreter.DefaultCHIP8Options()
+	if err := viper.Unmarshal(&opts); err != nil {
+		return opts, fmt.Errorf("invalid config: %w", err)
+	}
+	db, err := romDatabase()
+	if err != nil {
+		return opts, err
+	}
+	if info, ok := db.Lookup(rom.Program); ok {
+		info.Apply(&opts)
+	}
+	if rom.Cartridge != nil {
+		rom.Cartridge.Apply(&opts)
+	}
+	if romConfig := romConfig(rom.Name); romConfig != nil {
+		if err := romConfig.Unmarshal(&opts); err != nil {
+			return opts, fmt.Errorf("invalid config for %s: %w", rom.Name, err)
+		}
+		if err := validateOptions(opts); err != nil {
+			return opts, fmt.Errorf("%s: %w", rom.Name, err)
+		}
+	}
+	if romConfig := romConfig(rom.Name); viper.GetBool("cosmac-vip.enabled") || (romConfig != nil && romConfig.GetBool("cosmac-vip.enabled")) {
+		opts.CosmacQuirks.EnableAll()
+	}
+	return opts, nil
+}
+
+// stateFile is where chip8 keeps a file of its own, in the user's config directory
+// so it's the same wherever chip8 is run from.
+func stateFile(name string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "chip8", name), nil
+}
+
+// windowGeometry is the window's size, position and fullscreen state, saved
+// between runs.
+type windowGeometry struct {
+	Width      int  `json:"width"`
+	Height     int  `json:"height"`
+	X          int  `json:"x"`
+	Y          int  `json:"y"`
+	Fullscreen bool `json:"fullscreen"`
+}
+
+// loadWindowGeometry restores the window geometry saved by saveWindowGeometry, if
+// there is any.
+func loadWindowGeometry(window *interpreter.WindowOptions) error {
+	path, err := stateFile("window.json")
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var geometry windowGeometry
+	if err := json.Unmarshal(data, &geometry); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	window.Width, window.Height = geometry.Width, geometry.Height
+	window.X, window.Y = geometry.X, geometry.Y
+	window.Fullscreen = geometry.Fullscreen
+	return nil
+}
+
+// saveWindowGeometry remembers the window's size, position and fullscreen state in a
+// file of its own, leaving config.toml alone.
+func saveWindowGeometry(window interpreter.WindowOptions) error {
+	path, err := stateFile("window.json")
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(windowGeometry{
+		Width:      window.Width,
+		Height:     window.Height,
+		X:          window.X,
+		Y:          window.Y,
+		Fullscreen: window.Fullscreen,
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
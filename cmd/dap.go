@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/braheezy/chip-8/internal/interpreter"
+
+	"github.com/spf13/cobra"
+)
+
+var dapCmd = &cobra.Command{
+	Use:   "dap",
+	Short: "Debug ROMs from an editor over the Debug Adapter Protocol",
+	Long: `Serve the Debug Adapter Protocol on stdin and stdout, or on a TCP address with --listen, so editors can launch and debug ROMs.
+
+The launch configuration sets "program" to the ROM, and optionally "symbols" to a map from addresses to assembler source lines and labels (by default, the ROM's name with .map, if there is one) and "stopOnEntry".`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newStderrLogger()
+
+		var conn io.ReadWriter = struct {
+			io.Reader
+			io.Writer
+		}{os.Stdin, os.Stdout}
+		if address, _ := cmd.Flags().GetString("listen"); address != "" {
+			listener, err := net.Listen("tcp", address)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			logger.Info("Waiting for an editor", "address", listener.Addr())
+			c, err := listener.Accept()
+			listener.Close()
+			if err != nil {
+				logger.Fatal(err)
+			}
+			defer c.Close()
+			conn = c
+		}
+
+		server := interpreter.NewDAPServer(conn, loadOptions, logger)
+		done := make(chan bool)
+		go func() {
+			if err := server.Serve(); err != nil {
+				logger.Error("Debug adapter stopped", "err", err)
+			}
+			close(done)
+		}()
+
+		select {
+		case chip8 := <-server.Launched:
+			// The window has to run on the main goroutine
+			runWindow(chip8, "CHIP-8 (debugging)", logger)
+			server.Exited()
+			// Give the editor a moment to disconnect
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+			}
+		case <-done:
+		}
+	},
+}
+
+func init() {
+	dapCmd.Flags().String("listen", "", "Serve on this TCP address, like :4711, instead of stdin and stdout")
+
+	rootCmd.AddCommand(dapCmd)
+}
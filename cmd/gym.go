@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/braheezy/chip-8/pkg/gym"
+
+	"github.com/spf13/cobra"
+)
+
+var gymCmd = &cobra.Command{
+	Use:   "gym <rom>",
+	Short: "Serve a ROM as an environment for training agents",
+	Long: `Run a ROM without a window as a reinforcement learning environment, in the style of Gym, driven by JSON messages on stdin and stdout, or on a socket with --listen.
+
+Each step holds a set of keys for --frame-skip frames, unthrottled. The reward for a step is how much --score went up, and an episode ends when --done is true or the program finishes. Both are written like watchpoint conditions, reading registers and memory: --score "[0x2F0]*10 + [0x2F1]" --done "[0x2F2] == 0".`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newStderrLogger()
+
+		var options gym.Options
+		options.FrameSkip, _ = cmd.Flags().GetInt("frame-skip")
+		options.MaxSteps, _ = cmd.Flags().GetInt("max-steps")
+		options.Score, _ = cmd.Flags().GetString("score")
+		options.Done, _ = cmd.Flags().GetString("done")
+
+		rom := readRom(args[0], logger)
+		count, _ := cmd.Flags().GetInt("envs")
+		envs := make([]*gym.Env, max(count, 1))
+		for i := range envs {
+			env, err := gym.NewEnv(newCHIP8(rom, logger), options)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			envs[i] = env
+		}
+
+		address, _ := cmd.Flags().GetString("listen")
+		if address == "" {
+			if err := gym.Serve(struct {
+				io.Reader
+				io.Writer
+			}{os.Stdin, os.Stdout}, envs); err != nil {
+				logger.Fatal(err)
+			}
+			return
+		}
+
+		network := "tcp"
+		if path, ok := strings.CutPrefix(address, "unix:"); ok {
+			network, address = "unix", path
+		}
+		listener, err := net.Listen(network, address)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer listener.Close()
+		logger.Info("Waiting for agents", "address", listener.Addr(), "envs", len(envs))
+		// One agent at a time, each carrying on with the same environments
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				logger.Fatal(err)
+			}
+			logger.Info("Agent connected", "address", conn.RemoteAddr())
+			if err := gym.Serve(conn, envs); err != nil {
+				logger.Error("Agent disconnected", "err", err)
+			}
+			conn.Close()
+		}
+	},
+}
+
+func init() {
+	gymCmd.Flags().String("listen", "", "Serve on this TCP address, like :5555, or Unix socket, like unix:/tmp/chip8.sock, instead of stdin and stdout")
+	gymCmd.Flags().String("score", "", "Expression scoring the game, so the reward for a step is how much it went up")
+	gymCmd.Flags().String("done", "", "Condition ending an episode, like the last life being lost")
+	gymCmd.Flags().Int("frame-skip", 4, "Frames each step holds its keys for")
+	gymCmd.Flags().Int("max-steps", 0, "Cut episodes short after this many steps (0 for no limit)")
+	gymCmd.Flags().Int("envs", 1, "How many copies of the game to serve, for stepping together")
+
+	rootCmd.AddCommand(gymCmd)
+}
@@ -0,0 +1,19 @@
+package cmd
+
+import (
+	"github.com/braheezy/chip-8/internal/interpreter"
+
+	"github.com/spf13/cobra"
+)
+
+// addFramesFlag adds the --frames flag of the commands that run a ROM headless.
+func addFramesFlag(cmd *cobra.Command) {
+	cmd.Flags().Int("frames", 600, "How many 60Hz frames to run for, without a window or input")
+}
+
+// runHeadless runs a ROM for a number of frames, or until it ends.
+func runHeadless(chip8 *interpreter.CHIP8, frames int) {
+	for frame := 0; frame < frames && !chip8.Finished(); frame++ {
+		chip8.RunFrame()
+	}
+}
@@ -10,6 +10,17 @@ func newDefaultLogger() *log.Logger {
 	return initLogger(log.InfoLevel)
 }
 
+// newStderrLogger logs to stderr, for commands whose stdout may be a protocol or
+// a report.
+func newStderrLogger() *log.Logger {
+	logger := newDefaultLogger()
+	logger.SetOutput(os.Stderr)
+	if debug {
+		logger.SetLevel(log.DebugLevel)
+	}
+	return logger
+}
+
 func initLogger(level log.Level) *log.Logger {
 	logger := log.New(os.Stdout)
 	logger.SetLevel(level)
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"net"
+
+	"github.com/braheezy/chip-8/internal/interpreter"
+
+	"github.com/spf13/cobra"
+)
+
+var hostCmd = &cobra.Command{
+	Use:   "host <rom>",
+	Short: "Host a two-player game for another machine to join",
+	Long: `Wait for another player to join with chip8 join, then play the ROM on both machines in lockstep. The other player gets the ROM and quirks from the host.
+
+Keys are sent --delay frames ahead of when they're used, so they arrive in time. Raise it if the game keeps waiting for the other player.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newDefaultLogger()
+		address, _ := cmd.Flags().GetString("listen")
+		delay, _ := cmd.Flags().GetInt("delay")
+
+		rom := readRom(args[0], logger)
+		chip8 := newCHIP8(rom, logger)
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		logger.Info("Waiting for a player to join", "address", listener.Addr())
+		conn, err := listener.Accept()
+		listener.Close()
+		if err != nil {
+			logger.Fatal(err)
+		}
+		logger.Info("Player joined", "address", conn.RemoteAddr())
+
+		netplay, err := interpreter.HostNetplay(chip8, conn, rom, delay)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer netplay.Close()
+		runWindow(chip8, rom.Name+" (host)", logger)
+		if err := netplay.Err(); err != nil {
+			logger.Error("Netplay stopped", "err", err)
+		}
+	},
+}
+
+var joinCmd = &cobra.Command{
+	Use:   "join <address>",
+	Short: "Join a two-player game hosted on another machine",
+	Long:  "Join a game started with chip8 host, like chip8 join 192.168.1.20:7777. The ROM comes from the host.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newDefaultLogger()
+		conn, err := net.Dial("tcp", args[0])
+		if err != nil {
+			logger.Fatal(err)
+		}
+		netplay, rom, err := interpreter.JoinNetplay(conn)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer netplay.Close()
+		logger.Info("Joined", "rom", rom.Name)
+
+		chip8 := newCHIP8(rom, logger)
+		netplay.Attach(chip8)
+		runWindow(chip8, rom.Name+" (joined)", logger)
+		if err := netplay.Err(); err != nil {
+			logger.Error("Netplay stopped", "err", err)
+		}
+	},
+}
+
+func init() {
+	hostCmd.Flags().String("listen", ":7777", "TCP address to wait for the other player on")
+	hostCmd.Flags().Int("delay", 2, "Frames of delay before keys take effect, to hide network latency")
+
+	rootCmd.AddCommand(hostCmd)
+	rootCmd.AddCommand(joinCmd)
+}
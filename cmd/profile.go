@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/braheezy/chip-8/internal/interpreter"
+
+	"github.com/spf13/cobra"
+)
+
+var profileCmd = &cobra.Command{
+	Use:   "profile <rom>",
+	Short: "Run a ROM without a window and report which code runs",
+	Long: `Count every instruction a ROM executes in --frames frames. The report shows the hot spots, instructions by kind, time spent in each subroutine, and code that never ran.
+
+The report goes to the file given by --profile, or stdout.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newStderrLogger()
+		frames, _ := cmd.Flags().GetInt("frames")
+
+		rom := readRom(args[0], logger)
+		chip8 := newCHIP8(rom, logger)
+		defer startTrace(chip8, logger)()
+		if profilePath != "" {
+			defer startProfile(chip8, logger)()
+		} else {
+			chip8.Profiler = interpreter.NewProfiler()
+			defer func() {
+				if err := writeProfile(chip8, os.Stdout, ""); err != nil {
+					logger.Error("Could not write profile", "err", err)
+				}
+			}()
+		}
+
+		runHeadless(chip8, frames)
+	},
+}
+
+func init() {
+	addFramesFlag(profileCmd)
+
+	rootCmd.AddCommand(profileCmd)
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"github.com/braheezy/chip-8/internal/interpreter"
+
+	"github.com/spf13/cobra"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve <rom>",
+	Short: "Run a ROM for browsers to watch and play",
+	Long: `Run a ROM without a window, streaming the display to a page served at --listen. Open it in a browser to watch.
+
+The first browser to connect plays with the usual keypad keys, and everyone after spectates. When the player leaves, the browser that's been watching longest takes over.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newDefaultLogger()
+		address, _ := cmd.Flags().GetString("listen")
+
+		rom := readRom(args[0], logger)
+		chip8 := newCHIP8(rom, logger)
+		defer startScript(chip8, logger)()
+		defer startHighScores(chip8, logger)()
+		viewer := interpreter.NewRemoteViewer(chip8)
+
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		server := &http.Server{Handler: viewer}
+		go func() {
+			if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+				logger.Fatal(err)
+			}
+		}()
+		logger.Info("Serving "+rom.Name, "url", "http://"+listener.Addr().String())
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		viewer.Run(ctx)
+		server.Shutdown(context.Background())
+	},
+}
+
+func init() {
+	serveCmd.Flags().String("listen", "localhost:8080", "TCP address to serve the viewer on")
+
+	rootCmd.AddCommand(serveCmd)
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/braheezy/chip-8/internal/interpreter"
+
+	"github.com/spf13/cobra"
+)
+
+var spritesCmd = &cobra.Command{
+	Use:   "sprites <rom>",
+	Short: "Rip the sprites a ROM draws into a PNG sprite sheet",
+	Long: `Collect every sprite a ROM draws with DXYN while it runs for --frames frames. Each distinct sprite goes on the sheet once, and a listing of where each was drawn from is printed.
+
+Sprites only drawn after a key press, like later levels, won't be found.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newStderrLogger()
+		frames, _ := cmd.Flags().GetInt("frames")
+		scale, _ := cmd.Flags().GetInt("scale")
+		output, _ := cmd.Flags().GetString("output")
+
+		rom := readRom(args[0], logger)
+		if output == "" {
+			output = strings.TrimSuffix(rom.Name, filepath.Ext(rom.Name)) + "-sprites.png"
+		}
+		chip8 := newCHIP8(rom, logger)
+		defer startTrace(chip8, logger)()
+		chip8.Sprites = interpreter.NewSpriteRecorder()
+		runHeadless(chip8, frames)
+
+		sprites := chip8.Sprites.Sprites()
+		if len(sprites) == 0 {
+			logger.Fatal("No sprites were drawn, try running for more --frames")
+		}
+		palette, err := chip8.Options.ResolvePalette()
+		if err != nil {
+			logger.Fatal(err)
+		}
+		f, err := os.Create(output)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer f.Close()
+		if err := png.Encode(f, interpreter.SpriteSheet(sprites, palette, scale)); err != nil {
+			logger.Fatal(err)
+		}
+		if err := interpreter.WriteSpriteListing(os.Stdout, sprites); err != nil {
+			logger.Fatal(err)
+		}
+		logger.Info("Wrote sprite sheet", "file", output, "sprites", len(sprites))
+	},
+}
+
+func init() {
+	spritesCmd.Flags().StringP("output", "o", "", "Sprite sheet to write (default: the ROM's name with -sprites.png)")
+	addFramesFlag(spritesCmd)
+	spritesCmd.Flags().Int("scale", 4, "How many pixels wide each sprite pixel is")
+
+	rootCmd.AddCommand(spritesCmd)
+}
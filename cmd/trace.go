@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/braheezy/chip-8/internal/interpreter"
+
+	"github.com/spf13/cobra"
+)
+
+var traceCmd = &cobra.Command{
+	Use:   "trace",
+	Short: "Work with instruction traces written by --trace",
+}
+
+var traceDiffCmd = &cobra.Command{
+	Use:   "diff <trace> <trace>",
+	Short: "Find where two traces first disagree",
+	Long:  "Compare two traces record by record, in either format, and show the first one that differs. Exits with status 1 if they differ.",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newDefaultLogger()
+		var traces [2]*interpreter.TraceReader
+		for i, path := range args {
+			f, err := os.Open(path)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			defer f.Close()
+			if traces[i], err = interpreter.NewTraceReader(f); err != nil {
+				logger.Fatalf("%s: %v", path, err)
+			}
+		}
+
+		diff, err := interpreter.DiffTraces(traces[0], traces[1])
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if diff == nil {
+			fmt.Println("Traces match")
+			return
+		}
+
+		fmt.Printf("Traces differ at record %d: %v\n", diff.Index, diff.Fields)
+		for i, record := range []interpreter.TraceRecord{diff.A, diff.B} {
+			if diff.Fields[0] == "end" && record == (interpreter.TraceRecord{}) {
+				fmt.Printf("%s: ended\n", args[i])
+			} else {
+				fmt.Printf("%s: %v\n", args[i], record)
+			}
+		}
+		os.Exit(1)
+	},
+}
+
+var traceRecordCmd = &cobra.Command{
+	Use:   "record <rom>",
+	Short: "Run a ROM without a window, tracing to the file given by --trace",
+	Long: `Trace every instruction a ROM executes in --frames frames to the file given by --trace.
+
+With --from-watch, tracing starts at the first watchpoint hit, so a trace can begin where something interesting happens.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := newDefaultLogger()
+		if tracePath == "" {
+			logger.Fatal("Set the file to trace to with --trace")
+		}
+		frames, _ := cmd.Flags().GetInt("frames")
+		fromWatch, _ := cmd.Flags().GetBool("from-watch")
+		if fromWatch && len(watches) == 0 {
+			logger.Fatal("--from-watch needs a watchpoint, set one with --watch")
+		}
+
+		rom := readRom(args[0], logger)
+		chip8 := newCHIP8(rom, logger)
+		defer startTrace(chip8, logger)()
+
+		tracer := chip8.Tracer
+		if fromWatch {
+			chip8.Tracer = nil
+		}
+		chip8.OnWatch = func(hit interpreter.WatchHit) {
+			logger.Info(hit.String(), "cycle", chip8.Cycles())
+			chip8.Tracer = tracer
+		}
+
+		runHeadless(chip8, frames)
+		if chip8.Tracer == nil {
+			logger.Warn("No watchpoint was hit, so nothing was traced")
+		}
+	},
+}
+
+func init() {
+	addFramesFlag(traceRecordCmd)
+	traceRecordCmd.Flags().Bool("from-watch", false, "Start tracing at the first watchpoint hit")
+
+	traceCmd.AddCommand(traceDiffCmd)
+	traceCmd.AddCommand(traceRecordCmd)
+	rootCmd.AddCommand(traceCmd)
+}
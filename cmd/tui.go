@@ -3,7 +3,6 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 
 	"github.com/braheezy/chip-8/internal/interpreter"
 	"github.com/charmbracelet/log"
@@ -22,37 +21,42 @@ var tuiCmd = &cobra.Command{
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		logger := newDefaultLogger()
-		logFile, err := os.Create("chip8.log")
-		if err != nil {
-			logger.Fatalf("error opening file for logging: %v", err)
-		}
-		defer logFile.Close()
-		if debug {
-			logger.SetLevel(log.DebugLevel)
-		}
-		logger.SetOutput(logFile)
-
-		chipFileName := filepath.Base(args[0])
-		chipData, err := os.ReadFile(args[0])
-		if err != nil {
-			logger.Fatal(err)
-		}
-
-		opts := interpreter.DefaultCHIP8Options()
-		viper.Unmarshal(&opts)
-		chip8 := interpreter.NewCHIP8(&chipData, opts)
-		chip8.Logger = logger
-
-		if viper.GetBool("cosmac-vip.enabled") {
-			logger.Info("COSMAC VIP mode enabled")
-			chip8.Options.CosmacQuirks.EnableAll()
-		}
-
-		interpreter.RunTUI(chip8, chipFileName)
+		runTUI(args[0], newDefaultLogger())
 	},
 }
 
 func init() {
+	tuiCmd.Flags().String("graphics", "cells", "How to draw the display: cells, sixel, kitty or auto")
+	viper.BindPFlag("tui.graphics", tuiCmd.Flags().Lookup("graphics"))
+
 	rootCmd.AddCommand(tuiCmd)
 }
+
+// runTUI runs the ROM in the terminal. Logs go to chip8.log once the TUI starts.
+func runTUI(romFilePath string, logger *log.Logger) {
+	logFile, err := os.Create("chip8.log")
+	if err != nil {
+		logger.Fatalf("error opening file for logging: %v", err)
+	}
+	defer logFile.Close()
+	if debug {
+		logger.SetLevel(log.DebugLevel)
+	}
+
+	// Report bad ROMs and config before the TUI takes over the terminal
+	graphics, err := interpreter.ParseGraphicsMode(viper.GetString("tui.graphics"))
+	if err != nil {
+		logger.Fatal(err)
+	}
+	rom := readRom(romFilePath, logger)
+	chip8 := newCHIP8(rom, logger)
+	// Last to finish, since it may exit
+	defer startScript(chip8, logger)()
+	defer startHighScores(chip8, logger)()
+	defer startTrace(chip8, logger)()
+	defer startProfile(chip8, logger)()
+	defer startGDB(chip8, logger)()
+	logger.SetOutput(logFile)
+
+	interpreter.RunTUI(chip8, rom.Name, graphics)
+}
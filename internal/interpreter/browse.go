@@ -0,0 +1,302 @@
+package interpreter
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// File extensions of CHIP-8, SUPER-CHIP and XO-CHIP ROMs
+var RomExtensions = []string{".ch8", ".sc8", ".xo8"}
+
+// RomEntry is a ROM file found by the browser.
+type RomEntry struct {
+	Path string
+	Size int64
+	Hash string
+	// From the ROM database, if it's listed
+	Info  RomInfo
+	Known bool
+	// The ROM's leaderboard, best first
+	HighScores []HighScore
+}
+
+// Title is the ROM's name from the database, or its file name.
+func (rom RomEntry) Title() string {
+	if rom.Known && rom.Info.Title != "" {
+		return rom.Info.Title
+	}
+	return filepath.Base(rom.Path)
+}
+
+// FindRoms lists the ROMs in a directory and its subdirectories, looking each
+// one up in the database.
+func FindRoms(dir string, db RomDatabase) ([]RomEntry, error) {
+	var roms []RomEntry
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !slices.Contains(RomExtensions, strings.ToLower(filepath.Ext(path))) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		info, known := db.Lookup(data)
+		roms = append(roms, RomEntry{Path: path, Size: int64(len(data)), Hash: RomHash(data), Info: info, Known: known})
+		return nil
+	})
+	slices.SortFunc(roms, func(a, b RomEntry) int {
+		return strings.Compare(strings.ToLower(a.Title()), strings.ToLower(b.Title()))
+	})
+	return roms, err
+}
+
+// BrowserChoice is the ROM picked in the browser, and how to run it.
+type BrowserChoice struct {
+	Rom RomEntry
+	TUI bool
+}
+
+// OptionsLoader returns the options to run a ROM with.
+type OptionsLoader func(rom Rom) (CHIP8Options, error)
+
+// RunBrowser lets the user pick a ROM from a list, previewing each one as it's
+// selected. Returns false if the user quit without picking.
+func RunBrowser(roms []RomEntry, options OptionsLoader) (BrowserChoice, bool, error) {
+	b := &browser{roms: roms, options: options, previewing: -1}
+	model, err := tea.NewProgram(b, tea.WithAltScreen()).Run()
+	if err != nil {
+		return BrowserChoice{}, false, err
+	}
+	b = model.(*browser)
+	if b.choice == nil {
+		return BrowserChoice{}, false, nil
+	}
+	return *b.choice, true, nil
+}
+
+// How often the preview advances, and by how many frames
+const (
+	previewInterval = time.Second / 30
+	previewFrames   = 2
+)
+
+const browserListWidth = 36
+
+type browser struct {
+	roms   []RomEntry
+	cursor int
+	// First ROM shown in the list, for scrolling
+	offset  int
+	height  int
+	options OptionsLoader
+
+	// The selected ROM, running headless
+	preview    *CHIP8
+	previewing int
+	// Set when the preview crashed
+	previewErr error
+
+	choice *BrowserChoice
+}
+
+type previewTickMsg struct{}
+
+func previewTick() tea.Cmd {
+	return tea.Tick(previewInterval, func(time.Time) tea.Msg {
+		return previewTickMsg{}
+	})
+}
+
+func (b *browser) Init() tea.Cmd {
+	return previewTick()
+}
+
+func (b *browser) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		b.height = msg.Height
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "esc", "q":
+			return b, tea.Quit
+		case "up", "k":
+			b.move(-1)
+		case "down", "j":
+			b.move(1)
+		case "pgup":
+			b.move(-b.visibleRows())
+		case "pgdown":
+			b.move(b.visibleRows())
+		case "home", "g":
+			b.move(-len(b.roms))
+		case "end", "G":
+			b.move(len(b.roms))
+		case "enter":
+			b.choice = &BrowserChoice{Rom: b.roms[b.cursor]}
+			return b, tea.Quit
+		case "t":
+			b.choice = &BrowserChoice{Rom: b.roms[b.cursor], TUI: true}
+			return b, tea.Quit
+		}
+
+	case previewTickMsg:
+		b.advancePreview()
+		return b, previewTick()
+	}
+	return b, nil
+}
+
+func (b *browser) visibleRows() int {
+	// Leave room for the help line
+	return max(b.height-2, 1)
+}
+
+func (b *browser) move(delta int) {
+	b.cursor = min(max(b.cursor+delta, 0), len(b.roms)-1)
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	}
+	if b.cursor >= b.offset+b.visibleRows() {
+		b.offset = b.cursor - b.visibleRows() + 1
+	}
+}
+
+// advancePreview runs the selected ROM a little further, starting it over if
+// the selection changed.
+func (b *browser) advancePreview() {
+	if b.previewing != b.cursor {
+		b.previewing = b.cursor
+		b.preview, b.previewErr = nil, nil
+
+		rom := b.roms[b.cursor]
+		data, err := os.ReadFile(rom.Path)
+		if err != nil {
+			b.previewErr = err
+			return
+		}
+		opts, err := b.options(Rom{Name: filepath.Base(rom.Path), Program: data})
+		if err != nil {
+			b.previewErr = err
+			return
+		}
+		b.preview = NewCHIP8(&data, opts)
+	}
+	if b.preview == nil {
+		return
+	}
+
+	// ROMs from the Internet may do anything, like index past the end of memory
+	defer func() {
+		if r := recover(); r != nil {
+			b.previewErr = fmt.Errorf("crashed: %v", r)
+			b.preview = nil
+		}
+	}()
+	for i := 0; i < previewFrames; i++ {
+		b.preview.RunFrame()
+	}
+}
+
+func (b *browser) View() string {
+	selected := lipgloss.NewStyle().Foreground(Colors["Base"]).Background(Colors["Iris"])
+	muted := lipgloss.NewStyle().Foreground(Colors["Muted"])
+
+	var list strings.Builder
+	for i := b.offset; i < len(b.roms) && i < b.offset+b.visibleRows(); i++ {
+		line := fmt.Sprintf(" %-*s", browserListWidth-1, truncate(b.roms[i].Title(), browserListWidth-2))
+		if i == b.cursor {
+			line = selected.Render(line)
+		}
+		list.WriteString(line + "\n")
+	}
+
+	rom := b.roms[b.cursor]
+	var details strings.Builder
+	switch {
+	case b.previewErr != nil:
+		details.WriteString(muted.Render("No preview: "+b.previewErr.Error()) + "\n")
+	case b.preview != nil:
+		details.WriteString(b.preview.display.halfBlocks() + "\n")
+	}
+	details.WriteString(lipgloss.NewStyle().Bold(true).Render(rom.Title()) + "\n")
+	if len(rom.Info.Authors) > 0 {
+		details.WriteString("by " + strings.Join(rom.Info.Authors, ", ") + "\n")
+	}
+	details.WriteString(muted.Render(fmt.Sprintf("%s  %d bytes  %s", rom.Path, rom.Size, rom.Hash)) + "\n")
+	if rom.Info.Description != "" {
+		details.WriteString("\n" + lipgloss.NewStyle().Width(DisplayWidth).Render(rom.Info.Description) + "\n")
+	}
+	if len(rom.HighScores) > 0 {
+		details.WriteString("\n" + lipgloss.NewStyle().Bold(true).Render("High scores") + "\n")
+		for i, score := range rom.HighScores {
+			details.WriteString(fmt.Sprintf("%2d. %s\n", i+1, score))
+		}
+	}
+
+	view := lipgloss.JoinHorizontal(lipgloss.Top,
+		lipgloss.NewStyle().Width(browserListWidth+1).Render(list.String()),
+		details.String(),
+	)
+	help := muted.Render("↑/↓ select • enter run in window • t run in terminal • q quit")
+	return view + "\n" + help
+}
+
+func truncate(s string, length int) string {
+	runes := []rune(s)
+	if len(runes) <= length {
+		return s
+	}
+	return string(runes[:length-1]) + "…"
+}
+
+// halfBlocks renders the display as text, two pixels per character cell, for
+// small previews.
+func (d *Display) halfBlocks() string {
+	// Every combination of top and bottom pixel
+	var styles [2][2]lipgloss.Style
+	for top := 0; top < 2; top++ {
+		for bottom := 0; bottom < 2; bottom++ {
+			styles[top][bottom] = lipgloss.NewStyle().Foreground(d.palette[top]).Background(d.palette[bottom])
+		}
+	}
+
+	var view strings.Builder
+	for y := 0; y < d.height(); y += 2 {
+		// Group runs of identical cells to keep the escape codes down
+		run, runTop, runBottom := 0, 0, 0
+		flush := func() {
+			if run > 0 {
+				view.WriteString(styles[runTop][runBottom].Render(strings.Repeat("▀", run)))
+			}
+		}
+		for x := 0; x < d.width(); x++ {
+			top, bottom := 0, 0
+			if d.content.Pixel(0, x, y) {
+				top = 1
+			}
+			if y+1 < d.height() && d.content.Pixel(0, x, y+1) {
+				bottom = 1
+			}
+			if run > 0 && (top != runTop || bottom != runBottom) {
+				flush()
+				run = 0
+			}
+			run, runTop, runBottom = run+1, top, bottom
+		}
+		flush()
+		view.WriteRune('\n')
+	}
+	return strings.TrimSuffix(view.String(), "\n")
+}
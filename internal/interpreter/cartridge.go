@@ -0,0 +1,219 @@
+package interpreter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"strings"
+)
+
+// An Octo cartridge is a GIF with a payload hidden in the low two bits of each
+// pixel's palette index, most significant bits first, frame after frame. The
+// payload is a 4 byte big-endian length followed by that much JSON.
+type cartridgePayload struct {
+	// Octo source code
+	Program string           `json:"program"`
+	Options CartridgeOptions `json:"options"`
+}
+
+// CartridgeOptions are the settings Octo saves in a cartridge, as far as chip8
+// understands them.
+type CartridgeOptions struct {
+	// Instructions per frame
+	Tickrate        int    `json:"tickrate,omitempty"`
+	BackgroundColor string `json:"backgroundColor,omitempty"`
+	FillColor       string `json:"fillColor,omitempty"`
+	// Logic instructions reset VF, like the COSMAC VIP
+	LogicQuirks bool `json:"logicQuirks"`
+	// Load and store instructions leave I alone, unlike the COSMAC VIP
+	LoadStoreQuirks bool `json:"loadStoreQuirks"`
+}
+
+// Apply adjusts options to match the cartridge. Like RomInfo.Apply, settings the
+// user has already chosen are left alone.
+func (cart CartridgeOptions) Apply(opts *CHIP8Options) {
+	if opts.ThrottleSpeed == 0 && cart.Tickrate > 0 {
+		opts.ThrottleSpeed = cart.Tickrate * 6
+	}
+	if _, err := ParseColor(cart.BackgroundColor); opts.OffColor == "" && err == nil {
+		opts.OffColor = cart.BackgroundColor
+	}
+	if _, err := ParseColor(cart.FillColor); opts.OnColor == "" && err == nil {
+		opts.OnColor = cart.FillColor
+	}
+	if cart.LogicQuirks {
+		opts.CosmacQuirks.ResetVF = true
+	}
+	if !cart.LoadStoreQuirks {
+		opts.CosmacQuirks.IncrementI = true
+	}
+}
+
+// cartridgeOptions describes options the way Octo saves them.
+func cartridgeOptions(opts CHIP8Options) CartridgeOptions {
+	cart := CartridgeOptions{
+		Tickrate:        opts.ThrottleSpeed / 6,
+		LogicQuirks:     opts.CosmacQuirks.ResetVF,
+		LoadStoreQuirks: !opts.CosmacQuirks.IncrementI,
+	}
+	if palette, err := opts.ResolvePalette(); err == nil {
+		cart.BackgroundColor = hexColor(palette[0])
+		cart.FillColor = hexColor(palette[1])
+	}
+	return cart
+}
+
+func hexColor(c color.Color) string {
+	rgba := toRGBA(c)
+	return fmt.Sprintf("#%02X%02X%02X", rgba.R, rgba.G, rgba.B)
+}
+
+// DecodeCartridge reads the program and options from an Octo cartridge GIF.
+func DecodeCartridge(r io.Reader) ([]byte, CartridgeOptions, error) {
+	payload, err := readCartridge(r)
+	if err != nil {
+		return nil, payload.Options, err
+	}
+	program, err := assembleOcto(payload.Program)
+	if err != nil {
+		return nil, payload.Options, fmt.Errorf("cartridge program: %w", err)
+	}
+	return program, payload.Options, nil
+}
+
+func readCartridge(r io.Reader) (cartridgePayload, error) {
+	var payload cartridgePayload
+	image, err := gif.DecodeAll(r)
+	if err != nil {
+		return payload, fmt.Errorf("invalid cartridge: %w", err)
+	}
+
+	var data []byte
+	var acc byte
+	bits := 0
+	for _, frame := range image.Image {
+		for _, index := range frame.Pix {
+			acc = acc<<2 | index&3
+			if bits += 2; bits == 8 {
+				data = append(data, acc)
+				acc, bits = 0, 0
+			}
+		}
+	}
+
+	if len(data) < 4 {
+		return payload, errors.New("invalid cartridge: no data")
+	}
+	size := int(data[0])<<24 | int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+	if size > len(data)-4 {
+		return payload, errors.New("invalid cartridge: truncated data")
+	}
+	if err := json.Unmarshal(data[4:4+size], &payload); err != nil {
+		return payload, fmt.Errorf("invalid cartridge: %w", err)
+	}
+	return payload, nil
+}
+
+// disassembleBytes writes a program as Octo source that assembles back to the
+// same bytes.
+func disassembleBytes(program []byte) string {
+	var source strings.Builder
+	source.WriteString(": main\n")
+	for i, b := range program {
+		fmt.Fprintf(&source, "0x%02X", b)
+		if i%16 == 15 || i == len(program)-1 {
+			source.WriteByte('\n')
+		} else {
+			source.WriteByte(' ')
+		}
+	}
+	return source.String()
+}
+
+// Cartridge frames are the size of Octo's, and show the display at double size
+const (
+	cartridgeWidth  = 160
+	cartridgeHeight = 128
+	cartridgeScale  = 2
+	// Frames the program runs for before taking the cartridge's picture
+	cartridgeWarmup = 120
+)
+
+// EncodeCartridge packs a program and its options into an Octo cartridge GIF.
+// The picture is the program's display after it's run for a couple of seconds.
+func EncodeCartridge(w io.Writer, program []byte, opts CHIP8Options) error {
+	source, err := json.Marshal(cartridgePayload{
+		Program: disassembleBytes(program),
+		Options: cartridgeOptions(opts),
+	})
+	if err != nil {
+		return err
+	}
+	data := append([]byte{byte(len(source) >> 24), byte(len(source) >> 16), byte(len(source) >> 8), byte(len(source))}, source...)
+
+	picture, colors := cartridgePicture(program, opts)
+	// Each color fills a run of 4 palette entries, so the low two bits of every
+	// index are free to carry data without changing the picture
+	palette := make(color.Palette, 256)
+	for i := range palette {
+		palette[i] = colors[min(i>>2, len(colors)-1)]
+	}
+
+	perFrame := cartridgeWidth * cartridgeHeight / 4
+	var frames gif.GIF
+	for start := 0; start == 0 || start < len(data); start += perFrame {
+		frame := image.NewPaletted(image.Rect(0, 0, cartridgeWidth, cartridgeHeight), palette)
+		for i := range frame.Pix {
+			var bits byte
+			if n := start + i/4; n < len(data) {
+				bits = data[n] >> (6 - 2*(i%4)) & 3
+			}
+			frame.Pix[i] = picture[i]<<2 | bits
+		}
+		frames.Image = append(frames.Image, frame)
+		frames.Delay = append(frames.Delay, 0)
+	}
+	return gif.EncodeAll(w, &frames)
+}
+
+// cartridgePicture draws the program's display centered on a border, as indexes
+// into the returned colors.
+func cartridgePicture(program []byte, opts CHIP8Options) ([]byte, []color.Color) {
+	preview := NewCHIP8(&program, opts)
+	func() {
+		// Take whatever was drawn before a bad program crashes
+		defer func() { recover() }()
+		for i := 0; i < cartridgeWarmup; i++ {
+			preview.RunFrame()
+		}
+	}()
+
+	const (
+		border = iota
+		off
+		on
+	)
+	colors := []color.Color{toRGBA(preview.borderColor), toRGBA(preview.display.palette[0]), toRGBA(preview.display.palette[1])}
+
+	picture := make([]byte, cartridgeWidth*cartridgeHeight)
+	left := (cartridgeWidth - DisplayWidth*cartridgeScale) / 2
+	top := (cartridgeHeight - DisplayHeight*cartridgeScale) / 2
+	for y := 0; y < cartridgeHeight; y++ {
+		for x := 0; x < cartridgeWidth; x++ {
+			dx, dy := (x-left)/cartridgeScale, (y-top)/cartridgeScale
+			switch {
+			case x < left || y < top || dx >= DisplayWidth || dy >= DisplayHeight:
+				picture[y*cartridgeWidth+x] = border
+			case preview.display.content.Pixel(0, dx, dy):
+				picture[y*cartridgeWidth+x] = on
+			default:
+				picture[y*cartridgeWidth+x] = off
+			}
+		}
+	}
+	return picture, colors
+}
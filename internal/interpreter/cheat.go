@@ -0,0 +1,182 @@
+package interpreter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Cheat freezes a byte of memory at a value, like the lives counter.
+type Cheat struct {
+	Address uint16
+	Value   byte
+	Name    string
+}
+
+func (c Cheat) String() string {
+	line := fmt.Sprintf("0x%03X = 0x%02X", c.Address, c.Value)
+	if c.Name != "" {
+		line += "  " + c.Name
+	}
+	return line
+}
+
+// LoadCheats reads a cheat file. Each line freezes an address at a value, with
+// an optional name:
+//
+//	# Comments start with a hash
+//	0x2F0 = 3  Infinite lives
+//	0x2F1 = 0x99
+func LoadCheats(path string) ([]Cheat, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cheats, err := ParseCheats(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cheats, nil
+}
+
+// ParseCheats reads cheats in the format LoadCheats describes.
+func ParseCheats(r io.Reader) ([]Cheat, error) {
+	var cheats []Cheat
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		address, rest, ok := strings.Cut(line, "=")
+		fields := strings.Fields(rest)
+		if !ok || len(fields) == 0 {
+			return nil, fmt.Errorf("line %d: expected ADDRESS = VALUE, got %q", n, line)
+		}
+		addr, err := strconv.ParseUint(strings.TrimSpace(address), 0, 16)
+		if err != nil || addr >= memorySize {
+			return nil, fmt.Errorf("line %d: %q is not an address in memory", n, strings.TrimSpace(address))
+		}
+		value, err := strconv.ParseUint(fields[0], 0, 8)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %q is not a byte", n, fields[0])
+		}
+		cheats = append(cheats, Cheat{Address: uint16(addr), Value: byte(value), Name: strings.Join(fields[1:], " ")})
+	}
+	return cheats, scanner.Err()
+}
+
+// applyCheats writes the frozen values back into memory.
+func (chip8 *CHIP8) applyCheats() {
+	if chip8.control.cheatsOff {
+		return
+	}
+	for _, cheat := range chip8.Cheats {
+		chip8.memory[cheat.Address] = cheat.Value
+	}
+}
+
+// cheating reports whether cheats are freezing memory.
+func (chip8 *CHIP8) cheating() bool {
+	return len(chip8.Cheats) > 0 && !chip8.control.cheatsOff
+}
+
+func (chip8 *CHIP8) toggleCheats() {
+	if len(chip8.Cheats) == 0 {
+		chip8.notify("No cheats loaded")
+		return
+	}
+	chip8.control.cheatsOff = !chip8.control.cheatsOff
+	chip8.notify("Cheats %s", onOff(!chip8.control.cheatsOff))
+}
+
+// tamper marks the game in progress as cheated, for changes to memory and
+// registers made outside the program, from the memory viewer, scripts and
+// debuggers.
+func (chip8 *CHIP8) tamper() {
+	if chip8.HighScores != nil {
+		chip8.HighScores.cheated = true
+	}
+}
+
+// frozen reports whether a cheat holds the address at a value.
+func (chip8 *CHIP8) frozen(addr uint16) bool {
+	if chip8.control.cheatsOff {
+		return false
+	}
+	for _, cheat := range chip8.Cheats {
+		if cheat.Address == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// toggleFreeze freezes the byte at an address at its current value, or thaws it
+// if it's already frozen.
+func (chip8 *CHIP8) toggleFreeze(addr uint16) {
+	for i, cheat := range chip8.Cheats {
+		if cheat.Address == addr {
+			chip8.Cheats = append(chip8.Cheats[:i], chip8.Cheats[i+1:]...)
+			chip8.notify("Thawed %04X", addr)
+			return
+		}
+	}
+	cheat := Cheat{Address: addr, Value: chip8.memory[addr]}
+	chip8.Cheats = append(chip8.Cheats, cheat)
+	chip8.control.cheatsOff = false
+	chip8.notify("Froze %04X at %02X", addr, cheat.Value)
+	// Ready to copy into a cheat file
+	chip8.Logger.Info("Cheat: " + cheat.String())
+}
+
+// MemorySearch narrows down where a value lives in memory, by comparing it
+// between snapshots: take one, play until the value changes (or doesn't), then
+// keep only the addresses that changed the same way.
+type MemorySearch struct {
+	snapshot   [memorySize]byte
+	candidates []uint16
+}
+
+// NewMemorySearch starts a search with every address as a candidate.
+func NewMemorySearch(memory *[memorySize]byte) *MemorySearch {
+	s := &MemorySearch{snapshot: *memory}
+	for addr := range memory {
+		s.candidates = append(s.candidates, uint16(addr))
+	}
+	return s
+}
+
+// Ways to compare a candidate's value now with its value in the last snapshot
+var (
+	SearchEqual     = func(before, now byte) bool { return now == before }
+	SearchChanged   = func(before, now byte) bool { return now != before }
+	SearchIncreased = func(before, now byte) bool { return now > before }
+	SearchDecreased = func(before, now byte) bool { return now < before }
+)
+
+// SearchValue keeps candidates that hold the value now.
+func SearchValue(value byte) func(before, now byte) bool {
+	return func(_, now byte) bool { return now == value }
+}
+
+// Filter keeps the candidates that pass the comparison, and takes a new snapshot.
+func (s *MemorySearch) Filter(memory *[memorySize]byte, keep func(before, now byte) bool) {
+	kept := s.candidates[:0]
+	for _, addr := range s.candidates {
+		if keep(s.snapshot[addr], memory[addr]) {
+			kept = append(kept, addr)
+		}
+	}
+	s.candidates = kept
+	s.snapshot = *memory
+}
+
+// Candidates are the addresses still in the running.
+func (s *MemorySearch) Candidates() []uint16 {
+	return s.candidates
+}
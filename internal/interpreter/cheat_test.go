@@ -0,0 +1,107 @@
+package interpreter
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseCheats(t *testing.T) {
+	cheats, err := ParseCheats(strings.NewReader(`
+# Lives and score
+0x2F0 = 3  Infinite lives
+  750=0x99
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Cheat{{0x2F0, 3, "Infinite lives"}, {750, 0x99, ""}}
+	if !slices.Equal(cheats, want) {
+		t.Errorf("Expected %v, got %v", want, cheats)
+	}
+
+	for _, bad := range []string{"0x2F0", "0x2F0 =", "0x1000 = 1", "0x2F0 = 256", "lives = 3"} {
+		if _, err := ParseCheats(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+// A program that takes a life every frame
+var livesProgram = []byte{
+	0xA3, 0x00, // 200: LD I, 0x300
+	0xF0, 0x65, // 202: LD V0, [I]
+	0x70, 0xFF, // 204: ADD V0, 0xFF
+	0xF0, 0x55, // 206: LD [I], V0
+	0x12, 0x00, // 208: JP 0x200
+}
+
+func TestCheatsFreezeMemory(t *testing.T) {
+	chip8 := NewCHIP8(&livesProgram, DefaultCHIP8Options())
+	chip8.Cheats = []Cheat{{Address: 0x300, Value: 5}}
+	for i := 0; i < 3; i++ {
+		chip8.RunFrame()
+		if chip8.memory[0x300] != 4 {
+			t.Fatalf("Expected the lives to be refilled every frame, got %d", chip8.memory[0x300])
+		}
+	}
+
+	chip8.toggleCheats()
+	chip8.RunFrame()
+	chip8.RunFrame()
+	if chip8.memory[0x300] != 2 {
+		t.Errorf("Expected lives to run down with cheats off, got %d", chip8.memory[0x300])
+	}
+}
+
+func TestMemorySearch(t *testing.T) {
+	chip8 := NewCHIP8(&livesProgram, DefaultCHIP8Options())
+	chip8.memory[0x300] = 9
+	for _, key := range []string{"f3", "/"} {
+		chip8.memoryViewerKey(key)
+	}
+	if !chip8.memview.capturing() {
+		t.Fatal("Expected search mode to take every key")
+	}
+
+	chip8.RunFrame()
+	chip8.memoryViewerKey("d")
+	if got := chip8.memview.search.Candidates(); !slices.Equal(got, []uint16{0x300}) {
+		t.Fatalf("Expected only the lives to have decreased, got %X", got)
+	}
+	if chip8.memview.cursor != 0x300 {
+		t.Errorf("Expected the cursor on the candidate, got %04X", chip8.memview.cursor)
+	}
+
+	// Searching for the value it holds now keeps it, an old value doesn't
+	chip8.RunFrame()
+	for _, key := range []string{"=", "0", "7"} {
+		chip8.memoryViewerKey(key)
+	}
+	if len(chip8.memview.search.Candidates()) != 1 {
+		t.Error("Expected the lives to equal 7")
+	}
+	chip8.memview.search.Filter(&chip8.memory, SearchValue(8))
+	if len(chip8.memview.search.Candidates()) != 0 {
+		t.Error("Expected nothing to equal 8")
+	}
+
+	chip8.memoryViewerKey("f")
+	if !slices.Equal(chip8.Cheats, []Cheat{{Address: 0x300, Value: 7}}) {
+		t.Fatalf("Expected the lives frozen at 7, got %v", chip8.Cheats)
+	}
+	chip8.RunFrame()
+	chip8.RunFrame()
+	if chip8.memory[0x300] != 6 {
+		t.Errorf("Expected the frozen lives to stop running down, got %d", chip8.memory[0x300])
+	}
+	chip8.memoryViewerKey("f")
+	if len(chip8.Cheats) != 0 {
+		t.Error("Expected f to thaw the lives")
+	}
+
+	chip8.memoryViewerKey("esc")
+	if chip8.memview.capturing() {
+		t.Error("Expected esc to leave search mode")
+	}
+}
@@ -0,0 +1,217 @@
+package interpreter
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Speeds to step through with the slower and faster hotkeys
+var speeds = []float64{0.25, 0.5, 1, 2, 4}
+
+const (
+	normalSpeedIndex = 2
+	// Holding fast forward runs this many frames per update, unthrottled
+	fastForwardSpeed = 8
+)
+
+// control holds the runtime playback state changed by hotkeys.
+type control struct {
+	paused bool
+	// Run a single frame while paused
+	advanceFrame bool
+	fastForward  bool
+	speedIndex   int
+	// Ignore throttle_speed, for frames run without a frontend
+	unthrottled bool
+	// A watchpoint was hit, so stop the current frame
+	watchBreak bool
+	// Fractional frames owed at slow speeds
+	frameBudget float64
+	// Stop applying the loaded cheats
+	cheatsOff bool
+}
+
+func (chip8 *CHIP8) speed() float64 {
+	if chip8.control.fastForward {
+		return fastForwardSpeed
+	}
+	return speeds[chip8.control.speedIndex]
+}
+
+func (chip8 *CHIP8) togglePause() {
+	chip8.control.paused = !chip8.control.paused
+	if chip8.control.paused {
+		chip8.notify("Paused")
+	} else {
+		// Don't count the time spent paused against the timers
+		lastDelayTimerUpdate = time.Now()
+		lastSoundTimerUpdate = time.Now()
+		chip8.notify("Resumed")
+	}
+}
+
+// stepFrame runs a single frame, pausing first if needed.
+func (chip8 *CHIP8) stepFrame() {
+	if !chip8.control.paused {
+		chip8.togglePause()
+	}
+	chip8.control.advanceFrame = true
+}
+
+// changeSpeed moves up or down the list of speeds.
+func (chip8 *CHIP8) changeSpeed(delta int) {
+	chip8.control.speedIndex = min(max(chip8.control.speedIndex+delta, 0), len(speeds)-1)
+	chip8.notify("Speed x%g", speeds[chip8.control.speedIndex])
+}
+
+func (chip8 *CHIP8) setFastForward(on bool) {
+	if on == chip8.control.fastForward {
+		return
+	}
+	chip8.control.fastForward = on
+	if on {
+		chip8.notify("Fast forward")
+	} else {
+		chip8.notify("Speed x%g", speeds[chip8.control.speedIndex])
+	}
+}
+
+// Reset reloads the program into memory and starts it over, like switching the
+// machine off and on again.
+func (chip8 *CHIP8) Reset() {
+	chip8.memory = [memorySize]byte{}
+	chip8.loadFont()
+	copy(chip8.memory[programStartAddress:], chip8.program)
+
+	chip8.pc = programStartAddress
+	chip8.I = 0
+	chip8.V = [16]byte{}
+	chip8.delayTimer = 0
+	chip8.soundTimer = 0
+	chip8.stack = Stack{}
+	chip8.pressedKeys = []byte{}
+	chip8.dirtyKeys = false
+	chip8.cycles = 0
+	chip8.restartIPS()
+	chip8.control.frameBudget = 0
+	chip8.control.advanceFrame = false
+	chip8.display.clear()
+	chip8.silence()
+}
+
+// tick advances the interpreter by one frontend update, honoring pause, frame
+// advance and the current speed.
+func (chip8 *CHIP8) tick() {
+	if chip8.Netplay != nil {
+		chip8.Netplay.tick()
+		return
+	}
+	frames := 0
+	switch {
+	case chip8.control.advanceFrame:
+		chip8.control.advanceFrame = false
+		chip8.RunFrame()
+		return
+	case chip8.control.paused, chip8.debugHalted():
+		chip8.silence()
+		return
+	default:
+		speed := chip8.speed()
+		chip8.updateTimers(speed)
+		chip8.control.frameBudget += speed
+		frames = int(chip8.control.frameBudget)
+		chip8.control.frameBudget -= float64(frames)
+	}
+
+	for ; frames > 0 && !chip8.finished() && !chip8.control.paused && !chip8.debugHalted(); frames-- {
+		chip8.stepInterpreter()
+	}
+}
+
+// RunFrame advances the interpreter by one frame without a frontend: the same
+// work the window does each update, with a frame's worth of time passing for the
+// timers. Nothing is throttled, drawn or played, so the result only depends on
+// the program and input.
+func (chip8 *CHIP8) RunFrame() {
+	chip8.delayTimer -= min(chip8.delayTimer, 1)
+	chip8.soundTimer -= min(chip8.soundTimer, 1)
+	if !chip8.finished() {
+		chip8.control.unthrottled = true
+		chip8.stepInterpreter()
+		chip8.control.unthrottled = false
+	}
+}
+
+// updateTimers decrements the delay and sound timers at 60Hz, sped up or slowed
+// down to match the current speed, and plays the beep while the sound timer runs.
+func (chip8 *CHIP8) updateTimers(speed float64) {
+	interval := time.Duration(float64(decrementInterval) / speed)
+
+	// Calculate elapsed time since last timer update
+	elapsed := time.Since(lastDelayTimerUpdate)
+	if chip8.delayTimer > 0 {
+		if elapsed >= interval {
+			chip8.delayTimer--
+			lastDelayTimerUpdate = lastDelayTimerUpdate.Add(interval)
+		}
+	}
+
+	elapsed = time.Since(lastSoundTimerUpdate)
+	if chip8.soundTimer > 0 {
+		chip8.playBeep()
+		if elapsed >= interval {
+			chip8.soundTimer--
+			lastSoundTimerUpdate = lastSoundTimerUpdate.Add(interval)
+		}
+	} else {
+		chip8.silence()
+	}
+}
+
+// silence stops the beep, ready to play from the start next time.
+func (chip8 *CHIP8) silence() {
+	if chip8.beep != nil && chip8.beep.IsPlaying() {
+		chip8.beep.Pause()
+		chip8.beep.SetPosition(0)
+	}
+}
+
+// finished reports whether the program has run off its end.
+func (chip8 *CHIP8) finished() bool {
+	return int(chip8.pc) == chip8.programSize || chip8.debug != nil && chip8.debug.quit || chip8.Script.exited()
+}
+
+// Finished reports whether the program has run off its end, for running without
+// a frontend.
+func (chip8 *CHIP8) Finished() bool {
+	return chip8.finished()
+}
+
+// Seed makes CXNN give the same random numbers every time for the same seed.
+func (chip8 *CHIP8) Seed(seed int64) {
+	chip8.random = rand.New(rand.NewSource(seed))
+}
+
+// HoldKeys holds exactly the given keys until they're changed, for driving the
+// interpreter without a frontend.
+func (chip8 *CHIP8) HoldKeys(keys Action) {
+	chip8.pressedKeys = keys.keys()
+	chip8.dirtyKeys = len(chip8.pressedKeys) > 0
+}
+
+// Pixels is the display, one byte per pixel row by row, 1 for lit pixels.
+func (chip8 *CHIP8) Pixels() (width, height int, pixels []byte) {
+	content := chip8.display.content
+	width, height = content.Width(), content.Height()
+	pixels = make([]byte, width*height)
+	content.Expand(0, pixels)
+	for i, pixel := range pixels {
+		pixels[i] = pixel & 1
+	}
+	return width, height, pixels
+}
+
+// Cycles is how many instructions have been executed.
+func (chip8 *CHIP8) Cycles() uint64 {
+	return chip8.cycles
+}
@@ -0,0 +1,79 @@
+package interpreter
+
+import "testing"
+
+// A game scoring a point whenever key 5 is held, taking two frames a round
+var pointsProgram = []byte{
+	0xA3, 0x00, // 200: LD I, 0x300
+	0x60, 0x05, // 202: LD V0, 5
+	0xE0, 0xA1, // 204: SKNP V0
+	0x71, 0x01, // 206: ADD V1, 1
+	0xC2, 0xFF, // 208: RND V2, 0xFF
+	0xF2, 0x55, // 20A: LD [I], V2
+	0x12, 0x00, // 20C: JP 0x200
+}
+
+// loopProgram jumps to itself, so every frame runs exactly one instruction.
+var loopProgram = []byte{0x12, 0x00}
+
+func TestTick(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(chip8 *CHIP8)
+		ticks int
+		want  uint64
+	}{
+		{"normal speed", func(chip8 *CHIP8) {}, 3, 3},
+		{"slower", func(chip8 *CHIP8) { chip8.changeSpeed(-1) }, 4, 2},
+		{"slowest", func(chip8 *CHIP8) { chip8.changeSpeed(-10) }, 8, 2},
+		{"faster", func(chip8 *CHIP8) { chip8.changeSpeed(1) }, 3, 6},
+		{"fastest", func(chip8 *CHIP8) { chip8.changeSpeed(10) }, 2, 8},
+		{"fast forward", func(chip8 *CHIP8) { chip8.setFastForward(true) }, 1, fastForwardSpeed},
+		{"paused", func(chip8 *CHIP8) { chip8.togglePause() }, 5, 0},
+		{"resumed", func(chip8 *CHIP8) { chip8.togglePause(); chip8.togglePause() }, 2, 2},
+		{"frame advance", func(chip8 *CHIP8) { chip8.stepFrame() }, 3, 1},
+		{"reset", func(chip8 *CHIP8) {
+			// Leaves 3/4 of a frame owed, which mustn't carry over
+			chip8.changeSpeed(-2)
+			for i := 0; i < 3; i++ {
+				chip8.tick()
+			}
+			chip8.Reset()
+		}, 3, 0},
+		{"reset frame advance", func(chip8 *CHIP8) { chip8.stepFrame(); chip8.Reset() }, 3, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chip8 := NewCHIP8(&loopProgram, DefaultCHIP8Options())
+			test.setup(chip8)
+			for i := 0; i < test.ticks; i++ {
+				chip8.tick()
+			}
+			if got := chip8.Cycles(); got != test.want {
+				t.Errorf("Expected %d instructions, got %d", test.want, got)
+			}
+		})
+	}
+}
+
+func TestReset(t *testing.T) {
+	chip8 := NewCHIP8(&pointsProgram, DefaultCHIP8Options())
+	chip8.pressedKeys = []byte{5}
+	chip8.dirtyKeys = true
+	for i := 0; i < 10; i++ {
+		chip8.RunFrame()
+	}
+	// As the HUD samples it
+	chip8.hud.sampledFrom = chip8.cycles
+	chip8.Reset()
+
+	if chip8.Cycles() != 0 || chip8.pc != programStartAddress || chip8.V != [16]byte{} || chip8.memory[0x301] != 0 {
+		t.Errorf("Expected a fresh start, got %d cycles, PC %#x, V %v", chip8.Cycles(), chip8.pc, chip8.V)
+	}
+	if len(chip8.pressedKeys) != 0 {
+		t.Errorf("Expected no keys held, got %v", chip8.pressedKeys)
+	}
+	if chip8.hud.sampledFrom != 0 {
+		t.Errorf("Expected the IPS sample to start over, got %d", chip8.hud.sampledFrom)
+	}
+}
@@ -0,0 +1,685 @@
+package interpreter
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/log"
+)
+
+// DAPServer debugs a ROM for an editor over the Debug Adapter Protocol. The
+// editor launches a ROM, which the frontend then runs from Launched.
+type DAPServer struct {
+	// Receives the interpreter when the editor launches a ROM, ready to run
+	Launched chan *CHIP8
+
+	conn    io.ReadWriter
+	options OptionsLoader
+	logger  *log.Logger
+	// Guards writes and the message sequence, since events come from other goroutines
+	writeMu sync.Mutex
+	seq     int
+
+	chip8       *CHIP8
+	symbols     *SymbolMap
+	stopOnEntry bool
+	// Breakpoint addresses set by source line, per file, and by address
+	sourceBreakpoints      map[string][]uint16
+	instructionBreakpoints []uint16
+}
+
+// NewDAPServer creates a server talking to an editor over conn, running ROMs
+// with the options from the loader.
+func NewDAPServer(conn io.ReadWriter, options OptionsLoader, logger *log.Logger) *DAPServer {
+	return &DAPServer{
+		Launched:          make(chan *CHIP8, 1),
+		conn:              conn,
+		options:           options,
+		logger:            logger,
+		sourceBreakpoints: map[string][]uint16{},
+	}
+}
+
+// Variable references for the scopes
+const (
+	dapRegisters = 1
+	dapMemory    = 2
+)
+
+// How many bytes a row of the memory view shows
+const dapMemoryRow = 16
+
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type dapResponse struct {
+	Seq        int    `json:"seq"`
+	Type       string `json:"type"`
+	RequestSeq int    `json:"request_seq"`
+	Success    bool   `json:"success"`
+	Command    string `json:"command"`
+	Message    string `json:"message,omitempty"`
+	Body       any    `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq   int    `json:"seq"`
+	Type  string `json:"type"`
+	Event string `json:"event"`
+	Body  any    `json:"body,omitempty"`
+}
+
+type dapSource struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+type dapBreakpoint struct {
+	Verified             bool   `json:"verified"`
+	Line                 int    `json:"line,omitempty"`
+	InstructionReference string `json:"instructionReference,omitempty"`
+	Message              string `json:"message,omitempty"`
+}
+
+type dapStackFrame struct {
+	ID                          int        `json:"id"`
+	Name                        string     `json:"name"`
+	Source                      *dapSource `json:"source,omitempty"`
+	Line                        int        `json:"line"`
+	Column                      int        `json:"column"`
+	InstructionPointerReference string     `json:"instructionPointerReference"`
+}
+
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	VariablesReference int    `json:"variablesReference"`
+	MemoryReference    string `json:"memoryReference,omitempty"`
+}
+
+type dapInstruction struct {
+	Address          string     `json:"address"`
+	InstructionBytes string     `json:"instructionBytes,omitempty"`
+	Instruction      string     `json:"instruction"`
+	Symbol           string     `json:"symbol,omitempty"`
+	Location         *dapSource `json:"location,omitempty"`
+	Line             int        `json:"line,omitempty"`
+	PresentationHint string     `json:"presentationHint,omitempty"`
+}
+
+// Serve answers the editor until it disconnects. The running ROM is stopped
+// when it does.
+func (s *DAPServer) Serve() error {
+	requests := make(chan dapRequest)
+	readErr := make(chan error, 1)
+	go s.readRequests(requests, readErr)
+
+	// Nil until a ROM is launched, which blocks forever
+	var stops chan stopEvent
+	for {
+		select {
+		case request, ok := <-requests:
+			if !ok {
+				s.quit()
+				return <-readErr
+			}
+			if !s.handle(request) {
+				return nil
+			}
+			if s.chip8 != nil {
+				stops = s.chip8.debug.stops
+			}
+		case event := <-stops:
+			body := map[string]any{"reason": event.reason, "threadId": 1, "allThreadsStopped": true}
+			if event.watch != nil {
+				body["text"] = event.watch.String()
+			}
+			s.event("stopped", body)
+		}
+	}
+}
+
+// Exited tells the editor the ROM has stopped running.
+func (s *DAPServer) Exited() {
+	s.event("exited", map[string]any{"exitCode": 0})
+	s.event("terminated", nil)
+}
+
+// readRequests delivers requests until the connection closes, then sends the
+// reason, or nil for a clean close.
+func (s *DAPServer) readRequests(requests chan<- dapRequest, readErr chan<- error) {
+	defer close(requests)
+	r := bufio.NewReader(s.conn)
+	for {
+		length := -1
+		for {
+			header, err := r.ReadString('\n')
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					err = nil
+				}
+				readErr <- err
+				return
+			}
+			header = strings.TrimSpace(header)
+			if header == "" {
+				break
+			}
+			if name, value, _ := strings.Cut(header, ":"); strings.EqualFold(name, "Content-Length") {
+				length, _ = strconv.Atoi(strings.TrimSpace(value))
+			}
+		}
+		if length < 0 {
+			readErr <- errors.New("DAP message without a Content-Length")
+			return
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			readErr <- err
+			return
+		}
+		var request dapRequest
+		if err := json.Unmarshal(data, &request); err != nil {
+			readErr <- fmt.Errorf("bad DAP message: %w", err)
+			return
+		}
+		requests <- request
+	}
+}
+
+func (s *DAPServer) write(message any) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		// Every message is made of plain values, so this can't happen
+		panic(err)
+	}
+	fmt.Fprintf(s.conn, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+func (s *DAPServer) event(name string, body any) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.seq++
+	s.write(dapEvent{Seq: s.seq, Type: "event", Event: name, Body: body})
+}
+
+func (s *DAPServer) respond(request dapRequest, body any, err error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.seq++
+	response := dapResponse{Seq: s.seq, Type: "response", RequestSeq: request.Seq, Command: request.Command, Success: err == nil, Body: body}
+	if err != nil {
+		response.Message = err.Error()
+	}
+	s.write(response)
+}
+
+// handle answers a request, returning false when the editor is done.
+func (s *DAPServer) handle(request dapRequest) bool {
+	body, err := s.dispatch(request.Command, request.Arguments)
+	s.respond(request, body, err)
+
+	switch {
+	case err != nil:
+	case request.Command == "launch":
+		// Breakpoints need the symbols from launch, so configuration starts now
+		s.event("initialized", nil)
+	case request.Command == "disconnect":
+		return false
+	}
+	return true
+}
+
+func (s *DAPServer) dispatch(command string, arguments json.RawMessage) (any, error) {
+	switch command {
+	case "initialize":
+		return map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsInstructionBreakpoints":   true,
+			"supportsDisassembleRequest":       true,
+			"supportsReadMemoryRequest":        true,
+			"supportsSetVariable":              true,
+			"supportsTerminateRequest":         true,
+			"supportsEvaluateForHovers":        true,
+		}, nil
+	case "launch":
+		return nil, s.launch(arguments)
+	case "disconnect", "terminate":
+		s.quit()
+		return nil, nil
+	}
+
+	if s.chip8 == nil {
+		return nil, errors.New("no ROM has been launched")
+	}
+	chip8 := s.chip8
+	defer chip8.lockDebugger()()
+	d := chip8.debug
+
+	switch command {
+	case "setBreakpoints":
+		return s.setBreakpoints(arguments)
+	case "setInstructionBreakpoints":
+		return s.setInstructionBreakpoints(arguments)
+	case "setExceptionBreakpoints":
+		// There are no exceptions to break on
+		return nil, nil
+	case "configurationDone":
+		if s.stopOnEntry {
+			d.halt(stopEvent{reason: stopEntry})
+		} else {
+			d.resume(nil)
+		}
+		return nil, nil
+	case "threads":
+		return map[string]any{"threads": []map[string]any{{"id": 1, "name": "CHIP-8"}}}, nil
+	case "stackTrace":
+		frames := s.stackTrace()
+		return map[string]any{"stackFrames": frames, "totalFrames": len(frames)}, nil
+	case "scopes":
+		return map[string]any{"scopes": []map[string]any{
+			{"name": "Registers", "variablesReference": dapRegisters, "expensive": false},
+			{"name": "Memory", "variablesReference": dapMemory, "expensive": true},
+		}}, nil
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return nil, err
+		}
+		return map[string]any{"variables": s.variables(args.VariablesReference)}, nil
+	case "setVariable":
+		return s.setVariable(arguments)
+	case "evaluate":
+		var args struct {
+			Expression string `json:"expression"`
+		}
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return nil, err
+		}
+		expr, err := parseExpression(args.Expression)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"result": dapValue(expr(chip8)), "variablesReference": 0}, nil
+	case "readMemory":
+		return s.readMemory(arguments)
+	case "disassemble":
+		return s.disassemble(arguments)
+	case "continue":
+		d.resume(nil)
+		return map[string]any{"allThreadsContinued": true}, nil
+	case "next":
+		d.resume(chip8.stepOver())
+		return nil, nil
+	case "stepIn":
+		d.resume(stepInstruction)
+		return nil, nil
+	case "stepOut":
+		d.resume(chip8.stepOut())
+		return nil, nil
+	case "pause":
+		if !d.halted {
+			d.halt(stopEvent{reason: stopPause})
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("%s is not supported", command)
+}
+
+// launch loads the ROM from the launch configuration, and its symbol map.
+func (s *DAPServer) launch(arguments json.RawMessage) error {
+	var args struct {
+		Program     string `json:"program"`
+		Symbols     string `json:"symbols"`
+		StopOnEntry bool   `json:"stopOnEntry"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return err
+	}
+	if s.chip8 != nil {
+		return errors.New("a ROM is already running")
+	}
+	if args.Program == "" {
+		return errors.New("set the ROM to run with program in the launch configuration")
+	}
+
+	rom, err := ReadRom(args.Program, func(names []string) (int, error) {
+		return 0, fmt.Errorf("archive holds several ROMs, extract the one to debug: %s", strings.Join(names, ", "))
+	})
+	if err != nil {
+		return err
+	}
+	if args.Symbols == "" {
+		// Look for a map beside the ROM
+		mapPath := strings.TrimSuffix(args.Program, filepath.Ext(args.Program)) + ".map"
+		if _, err := os.Stat(mapPath); err == nil {
+			args.Symbols = mapPath
+		}
+	}
+	if args.Symbols != "" {
+		if s.symbols, err = LoadSymbolMap(args.Symbols); err != nil {
+			return err
+		}
+	}
+	opts, err := s.options(rom)
+	if err != nil {
+		return err
+	}
+
+	chip8 := NewCHIP8(&rom.Program, opts)
+	if s.logger != nil {
+		chip8.Logger = s.logger
+	}
+	// Held still until configuration is done
+	chip8.attachDebugger().attached = true
+	s.chip8 = chip8
+	s.stopOnEntry = args.StopOnEntry
+	s.Launched <- chip8
+	return nil
+}
+
+// quit stops the ROM, if one was launched.
+func (s *DAPServer) quit() {
+	if s.chip8 == nil {
+		return
+	}
+	defer s.chip8.lockDebugger()()
+	d := s.chip8.debug
+	d.attached = false
+	d.breakpoints = map[uint16]bool{}
+	d.quit = true
+	d.resume(nil)
+}
+
+func (s *DAPServer) setBreakpoints(arguments json.RawMessage) (any, error) {
+	var args struct {
+		Source struct {
+			Path string `json:"path"`
+		} `json:"source"`
+		Breakpoints []struct {
+			Line int `json:"line"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	breakpoints := []dapBreakpoint{}
+	var addrs []uint16
+	for _, requested := range args.Breakpoints {
+		breakpoint := dapBreakpoint{Line: requested.Line}
+		found := s.symbols.Addresses(args.Source.Path, requested.Line)
+		switch {
+		case s.symbols == nil:
+			breakpoint.Message = "No symbol map, set symbols in the launch configuration"
+		case len(found) == 0:
+			breakpoint.Message = "No code at this line"
+		default:
+			breakpoint.Verified = true
+			breakpoint.InstructionReference = dapAddress(found[0])
+			addrs = append(addrs, found[0])
+		}
+		breakpoints = append(breakpoints, breakpoint)
+	}
+	s.sourceBreakpoints[filepath.Clean(args.Source.Path)] = addrs
+	s.updateBreakpoints()
+	return map[string]any{"breakpoints": breakpoints}, nil
+}
+
+func (s *DAPServer) setInstructionBreakpoints(arguments json.RawMessage) (any, error) {
+	var args struct {
+		Breakpoints []struct {
+			InstructionReference string `json:"instructionReference"`
+			Offset               int    `json:"offset"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	breakpoints := []dapBreakpoint{}
+	s.instructionBreakpoints = nil
+	for _, requested := range args.Breakpoints {
+		addr, err := strconv.ParseUint(requested.InstructionReference, 0, 16)
+		target := int(addr) + requested.Offset
+		if err != nil || target < 0 || target >= memorySize {
+			breakpoints = append(breakpoints, dapBreakpoint{Message: "Not an address in memory"})
+			continue
+		}
+		s.instructionBreakpoints = append(s.instructionBreakpoints, uint16(target))
+		breakpoint := dapBreakpoint{Verified: true, InstructionReference: dapAddress(uint16(target))}
+		breakpoint.Line, _ = s.sourceLine(uint16(target))
+		breakpoints = append(breakpoints, breakpoint)
+	}
+	s.updateBreakpoints()
+	return map[string]any{"breakpoints": breakpoints}, nil
+}
+
+// updateBreakpoints hands every breakpoint to the debugger.
+func (s *DAPServer) updateBreakpoints() {
+	breakpoints := map[uint16]bool{}
+	for _, addrs := range s.sourceBreakpoints {
+		for _, addr := range addrs {
+			breakpoints[addr] = true
+		}
+	}
+	for _, addr := range s.instructionBreakpoints {
+		breakpoints[addr] = true
+	}
+	s.chip8.debug.breakpoints = breakpoints
+}
+
+func (s *DAPServer) sourceLine(addr uint16) (int, *dapSource) {
+	source, ok := s.symbols.Source(addr)
+	if !ok {
+		return 0, nil
+	}
+	return source.Line, &dapSource{Name: filepath.Base(source.File), Path: source.File}
+}
+
+// stackTrace lists the current instruction, then each subroutine call on the stack.
+func (s *DAPServer) stackTrace() []dapStackFrame {
+	chip8 := s.chip8
+	pcs := []uint16{chip8.pc}
+	for i := len(chip8.stack) - 1; i >= 0; i-- {
+		// The stack holds return addresses, just after each call
+		pcs = append(pcs, chip8.stack[i]-2)
+	}
+
+	var frames []dapStackFrame
+	for i, pc := range pcs {
+		frame := dapStackFrame{ID: i, Name: dapAddress(pc), InstructionPointerReference: dapAddress(pc)}
+		if label, ok := s.symbols.Label(pc); ok {
+			frame.Name = label
+		}
+		frame.Line, frame.Source = s.sourceLine(pc)
+		if frame.Source != nil {
+			frame.Column = 1
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// The registers in the variables view
+var dapRegisterNames = []string{
+	"V0", "V1", "V2", "V3", "V4", "V5", "V6", "V7",
+	"V8", "V9", "VA", "VB", "VC", "VD", "VE", "VF",
+	"I", "PC", "SP", "DT", "ST",
+}
+
+func (s *DAPServer) variables(reference int) []dapVariable {
+	chip8 := s.chip8
+	variables := []dapVariable{}
+	switch reference {
+	case dapRegisters:
+		for _, name := range dapRegisterNames {
+			variable := dapVariable{Name: name, Value: dapValue(s.register(name))}
+			if name == "I" || name == "PC" {
+				variable.MemoryReference = dapAddress(uint16(s.register(name)))
+			}
+			variables = append(variables, variable)
+		}
+	case dapMemory:
+		for addr := 0; addr < memorySize; addr += dapMemoryRow {
+			row := chip8.memory[addr : addr+dapMemoryRow]
+			var hex, text strings.Builder
+			for _, b := range row {
+				fmt.Fprintf(&hex, "%02X ", b)
+				if b >= 0x20 && b < 0x7F {
+					text.WriteByte(b)
+				} else {
+					text.WriteByte('.')
+				}
+			}
+			variables = append(variables, dapVariable{
+				Name:            dapAddress(uint16(addr)),
+				Value:           hex.String() + " " + text.String(),
+				MemoryReference: dapAddress(uint16(addr)),
+			})
+		}
+	}
+	return variables
+}
+
+func (s *DAPServer) register(name string) int {
+	switch name {
+	case "PC":
+		return int(s.chip8.pc)
+	case "SP":
+		return len(s.chip8.stack)
+	}
+	return int(s.chip8.registerState().get(name))
+}
+
+func (s *DAPServer) setVariable(arguments json.RawMessage) (any, error) {
+	var args struct {
+		VariablesReference int    `json:"variablesReference"`
+		Name               string `json:"name"`
+		Value              string `json:"value"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	if args.VariablesReference != dapRegisters || !slices.Contains(dapRegisterNames, args.Name) {
+		return nil, errors.New("only registers can be changed")
+	}
+	// Values can be expressions, like V3 + 1
+	expr, err := parseExpression(args.Value)
+	if err != nil {
+		return nil, err
+	}
+	value := expr(s.chip8)
+
+	chip8 := s.chip8
+	switch args.Name {
+	case "SP":
+		return nil, errors.New("SP is the depth of the stack, so it can't be changed")
+	case "I", "PC":
+		if value < 0 || value >= memorySize {
+			return nil, fmt.Errorf("%s must be an address in memory, got %d", args.Name, value)
+		}
+		if args.Name == "I" {
+			chip8.I = uint16(value)
+		} else {
+			chip8.pc = uint16(value)
+		}
+	default:
+		if value < 0 || value > 0xFF {
+			return nil, fmt.Errorf("%s holds a byte, got %d", args.Name, value)
+		}
+		switch args.Name {
+		case "DT":
+			chip8.delayTimer = byte(value)
+		case "ST":
+			chip8.soundTimer = byte(value)
+		default:
+			chip8.V[slices.Index(dapRegisterNames, args.Name)] = byte(value)
+		}
+	}
+	chip8.tamper()
+	return map[string]any{"value": dapValue(value)}, nil
+}
+
+func (s *DAPServer) readMemory(arguments json.RawMessage) (any, error) {
+	var args struct {
+		MemoryReference string `json:"memoryReference"`
+		Offset          int    `json:"offset"`
+		Count           int    `json:"count"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	base, err := strconv.ParseUint(args.MemoryReference, 0, 16)
+	if err != nil {
+		return nil, fmt.Errorf("bad memory reference %q", args.MemoryReference)
+	}
+	start := min(max(int(base)+args.Offset, 0), memorySize)
+	end := min(max(start+args.Count, start), memorySize)
+	return map[string]any{
+		"address":         dapAddress(uint16(start)),
+		"data":            base64.StdEncoding.EncodeToString(s.chip8.memory[start:end]),
+		"unreadableBytes": args.Count - (end - start),
+	}, nil
+}
+
+func (s *DAPServer) disassemble(arguments json.RawMessage) (any, error) {
+	var args struct {
+		MemoryReference   string `json:"memoryReference"`
+		Offset            int    `json:"offset"`
+		InstructionOffset int    `json:"instructionOffset"`
+		InstructionCount  int    `json:"instructionCount"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+	base, err := strconv.ParseUint(args.MemoryReference, 0, 16)
+	if err != nil {
+		return nil, fmt.Errorf("bad memory reference %q", args.MemoryReference)
+	}
+
+	instructions := []dapInstruction{}
+	start := int(base) + args.Offset + args.InstructionOffset*2
+	for i := 0; i < args.InstructionCount; i++ {
+		addr := start + i*2
+		if addr < 0 || addr+1 >= memorySize {
+			instructions = append(instructions, dapInstruction{Address: fmt.Sprintf("0x%03X", addr), Instruction: "??", PresentationHint: "invalid"})
+			continue
+		}
+		first, second := s.chip8.memory[addr], s.chip8.memory[addr+1]
+		instruction := dapInstruction{
+			Address:          dapAddress(uint16(addr)),
+			InstructionBytes: fmt.Sprintf("%02X %02X", first, second),
+			Instruction:      Instruction(uint16(first)<<8 | uint16(second)).Mnemonic(),
+		}
+		if label, ok := s.symbols.Label(uint16(addr)); ok && !strings.Contains(label, "+") {
+			instruction.Symbol = label
+		}
+		instruction.Line, instruction.Location = s.sourceLine(uint16(addr))
+		instructions = append(instructions, instruction)
+	}
+	return map[string]any{"instructions": instructions}, nil
+}
+
+func dapAddress(addr uint16) string {
+	return fmt.Sprintf("0x%03X", addr)
+}
+
+func dapValue(value int) string {
+	return fmt.Sprintf("0x%02X (%d)", value, value)
+}
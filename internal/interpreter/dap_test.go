@@ -0,0 +1,206 @@
+package interpreter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dapClient plays the editor's side of a debug session.
+type dapClient struct {
+	t      *testing.T
+	conn   net.Conn
+	r      *bufio.Reader
+	seq    int
+	events []map[string]any
+}
+
+func (c *dapClient) read() map[string]any {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	header, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("No message: %v", err)
+	}
+	length, _ := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "Content-Length:")))
+	c.r.ReadString('\n')
+	data := make([]byte, length)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		c.t.Fatal(err)
+	}
+	var message map[string]any
+	if err := json.Unmarshal(data, &message); err != nil {
+		c.t.Fatal(err)
+	}
+	return message
+}
+
+// request sends a request and returns the response body, keeping events for later.
+func (c *dapClient) request(command string, arguments any) map[string]any {
+	c.t.Helper()
+	c.seq++
+	data, _ := json.Marshal(map[string]any{"seq": c.seq, "type": "request", "command": command, "arguments": arguments})
+	fmt.Fprintf(c.conn, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	for {
+		message := c.read()
+		if message["type"] == "event" {
+			c.events = append(c.events, message)
+			continue
+		}
+		if message["request_seq"] != float64(c.seq) {
+			c.t.Fatalf("Expected a response to %s, got %v", command, message)
+		}
+		if message["success"] != true {
+			c.t.Fatalf("%s failed: %v", command, message["message"])
+		}
+		body, _ := message["body"].(map[string]any)
+		return body
+	}
+}
+
+func (c *dapClient) waitEvent(name string) map[string]any {
+	c.t.Helper()
+	for {
+		for i, event := range c.events {
+			if event["event"] == name {
+				c.events = append(c.events[:i], c.events[i+1:]...)
+				body, _ := event["body"].(map[string]any)
+				return body
+			}
+		}
+		c.events = append(c.events, c.read())
+	}
+}
+
+func (c *dapClient) expectStop(reason string, pc string) {
+	c.t.Helper()
+	if stopped := c.waitEvent("stopped"); stopped["reason"] != reason {
+		c.t.Errorf("Expected to stop for %s, got %v", reason, stopped["reason"])
+	}
+	frames := c.request("stackTrace", map[string]any{"threadId": 1})["stackFrames"].([]any)
+	if top := frames[0].(map[string]any); top["instructionPointerReference"] != pc {
+		c.t.Errorf("Expected to stop at %s, got %v", pc, top["instructionPointerReference"])
+	}
+}
+
+func (c *dapClient) evaluate(expression string) any {
+	c.t.Helper()
+	return c.request("evaluate", map[string]any{"expression": expression})["result"]
+}
+
+func TestDAP(t *testing.T) {
+	dir := t.TempDir()
+	rom := filepath.Join(dir, "main.ch8")
+	os.WriteFile(rom, []byte{
+		0x22, 0x06, // 200: CALL 0x206
+		0x70, 0x01, // 202: ADD V0, 0x01
+		0x12, 0x04, // 204: JP 0x204
+		0x60, 0x05, // 206: LD V0, 0x05
+		0x00, 0xEE, // 208: RET
+	}, 0644)
+	os.WriteFile(filepath.Join(dir, "main.map"), []byte(`
+0x200 main
+0x200 main.8o:2
+0x202 main.8o:3
+0x204 main.8o:4
+0x206 sub
+0x206 main.8o:6
+0x208 main.8o:7
+`), 0644)
+
+	server, editor := net.Pipe()
+	defer editor.Close()
+	dap := NewDAPServer(server, func(Rom) (CHIP8Options, error) { return DefaultCHIP8Options(), nil }, nil)
+	served := make(chan error)
+	go func() { served <- dap.Serve() }()
+
+	c := &dapClient{t: t, conn: editor, r: bufio.NewReader(editor)}
+	c.request("initialize", map[string]any{"adapterID": "chip8"})
+	c.request("launch", map[string]any{"program": rom})
+	c.waitEvent("initialized")
+
+	// Run it like the window would
+	chip8 := <-dap.Launched
+	go func() {
+		for {
+			unlock := chip8.lockDebugger()
+			chip8.RunFrame()
+			finished := chip8.finished()
+			unlock()
+			if finished {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	breakpoints := c.request("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": filepath.Join(dir, "main.8o")},
+		"breakpoints": []map[string]any{{"line": 6}, {"line": 5}},
+	})["breakpoints"].([]any)
+	if breakpoints[0].(map[string]any)["verified"] != true || breakpoints[1].(map[string]any)["verified"] != false {
+		t.Errorf("Expected only line 6 to have code, got %v", breakpoints)
+	}
+	c.request("configurationDone", nil)
+	c.expectStop("breakpoint", "0x206")
+
+	frames := c.request("stackTrace", map[string]any{"threadId": 1})["stackFrames"].([]any)
+	if len(frames) != 2 {
+		t.Fatalf("Expected the subroutine and its caller, got %v", frames)
+	}
+	for i, expected := range []struct {
+		name string
+		line float64
+	}{{"sub", 6}, {"main", 2}} {
+		frame := frames[i].(map[string]any)
+		if frame["name"] != expected.name || frame["line"] != expected.line {
+			t.Errorf("Expected frame %d to be %s at line %v, got %v", i, expected.name, expected.line, frame)
+		}
+	}
+	registers := c.request("variables", map[string]any{"variablesReference": dapRegisters})["variables"].([]any)
+	if v0 := registers[0].(map[string]any); v0["name"] != "V0" || v0["value"] != "0x00 (0)" {
+		t.Errorf("Expected V0 to be 0, got %v", v0)
+	}
+
+	c.request("next", map[string]any{"threadId": 1})
+	c.expectStop("step", "0x208")
+	if v0 := c.evaluate("V0"); v0 != "0x05 (5)" {
+		t.Errorf("Expected V0 to be 5, got %v", v0)
+	}
+	c.request("stepOut", map[string]any{"threadId": 1})
+	c.expectStop("step", "0x202")
+
+	set := c.request("setVariable", map[string]any{"variablesReference": dapRegisters, "name": "V1", "value": "V0 + 1"})
+	if set["value"] != "0x06 (6)" || c.evaluate("V1") != "0x06 (6)" {
+		t.Errorf("Expected V1 to be set to 6, got %v", set["value"])
+	}
+
+	instructions := c.request("disassemble", map[string]any{"memoryReference": "0x200", "instructionCount": 3})["instructions"].([]any)
+	if first := instructions[0].(map[string]any); first["instruction"] != "CALL 0x206" || first["symbol"] != "main" || first["line"] != float64(2) {
+		t.Errorf("Expected the call in main at line 2, got %v", first)
+	}
+
+	// Breaking on an address steps over the call
+	c.request("setBreakpoints", map[string]any{"source": map[string]any{"path": filepath.Join(dir, "main.8o")}})
+	c.request("setInstructionBreakpoints", map[string]any{"breakpoints": []map[string]any{{"instructionReference": "0x204"}}})
+	c.request("continue", map[string]any{"threadId": 1})
+	c.expectStop("breakpoint", "0x204")
+
+	c.request("disconnect", nil)
+	if err := <-served; err != nil {
+		t.Error(err)
+	}
+	unlock := chip8.lockDebugger()
+	defer unlock()
+	if !chip8.finished() {
+		t.Error("Expected the ROM to stop when the editor disconnects")
+	}
+}
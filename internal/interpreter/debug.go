@@ -0,0 +1,151 @@
+package interpreter
+
+import (
+	"sync"
+)
+
+// Why the interpreter stopped for a debugger, named like the Debug Adapter Protocol does
+const (
+	stopEntry      = "entry"
+	stopStep       = "step"
+	stopBreakpoint = "breakpoint"
+	stopWatch      = "data breakpoint"
+	stopPause      = "pause"
+)
+
+// stopEvent tells an attached debugger the interpreter has stopped.
+type stopEvent struct {
+	reason string
+	// The watchpoint that stopped it, if any
+	watch *WatchHit
+}
+
+// debugger holds the execution state a remote debugger controls. The frontend
+// holds the lock while it runs the interpreter, so debuggers can safely inspect
+// and change the machine whenever they hold it.
+type debugger struct {
+	mu sync.Mutex
+
+	// A debugger is connected
+	attached bool
+	// Stopped until the debugger continues or steps
+	halted bool
+	// Halt once this is true after an instruction, to step
+	until func() bool
+	// Don't stop at the breakpoint under the PC, to continue from it
+	resuming bool
+	// Halt after the current instruction, because a watchpoint was hit
+	watchHit *WatchHit
+	// Stop the program for good
+	quit bool
+
+	breakpoints map[uint16]bool
+	// Receives an event each time the interpreter halts by itself
+	stops chan stopEvent
+}
+
+// attachDebugger prepares the interpreter to be controlled by a debugger,
+// halted until it says otherwise.
+func (chip8 *CHIP8) attachDebugger() *debugger {
+	if chip8.debug == nil {
+		chip8.debug = &debugger{
+			halted:      true,
+			breakpoints: map[uint16]bool{},
+			stops:       make(chan stopEvent, 1),
+		}
+	}
+	return chip8.debug
+}
+
+// lockDebugger stops an attached debugger touching the machine until the
+// returned function is called.
+func (chip8 *CHIP8) lockDebugger() func() {
+	if chip8.debug == nil {
+		return func() {}
+	}
+	chip8.debug.mu.Lock()
+	return chip8.debug.mu.Unlock
+}
+
+// debugHalted reports whether a debugger is holding the interpreter still.
+func (chip8 *CHIP8) debugHalted() bool {
+	return chip8.debug != nil && chip8.debug.halted
+}
+
+// halt stops the interpreter and tells the debugger why.
+func (d *debugger) halt(event stopEvent) {
+	d.halted = true
+	d.until = nil
+	select {
+	case d.stops <- event:
+	default:
+		// The debugger hasn't heard about the last stop yet, which is enough
+	}
+}
+
+// resume runs the interpreter again, until the condition is true if one is given.
+func (d *debugger) resume(until func() bool) {
+	d.halted = false
+	d.until = until
+	d.resuming = true
+	// Forget stops the debugger didn't wait for
+	select {
+	case <-d.stops:
+	default:
+	}
+}
+
+// beforeInstruction reports whether to stop before executing the instruction at pc.
+func (d *debugger) beforeInstruction(pc uint16) bool {
+	if d.halted {
+		return true
+	}
+	if d.resuming {
+		d.resuming = false
+		return false
+	}
+	if d.breakpoints[pc] {
+		d.halt(stopEvent{reason: stopBreakpoint})
+		return true
+	}
+	return false
+}
+
+// afterInstruction reports whether to stop now an instruction has executed.
+func (d *debugger) afterInstruction() bool {
+	switch {
+	case d.watchHit != nil:
+		d.halt(stopEvent{reason: stopWatch, watch: d.watchHit})
+		d.watchHit = nil
+	case d.until != nil && d.until():
+		d.halt(stopEvent{reason: stopStep})
+	}
+	return d.halted
+}
+
+// stepInstruction is a resume condition to run a single instruction.
+func stepInstruction() bool { return true }
+
+// stepOver is a resume condition to run the next instruction, or the whole
+// subroutine if it's a call.
+func (chip8 *CHIP8) stepOver() func() bool {
+	depth := len(chip8.stack)
+	next := chip8.pc + 2
+	if int(chip8.pc) >= len(chip8.memory) || chip8.memory[chip8.pc]&0xF0 != 0x20 {
+		return stepInstruction
+	}
+	return func() bool {
+		return len(chip8.stack) < depth || len(chip8.stack) == depth && chip8.pc == next
+	}
+}
+
+// stepOut is a resume condition to run until the current subroutine returns.
+func (chip8 *CHIP8) stepOut() func() bool {
+	depth := len(chip8.stack)
+	if depth == 0 {
+		return stepInstruction
+	}
+	return func() bool {
+		return len(chip8.stack) < depth
+	}
+}
@@ -0,0 +1,81 @@
+package interpreter
+
+import "fmt"
+
+// Mnemonic disassembles the instruction into the mnemonics from Cowgod's CHIP-8
+// technical reference, like "LD V3, 0x10".
+func (i Instruction) Mnemonic() string {
+	x := i.nibbles(1, 1)
+	y := i.nibbles(2, 2)
+	n := i.nibbles(3, 3)
+	nn := i.nibbles(2, 3)
+	nnn := i.nibbles(1, 3)
+
+	switch i.nibbles(0, 0) {
+	case 0x0:
+		switch i {
+		case 0x00E0:
+			return "CLS"
+		case 0x00EE:
+			return "RET"
+		}
+		return fmt.Sprintf("SYS 0x%03X", nnn)
+	case 0x1:
+		return fmt.Sprintf("JP 0x%03X", nnn)
+	case 0x2:
+		return fmt.Sprintf("CALL 0x%03X", nnn)
+	case 0x3:
+		return fmt.Sprintf("SE V%X, 0x%02X", x, nn)
+	case 0x4:
+		return fmt.Sprintf("SNE V%X, 0x%02X", x, nn)
+	case 0x5:
+		if n == 0 {
+			return fmt.Sprintf("SE V%X, V%X", x, y)
+		}
+	case 0x6:
+		return fmt.Sprintf("LD V%X, 0x%02X", x, nn)
+	case 0x7:
+		return fmt.Sprintf("ADD V%X, 0x%02X", x, nn)
+	case 0x8:
+		names := map[uint16]string{0x0: "LD", 0x1: "OR", 0x2: "AND", 0x3: "XOR", 0x4: "ADD", 0x5: "SUB", 0x6: "SHR", 0x7: "SUBN", 0xE: "SHL"}
+		if name, ok := names[n]; ok {
+			return fmt.Sprintf("%s V%X, V%X", name, x, y)
+		}
+	case 0x9:
+		if n == 0 {
+			return fmt.Sprintf("SNE V%X, V%X", x, y)
+		}
+	case 0xA:
+		return fmt.Sprintf("LD I, 0x%03X", nnn)
+	case 0xB:
+		return fmt.Sprintf("JP V0, 0x%03X", nnn)
+	case 0xC:
+		return fmt.Sprintf("RND V%X, 0x%02X", x, nn)
+	case 0xD:
+		return fmt.Sprintf("DRW V%X, V%X, %d", x, y, n)
+	case 0xE:
+		switch nn {
+		case 0x9E:
+			return fmt.Sprintf("SKP V%X", x)
+		case 0xA1:
+			return fmt.Sprintf("SKNP V%X", x)
+		}
+	case 0xF:
+		formats := map[uint16]string{
+			0x07: "LD V%X, DT",
+			0x0A: "LD V%X, K",
+			0x15: "LD DT, V%X",
+			0x18: "LD ST, V%X",
+			0x1E: "ADD I, V%X",
+			0x29: "LD F, V%X",
+			0x33: "LD B, V%X",
+			0x55: "LD [I], V%X",
+			0x65: "LD V%X, [I]",
+		}
+		if format, ok := formats[nn]; ok {
+			return fmt.Sprintf(format, x)
+		}
+	}
+	// Not an instruction, so probably data
+	return fmt.Sprintf("DW 0x%04X", uint16(i))
+}
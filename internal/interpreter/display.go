@@ -1,17 +1,212 @@
 package interpreter
 
-import "image/color"
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
 
 type Display struct {
-	content  [DisplayWidth][DisplayHeight]byte
-	offColor color.Color
-	onColor  color.Color
+	content *Framebuffer
+	palette Palette
+	// Set whenever content changes, so frontends can skip redundant repaints
+	dirty bool
+
+	// Recently presented frames, for blending away flicker
+	history     []*Framebuffer
+	historyNext int
+	// The last frame handed to a frontend, as row-major pixel intensities
+	presented []byte
+	// RGBA pixels for every intensity, in the palette colors
+	shades *[256][4]byte
+}
+
+func newDisplay(palette Palette) Display {
+	return Display{
+		content: NewFramebuffer(DisplayWidth, DisplayHeight, 1),
+		palette: palette,
+		dirty:   true,
+	}
+}
+
+// Frame blending modes
+const (
+	BlendOff     = "off"
+	BlendOr      = "or"
+	BlendAverage = "average"
+)
+
+type FrameBlendOptions struct {
+	// How to combine recent frames: off, or, average
+	Mode string `mapstructure:"mode"`
+	// How many recent frames to combine
+	Frames int `mapstructure:"frames"`
+}
+
+// Validate checks the blend mode is known and there are frames to blend.
+func (opts FrameBlendOptions) Validate() error {
+	switch opts.Mode {
+	case BlendOff, BlendOr, BlendAverage:
+	default:
+		return fmt.Errorf("unknown frame blend mode %q, expected %s, %s or %s", opts.Mode, BlendOff, BlendOr, BlendAverage)
+	}
+	if opts.Mode != BlendOff && opts.Frames < 2 {
+		return fmt.Errorf("frame blending needs at least 2 frames, got %d", opts.Frames)
+	}
+	return nil
+}
+
+func (opts FrameBlendOptions) enabled() bool {
+	return opts.Mode != BlendOff && opts.Mode != "" && opts.Frames > 1
+}
+
+// levels is how many distinct intensities a presented frame can have.
+func (opts FrameBlendOptions) levels() int {
+	if opts.enabled() && opts.Mode == BlendAverage {
+		return opts.Frames + 1
+	}
+	return 2
 }
 
 func (d *Display) clear() {
-	for x := 0; x < DisplayWidth; x++ {
-		for y := 0; y < DisplayHeight; y++ {
-			d.content[x][y] = 0
+	d.content.Clear()
+	d.dirty = true
+}
+
+func (d *Display) width() int  { return d.content.Width() }
+func (d *Display) height() int { return d.content.Height() }
+
+// recordFrame keeps the current content as the latest frame to blend. It's called
+// once per emulated frame, so frames blend for the same time however often the
+// frontend draws and however fast the program runs.
+func (d *Display) recordFrame(blend FrameBlendOptions) {
+	if !blend.enabled() {
+		d.history = nil
+		return
+	}
+	if len(d.history) != blend.Frames {
+		d.history = make([]*Framebuffer, blend.Frames)
+		for i := range d.history {
+			d.history[i] = NewFramebuffer(d.width(), d.height(), d.content.Planes())
+		}
+		d.historyNext = 0
+	}
+	d.history[d.historyNext].CopyFrom(d.content)
+	d.historyNext = (d.historyNext + 1) % len(d.history)
+}
+
+// present returns the frame a frontend should show right now, as row-major pixel
+// intensities from 0 (off) to 255 (on).
+//
+// Games erase and redraw sprites, so any one frame may catch a sprite missing.
+// Blending recent frames together keeps it on screen.
+func (d *Display) present(blend FrameBlendOptions) []byte {
+	width, height := d.width(), d.height()
+	if len(d.presented) != width*height {
+		d.presented = make([]byte, width*height)
+	}
+
+	if !blend.enabled() {
+		d.history = nil
+		d.content.Expand(0, d.presented)
+		return d.presented
+	}
+	if len(d.history) != blend.Frames {
+		// Nothing has run since blending was turned on
+		d.recordFrame(blend)
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			lit := 0
+			for _, frame := range d.history {
+				if frame.Pixel(0, x, y) {
+					lit++
+				}
+			}
+			switch {
+			case blend.Mode == BlendAverage:
+				d.presented[y*width+x] = byte(lit * 0xFF / len(d.history))
+			case lit > 0:
+				d.presented[y*width+x] = 0xFF
+			default:
+				d.presented[y*width+x] = 0
+			}
+		}
+	}
+	return d.presented
+}
+
+// rgba converts presented intensities to RGBA pixels in the palette colors, ready to
+// upload to a texture.
+func (d *Display) rgba(frame []byte, pixels []byte) {
+	if d.shades == nil {
+		// Converting palette colors is slow, so do it once
+		d.shades = new([256][4]byte)
+		for i := range d.shades {
+			c := d.shade(byte(i))
+			d.shades[i] = [4]byte{c.R, c.G, c.B, c.A}
+		}
+	}
+	for i, intensity := range frame {
+		copy(pixels[i*4:i*4+4], d.shades[intensity][:])
+	}
+}
+
+// shade mixes the off and on colors by a pixel intensity.
+func (d *Display) shade(intensity byte) color.RGBA {
+	switch intensity {
+	case 0:
+		return toRGBA(d.palette[0])
+	case 0xFF:
+		return toRGBA(d.palette[1])
+	}
+	return blendColors(d.palette[0], d.palette[1], intensity)
+}
+
+// blendColors mixes two colors, reading them without the terminal's color profile.
+func blendColors(from, to color.Color, amount byte) color.RGBA {
+	r1, g1, b1, _ := toRGBA(from).RGBA()
+	r2, g2, b2, _ := toRGBA(to).RGBA()
+	mix := func(a, b uint32) uint8 {
+		return uint8((a*uint32(0xFF-amount) + b*uint32(amount)) / 0xFF >> 8)
+	}
+	return color.RGBA{mix(r1, r2), mix(g1, g2), mix(b1, b2), 0xFF}
+}
+
+// image renders the next presented frame as a paletted image, with each CHIP-8 pixel
+// blown up to a scale x scale square. Index 0 is the off color and the last index is
+// the on color, with blended shades in between.
+func (d *Display) image(scale int, blend FrameBlendOptions) *image.Paletted {
+	if scale < 1 {
+		scale = 1
+	}
+	return d.render(d.present(blend), scale, blend.levels())
+}
+
+// screenshot renders the display as it is, without touching the frames kept for
+// blending.
+func (d *Display) screenshot(scale int) *image.Paletted {
+	frame := make([]byte, d.width()*d.height())
+	d.content.Expand(0, frame)
+	return d.render(frame, max(scale, 1), 2)
+}
+
+// render draws intensities in levels shades, scale x scale pixels each.
+func (d *Display) render(frame []byte, scale int, levels int) *image.Paletted {
+	palette := make(color.Palette, levels)
+	for i := range palette {
+		palette[i] = d.shade(byte(i * 0xFF / (levels - 1)))
+	}
+
+	width := d.width()
+	img := image.NewPaletted(image.Rect(0, 0, width*scale, d.height()*scale), palette)
+	for y := 0; y < d.height()*scale; y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+width*scale]
+		for x := range row {
+			intensity := int(frame[(y/scale)*width+x/scale])
+			row[x] = uint8((intensity*(levels-1) + 0x7F) / 0xFF)
 		}
 	}
+	return img
 }
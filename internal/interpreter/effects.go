@@ -0,0 +1,137 @@
+package interpreter
+
+import (
+	_ "embed"
+	"fmt"
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+//go:embed crt.kage
+var crtShaderSource []byte
+
+//go:embed phosphor.kage
+var phosphorShaderSource []byte
+
+type EffectOptions struct {
+	// Turn post-processing on. Can be toggled at runtime.
+	Enabled bool `mapstructure:"enabled"`
+	// Strength of each effect, from 0 (off) to 1
+	Scanlines float64 `mapstructure:"scanlines"`
+	Curvature float64 `mapstructure:"curvature"`
+	Bloom     float64 `mapstructure:"bloom"`
+	// How much of the previous frame lingers, from 0 (off) to 1.
+	// Hides the flicker of sprites being erased and redrawn.
+	Persistence float64 `mapstructure:"persistence"`
+}
+
+func DefaultEffectOptions() EffectOptions {
+	return EffectOptions{
+		Enabled:     false,
+		Scanlines:   0.5,
+		Curvature:   0.1,
+		Bloom:       0.4,
+		Persistence: 0.6,
+	}
+}
+
+// Validate checks every effect strength is within range.
+func (opts EffectOptions) Validate() error {
+	strengths := map[string]float64{
+		"scanlines":   opts.Scanlines,
+		"curvature":   opts.Curvature,
+		"bloom":       opts.Bloom,
+		"persistence": opts.Persistence,
+	}
+	for name, strength := range strengths {
+		if strength < 0 || strength > 1 {
+			return fmt.Errorf("effects.%s must be between 0 and 1, got %v", name, strength)
+		}
+	}
+	return nil
+}
+
+// effects holds the GPU resources for post-processing the windowed display.
+type effects struct {
+	crt      *ebiten.Shader
+	phosphor *ebiten.Shader
+
+	// Raw pixels of the display, one texel per CHIP-8 pixel
+	mask   *ebiten.Image
+	pixels []byte
+	// The phosphor glow is ping-ponged between two buffers
+	glow    [2]*ebiten.Image
+	current int
+	// The glow, blown up to the screen size
+	scaled *ebiten.Image
+}
+
+func newEffects() (*effects, error) {
+	crt, err := ebiten.NewShader(crtShaderSource)
+	if err != nil {
+		return nil, err
+	}
+	phosphor, err := ebiten.NewShader(phosphorShaderSource)
+	if err != nil {
+		return nil, err
+	}
+	return &effects{crt: crt, phosphor: phosphor}, nil
+}
+
+// draw paints a presented frame onto the screen through the phosphor and CRT shaders,
+// scaled up with its top left corner at x, y.
+func (e *effects) draw(screen *ebiten.Image, frame []byte, width, height int, palette Palette, opts EffectOptions, scale, x, y float64) {
+	if e.mask == nil || e.mask.Bounds().Dx() != width || e.mask.Bounds().Dy() != height {
+		e.mask = ebiten.NewImage(width, height)
+		e.pixels = make([]byte, width*height*4)
+		e.glow = [2]*ebiten.Image{ebiten.NewImage(width, height), ebiten.NewImage(width, height)}
+	}
+
+	// Upload the frame as a grayscale mask
+	for i, value := range frame {
+		e.pixels[i*4], e.pixels[i*4+1], e.pixels[i*4+2], e.pixels[i*4+3] = value, value, value, 0xFF
+	}
+	e.mask.WritePixels(e.pixels)
+
+	// Blend in what's left of the previous frame
+	previous := e.glow[e.current]
+	e.current = 1 - e.current
+	e.glow[e.current].DrawRectShader(width, height, e.phosphor, &ebiten.DrawRectShaderOptions{
+		Images:   [4]*ebiten.Image{e.mask, previous},
+		Uniforms: map[string]any{"Persistence": float32(opts.Persistence)},
+	})
+
+	width, height = int(math.Ceil(float64(width)*scale)), int(math.Ceil(float64(height)*scale))
+	if e.scaled == nil || e.scaled.Bounds().Dx() != width || e.scaled.Bounds().Dy() != height {
+		if e.scaled != nil {
+			e.scaled.Dispose()
+		}
+		e.scaled = ebiten.NewImage(width, height)
+	}
+	geoM := ebiten.GeoM{}
+	geoM.Scale(scale, scale)
+	e.scaled.DrawImage(e.glow[e.current], &ebiten.DrawImageOptions{GeoM: geoM})
+
+	geoM.Reset()
+	geoM.Translate(x, y)
+	screen.DrawRectShader(width, height, e.crt, &ebiten.DrawRectShaderOptions{
+		GeoM:   geoM,
+		Images: [4]*ebiten.Image{e.scaled},
+		Uniforms: map[string]any{
+			"OffColor":  colorUniform(palette[0]),
+			"OnColor":   colorUniform(palette[1]),
+			"Scanlines": float32(opts.Scanlines),
+			"Curvature": float32(opts.Curvature),
+			"Bloom":     float32(opts.Bloom),
+			"Scale":     float32(scale),
+		},
+	})
+}
+
+// colorUniform converts a color to the vec4 a shader expects.
+func colorUniform(c color.Color) []float32 {
+	rgba := toRGBA(c)
+	return []float32{float32(rgba.R) / 0xFF, float32(rgba.G) / 0xFF, float32(rgba.B) / 0xFF, float32(rgba.A) / 0xFF}
+}
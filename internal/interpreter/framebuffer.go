@@ -0,0 +1,102 @@
+package interpreter
+
+// Framebuffer is a packed bitmap, stored row by row with one bit per pixel.
+// Each plane is a separate bitmap, so variants drawing in several colors
+// (XO-CHIP) or at a higher resolution (SUPER-CHIP's 128x64) fit the same layout.
+type Framebuffer struct {
+	width  int
+	height int
+	// How many words make up one row
+	stride int
+	planes [][]uint64
+}
+
+const wordBits = 64
+
+func NewFramebuffer(width, height, planes int) *Framebuffer {
+	fb := &Framebuffer{
+		width:  width,
+		height: height,
+		stride: (width + wordBits - 1) / wordBits,
+		planes: make([][]uint64, planes),
+	}
+	for i := range fb.planes {
+		fb.planes[i] = make([]uint64, fb.stride*height)
+	}
+	return fb
+}
+
+func (fb *Framebuffer) Width() int  { return fb.width }
+func (fb *Framebuffer) Height() int { return fb.height }
+func (fb *Framebuffer) Planes() int { return len(fb.planes) }
+
+// Pixel reports whether a pixel is lit in the plane.
+func (fb *Framebuffer) Pixel(plane, x, y int) bool {
+	word := fb.planes[plane][y*fb.stride+x/wordBits]
+	return word>>(wordBits-1-x%wordBits)&1 != 0
+}
+
+// XORByte flips the 8 pixels starting at x, y wherever line has a set bit, with the
+// most significant bit leftmost. Pixels past the edges are clipped. Reports whether
+// any lit pixel was turned off.
+func (fb *Framebuffer) XORByte(plane, x, y int, line byte) bool {
+	if x < 0 || y < 0 || x >= fb.width || y >= fb.height {
+		return false
+	}
+	if overflow := x + 8 - fb.width; overflow > 0 {
+		line &= 0xFF << overflow
+	}
+
+	row := fb.planes[plane][y*fb.stride : (y+1)*fb.stride]
+	word, bit := x/wordBits, x%wordBits
+	bits := uint64(line) << (wordBits - 8) >> bit
+	collision := row[word]&bits != 0
+	row[word] ^= bits
+
+	// The line straddles two words
+	if bit > wordBits-8 && word+1 < fb.stride {
+		spill := uint64(line) << (2*wordBits - 8 - bit)
+		collision = collision || row[word+1]&spill != 0
+		row[word+1] ^= spill
+	}
+	return collision
+}
+
+// Expand unpacks a plane into one byte per pixel, 0xFF for lit pixels and 0 otherwise.
+func (fb *Framebuffer) Expand(plane int, pixels []byte) {
+	for y := 0; y < fb.height; y++ {
+		row := fb.planes[plane][y*fb.stride : (y+1)*fb.stride]
+		out := pixels[y*fb.width : (y+1)*fb.width]
+		for x := range out {
+			// Arithmetic shift smears the pixel's bit into a full byte
+			out[x] = byte(int64(row[x/wordBits]<<(x%wordBits)) >> (wordBits - 1))
+		}
+	}
+}
+
+// Pack is the inverse of Expand, lighting the pixels that aren't 0.
+func (fb *Framebuffer) Pack(plane int, pixels []byte) {
+	for y := 0; y < fb.height; y++ {
+		row := fb.planes[plane][y*fb.stride : (y+1)*fb.stride]
+		clear(row)
+		for x, pixel := range pixels[y*fb.width : (y+1)*fb.width] {
+			if pixel != 0 {
+				row[x/wordBits] |= 1 << (wordBits - 1 - x%wordBits)
+			}
+		}
+	}
+}
+
+// Clear turns off every pixel in every plane.
+func (fb *Framebuffer) Clear() {
+	for _, plane := range fb.planes {
+		clear(plane)
+	}
+}
+
+// CopyFrom overwrites the framebuffer with another of the same size.
+func (fb *Framebuffer) CopyFrom(other *Framebuffer) {
+	for i := range fb.planes {
+		copy(fb.planes[i], other.planes[i])
+	}
+}
@@ -0,0 +1,144 @@
+package interpreter
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFramebufferXORByte(t *testing.T) {
+	tests := []struct {
+		width     int
+		x         int
+		line      byte
+		lit       []int
+		collision bool
+	}{
+		{64, 0, 0b10000001, []int{0, 7}, false},
+		{64, 60, 0b11111111, []int{60, 61, 62, 63}, false},
+		{128, 60, 0b10011001, []int{60, 63, 64, 67}, false},
+		{128, 120, 0b00000001, []int{127}, false},
+		{64, 64, 0b11111111, nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%d wide, x=%d, line=%08b", test.width, test.x, test.line), func(t *testing.T) {
+			fb := NewFramebuffer(test.width, 4, 1)
+			if collision := fb.XORByte(0, test.x, 2, test.line); collision != test.collision {
+				t.Errorf("Expected collision %v, Got: %v", test.collision, collision)
+			}
+			var lit []int
+			for y := 0; y < fb.Height(); y++ {
+				for x := 0; x < fb.Width(); x++ {
+					if fb.Pixel(0, x, y) {
+						if y != 2 {
+							t.Errorf("Unexpected pixel lit at (%d, %d)", x, y)
+						}
+						lit = append(lit, x)
+					}
+				}
+			}
+			if fmt.Sprint(lit) != fmt.Sprint(test.lit) {
+				t.Errorf("Expected: %v lit, Got: %v", test.lit, lit)
+			}
+
+			// Drawing the same line again erases it
+			if fb.XORByte(0, test.x, 2, test.line) != (len(test.lit) > 0) {
+				t.Errorf("Expected collision when erasing")
+			}
+			for _, x := range test.lit {
+				if fb.Pixel(0, x, 2) {
+					t.Errorf("Expected pixel %d to be erased", x)
+				}
+			}
+		})
+	}
+}
+
+// A 15 line sprite, drawn across the screen like a busy game would each frame
+var benchmarkSprite = [15]byte{0x3C, 0x42, 0x81, 0xA5, 0x81, 0x99, 0x42, 0x3C, 0xFF, 0x00, 0xFF, 0x18, 0x24, 0x42, 0x81}
+
+func BenchmarkDrawSprite(b *testing.B) {
+	b.Run("packed", func(b *testing.B) {
+		fb := NewFramebuffer(DisplayWidth, DisplayHeight, 1)
+		for i := 0; i < b.N; i++ {
+			for x := 0; x < DisplayWidth; x += 5 {
+				for y, line := range benchmarkSprite {
+					fb.XORByte(0, x, (x+y)%DisplayHeight, line)
+				}
+			}
+		}
+	})
+
+	// The column-major byte grid the display used to be, for comparison
+	b.Run("byte grid", func(b *testing.B) {
+		var grid [DisplayWidth][DisplayHeight]byte
+		for i := 0; i < b.N; i++ {
+			for drawX := 0; drawX < DisplayWidth; drawX += 5 {
+				for y, line := range benchmarkSprite {
+					yLoc := (drawX + y) % DisplayHeight
+					for x := 0; x < 8 && drawX+x < DisplayWidth; x++ {
+						if (line>>(7-x))&1 != 0 {
+							grid[drawX+x][yLoc] ^= 1
+						}
+					}
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkPresent(b *testing.B) {
+	display := newDisplay(Palettes[DefaultPalette])
+	for x := 0; x < DisplayWidth; x += 3 {
+		display.content.XORByte(0, x, x%DisplayHeight, 0xA5)
+	}
+	pixels := make([]byte, DisplayWidth*DisplayHeight*4)
+
+	for _, blend := range []FrameBlendOptions{{Mode: BlendOff}, {Mode: BlendOr, Frames: 3}, {Mode: BlendAverage, Frames: 3}} {
+		b.Run(blend.Mode, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				display.recordFrame(blend)
+				display.rgba(display.present(blend), pixels)
+			}
+		})
+	}
+}
+
+func TestFrameBlend(t *testing.T) {
+	tests := []struct {
+		blend FrameBlendOptions
+		want  []byte
+	}{
+		{FrameBlendOptions{Mode: BlendOr, Frames: 3}, []byte{0xFF, 0xFF, 0xFF, 0}},
+		{FrameBlendOptions{Mode: BlendAverage, Frames: 3}, []byte{0xFF, 0xAA, 0x55, 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.blend.Mode, func(t *testing.T) {
+			display := newDisplay(Palettes[DefaultPalette])
+			display.content.XORByte(0, 0, 0, 0x80)
+			for i := 0; i < test.blend.Frames; i++ {
+				display.recordFrame(test.blend)
+			}
+
+			// Drawing more often than frames run doesn't age them out
+			for i, want := range test.want {
+				for draw := 0; draw < 3; draw++ {
+					if got := display.present(test.blend)[0]; got != want {
+						t.Fatalf("Expected %#x %d frames after the pixel went out, got %#x", want, i, got)
+					}
+				}
+				display.content.Clear()
+				display.recordFrame(test.blend)
+			}
+		})
+	}
+}
+
+func TestFrameBlendValidate(t *testing.T) {
+	if err := (FrameBlendOptions{Mode: BlendOr, Frames: 1}).Validate(); err == nil {
+		t.Error("Expected blending 1 frame to be rejected")
+	}
+	if err := (FrameBlendOptions{Mode: BlendOff, Frames: 1}).Validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,502 @@
+package interpreter
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// The registers GDB sees, in order, with their sizes in bytes. Values are
+// big-endian, like CHIP-8.
+var gdbRegisters = []struct {
+	name string
+	size int
+}{
+	{"v0", 1}, {"v1", 1}, {"v2", 1}, {"v3", 1}, {"v4", 1}, {"v5", 1}, {"v6", 1}, {"v7", 1},
+	{"v8", 1}, {"v9", 1}, {"va", 1}, {"vb", 1}, {"vc", 1}, {"vd", 1}, {"ve", 1}, {"vf", 1},
+	{"i", 2}, {"pc", 2}, {"sp", 1}, {"dt", 1}, {"st", 1},
+}
+
+// The deepest GDB can make the stack by setting sp, as in most interpreters
+const gdbStackDepth = 16
+
+// gdbTargetDescription tells GDB what the registers are called.
+func gdbTargetDescription() string {
+	var xml strings.Builder
+	xml.WriteString(`<?xml version="1.0"?><!DOCTYPE target SYSTEM "gdb-target.dtd"><target version="1.0"><feature name="org.chip8.core">`)
+	for _, reg := range gdbRegisters {
+		kind := "uint8"
+		switch reg.name {
+		case "i":
+			kind = "data_ptr"
+		case "pc":
+			kind = "code_ptr"
+		}
+		fmt.Fprintf(&xml, `<reg name="%s" bitsize="%d" type="%s"/>`, reg.name, reg.size*8, kind)
+	}
+	xml.WriteString(`</feature></target>`)
+	return xml.String()
+}
+
+// ServeGDB listens for a GDB remote serial protocol debugger on the address,
+// like ":1234". The interpreter is halted until a debugger connects and lets it
+// continue, and while one is attached it only runs when told to.
+func ServeGDB(chip8 *CHIP8, address string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	unlock := chip8.lockDebugger()
+	chip8.attachDebugger()
+	chip8.notify("Waiting for GDB on %s", listener.Addr())
+	unlock()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// One debugger at a time
+			session := &gdbSession{chip8: chip8, conn: conn}
+			session.serve()
+		}
+	}()
+	return listener, nil
+}
+
+type gdbSession struct {
+	chip8 *CHIP8
+	conn  net.Conn
+	// Guards writes, since acks go out as packets are read
+	writeMu sync.Mutex
+	// Set while serving, read while reading packets
+	noAck atomic.Bool
+	// The interpreter was told to continue or step, and GDB waits to hear why it stopped
+	running bool
+	// Watchpoints GDB set, to remove when it detaches
+	watchpoints []*Watchpoint
+}
+
+func (s *gdbSession) serve() {
+	defer s.conn.Close()
+	chip8 := s.chip8
+	chip8.Logger.Info("GDB attached", "remote", s.conn.RemoteAddr())
+	unlock := chip8.lockDebugger()
+	d := chip8.attachDebugger()
+	d.attached = true
+	d.halted = true
+	unlock()
+	chip8.notify("GDB attached")
+
+	packets := make(chan string)
+	go s.readPackets(packets)
+
+	for {
+		select {
+		case packet, ok := <-packets:
+			if !ok {
+				s.detach()
+				return
+			}
+			if !s.handle(packet) {
+				s.detach()
+				return
+			}
+		case event := <-d.stops:
+			if s.running {
+				s.running = false
+				s.send(gdbStopReply(event))
+			}
+		}
+	}
+}
+
+// detach forgets breakpoints and lets the program run freely.
+func (s *gdbSession) detach() {
+	defer s.chip8.lockDebugger()()
+	d := s.chip8.debug
+	d.attached = false
+	d.breakpoints = map[uint16]bool{}
+	for len(s.watchpoints) > 0 {
+		s.removeWatchpoint(s.watchpoints[0].Spec)
+	}
+	d.resume(nil)
+	s.chip8.Logger.Info("GDB detached")
+	s.chip8.notify("GDB detached")
+}
+
+// readPackets delivers packet contents, and "\x03" for interrupts, until the
+// connection closes.
+func (s *gdbSession) readPackets(packets chan<- string) {
+	defer close(packets)
+	r := bufio.NewReader(s.conn)
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		switch c {
+		case 0x03:
+			packets <- "\x03"
+		case '$':
+			data, err := r.ReadString('#')
+			if err != nil {
+				return
+			}
+			data = strings.TrimSuffix(data, "#")
+			checksum := make([]byte, 2)
+			if _, err := io.ReadFull(r, checksum); err != nil {
+				return
+			}
+			if sum, err := strconv.ParseUint(string(checksum), 16, 8); s.noAck.Load() || (err == nil && byte(sum) == gdbChecksum(data)) {
+				s.write("+")
+				packets <- data
+			} else {
+				s.write("-")
+			}
+		}
+		// Acks from GDB need no reply
+	}
+}
+
+func gdbChecksum(data string) byte {
+	var sum byte
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+func (s *gdbSession) write(data string) {
+	if s.noAck.Load() && (data == "+" || data == "-") {
+		return
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.conn.Write([]byte(data))
+}
+
+func (s *gdbSession) send(packet string) {
+	s.write(fmt.Sprintf("$%s#%02x", packet, gdbChecksum(packet)))
+}
+
+// Signal numbers GDB expects in stop replies
+const (
+	gdbSignalInterrupt = 2
+	gdbSignalTrap      = 5
+)
+
+func gdbStopReply(event stopEvent) string {
+	signal := gdbSignalTrap
+	if event.reason == stopPause {
+		signal = gdbSignalInterrupt
+	}
+	if event.watch != nil {
+		kind := "watch"
+		switch event.watch.Watchpoint.kind {
+		case watchRead:
+			kind = "rwatch"
+		case watchAccess:
+			kind = "awatch"
+		}
+		return fmt.Sprintf("T%02x%s:%x;", signal, kind, event.watch.Watchpoint.start)
+	}
+	return fmt.Sprintf("S%02x", signal)
+}
+
+// handle answers a packet, returning false when the debugger is done.
+func (s *gdbSession) handle(packet string) bool {
+	chip8 := s.chip8
+	defer chip8.lockDebugger()()
+	d := chip8.debug
+
+	if packet == "\x03" {
+		if s.running && !d.halted {
+			d.halt(stopEvent{reason: stopPause})
+		}
+		return true
+	}
+	if s.running {
+		// Nothing else makes sense until the interpreter stops
+		return true
+	}
+
+	if packet == "" {
+		s.send("")
+		return true
+	}
+	command, args := packet[:1], packet[1:]
+	switch {
+	case packet == "?":
+		s.send(fmt.Sprintf("S%02x", gdbSignalTrap))
+	case command == "g":
+		s.send(hex.EncodeToString(s.registers()))
+	case command == "G":
+		data, err := hex.DecodeString(args)
+		if err != nil || len(data) != len(s.registers()) {
+			s.send("E01")
+			break
+		}
+		// Check every register before changing any, so a bad one changes nothing
+		values := make([][]byte, len(gdbRegisters))
+		offset := 0
+		for n, reg := range gdbRegisters {
+			values[n] = data[offset : offset+reg.size]
+			offset += reg.size
+			if err = checkRegister(n, values[n]); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			s.send("E01")
+			break
+		}
+		for n, value := range values {
+			s.setRegister(n, value)
+		}
+		s.send("OK")
+	case command == "p":
+		n, err := strconv.ParseUint(args, 16, 8)
+		if err != nil || int(n) >= len(gdbRegisters) {
+			s.send("E01")
+			break
+		}
+		s.send(hex.EncodeToString(s.register(int(n))))
+	case command == "P":
+		number, value, _ := strings.Cut(args, "=")
+		n, err := strconv.ParseUint(number, 16, 8)
+		data, hexErr := hex.DecodeString(value)
+		if err != nil || hexErr != nil || int(n) >= len(gdbRegisters) || len(data) != gdbRegisters[n].size {
+			s.send("E01")
+			break
+		}
+		if err := checkRegister(int(n), data); err != nil {
+			s.send("E01")
+			break
+		}
+		s.setRegister(int(n), data)
+		s.send("OK")
+	case command == "m":
+		addr, length, ok := gdbRange(args)
+		if !ok {
+			s.send("E01")
+			break
+		}
+		s.send(hex.EncodeToString(chip8.memory[addr : addr+length]))
+	case command == "M":
+		where, value, _ := strings.Cut(args, ":")
+		addr, length, ok := gdbRange(where)
+		data, err := hex.DecodeString(value)
+		if !ok || err != nil || len(data) != length {
+			s.send("E01")
+			break
+		}
+		copy(chip8.memory[addr:], data)
+		chip8.tamper()
+		s.send("OK")
+	case command == "c" || command == "s":
+		if args != "" {
+			addr, err := strconv.ParseUint(args, 16, 16)
+			if err != nil || addr >= memorySize {
+				s.send("E01")
+				break
+			}
+			chip8.pc = uint16(addr)
+			chip8.tamper()
+		}
+		s.running = true
+		if command == "s" {
+			d.resume(stepInstruction)
+		} else {
+			d.resume(nil)
+		}
+	case command == "Z" || command == "z":
+		s.setBreakpoint(command == "Z", args)
+	case command == "D":
+		s.send("OK")
+		return false
+	case command == "k":
+		return false
+	case packet == "qSupported" || strings.HasPrefix(packet, "qSupported:"):
+		s.send("PacketSize=1000;qXfer:features:read+;QStartNoAckMode+")
+	case packet == "QStartNoAckMode":
+		// Before replying, so the next packet isn't acked
+		s.noAck.Store(true)
+		s.send("OK")
+	case strings.HasPrefix(packet, "qXfer:features:read:target.xml:"):
+		s.send(gdbXfer(gdbTargetDescription(), strings.TrimPrefix(packet, "qXfer:features:read:target.xml:")))
+	case packet == "qAttached":
+		s.send("1")
+	case packet == "qfThreadInfo":
+		s.send("m1")
+	case packet == "qsThreadInfo":
+		s.send("l")
+	case packet == "qC":
+		s.send("QC1")
+	case command == "H" || command == "T":
+		// There's only one thread
+		s.send("OK")
+	default:
+		// Unsupported, GDB will cope
+		s.send("")
+	}
+	return true
+}
+
+// gdbRange parses "addr,length" in hex, checking it's inside memory.
+func gdbRange(args string) (int, int, bool) {
+	a, l, _ := strings.Cut(args, ",")
+	addr, err := strconv.ParseUint(a, 16, 16)
+	length, lengthErr := strconv.ParseUint(l, 16, 16)
+	if err != nil || lengthErr != nil || addr+length > memorySize {
+		return 0, 0, false
+	}
+	return int(addr), int(length), true
+}
+
+// gdbXfer answers a qXfer read of "offset,length" from the document.
+func gdbXfer(document, args string) string {
+	o, l, _ := strings.Cut(args, ",")
+	offset, err := strconv.ParseUint(o, 16, 32)
+	length, lengthErr := strconv.ParseUint(l, 16, 32)
+	if err != nil || lengthErr != nil {
+		return "E01"
+	}
+	if int(offset) >= len(document) {
+		return "l"
+	}
+	part := document[offset:]
+	if len(part) > int(length) {
+		return "m" + part[:length]
+	}
+	return "l" + part
+}
+
+func (s *gdbSession) registers() []byte {
+	var data []byte
+	for n := range gdbRegisters {
+		data = append(data, s.register(n)...)
+	}
+	return data
+}
+
+// register returns register n, big-endian.
+func (s *gdbSession) register(n int) []byte {
+	chip8 := s.chip8
+	switch name := gdbRegisters[n].name; name {
+	case "i":
+		return []byte{byte(chip8.I >> 8), byte(chip8.I)}
+	case "pc":
+		return []byte{byte(chip8.pc >> 8), byte(chip8.pc)}
+	case "sp":
+		return []byte{byte(len(chip8.stack))}
+	case "dt":
+		return []byte{chip8.delayTimer}
+	case "st":
+		return []byte{chip8.soundTimer}
+	}
+	return []byte{chip8.V[n]}
+}
+
+// checkRegister reports values register n can't hold: addresses outside memory,
+// and stacks deeper than GDB can grow them.
+func checkRegister(n int, data []byte) error {
+	switch name := gdbRegisters[n].name; name {
+	case "i", "pc":
+		if addr := int(data[0])<<8 | int(data[1]); addr >= memorySize {
+			return fmt.Errorf("%s must be an address in memory, got %#x", name, addr)
+		}
+	case "sp":
+		if data[0] > gdbStackDepth {
+			return fmt.Errorf("sp can be at most %d, got %d", gdbStackDepth, data[0])
+		}
+	}
+	return nil
+}
+
+// setRegister changes register n to a value checkRegister allows.
+func (s *gdbSession) setRegister(n int, data []byte) {
+	chip8 := s.chip8
+	switch name := gdbRegisters[n].name; name {
+	case "i":
+		chip8.I = uint16(data[0])<<8 | uint16(data[1])
+	case "pc":
+		chip8.pc = uint16(data[0])<<8 | uint16(data[1])
+	case "sp":
+		// Keep what's on the stack, padding with zeroes when it grows
+		depth := int(data[0])
+		for len(chip8.stack) < depth {
+			chip8.stack.Push(0)
+		}
+		chip8.stack = chip8.stack[:depth]
+	case "dt":
+		chip8.delayTimer = data[0]
+	case "st":
+		chip8.soundTimer = data[0]
+	default:
+		chip8.V[n] = data[0]
+	}
+	chip8.tamper()
+}
+
+// setBreakpoint handles Z and z packets: "type,addr,kind". Types 0 and 1 are
+// breakpoints, 2 to 4 are write, read and access watchpoints.
+func (s *gdbSession) setBreakpoint(insert bool, args string) {
+	fields := strings.Split(args, ",")
+	if len(fields) < 3 {
+		s.send("E01")
+		return
+	}
+	addr, err := strconv.ParseUint(fields[1], 16, 16)
+	length, lengthErr := strconv.ParseUint(fields[2], 16, 16)
+	if err != nil || lengthErr != nil {
+		s.send("E01")
+		return
+	}
+
+	switch fields[0] {
+	case "0", "1":
+		if insert {
+			s.chip8.debug.breakpoints[uint16(addr)] = true
+		} else {
+			delete(s.chip8.debug.breakpoints, uint16(addr))
+		}
+	case "2", "3", "4":
+		kind := map[string]string{"2": "write", "3": "read", "4": "access"}[fields[0]]
+		spec := fmt.Sprintf("%s 0x%X-0x%X", kind, addr, addr+max(length, 1)-1)
+		if insert {
+			watchpoint, err := ParseWatchpoint(spec)
+			if err != nil {
+				s.send("E01")
+				return
+			}
+			s.chip8.Watchpoints = append(s.chip8.Watchpoints, watchpoint)
+			s.watchpoints = append(s.watchpoints, watchpoint)
+		} else {
+			s.removeWatchpoint(spec)
+		}
+	default:
+		s.send("")
+		return
+	}
+	s.send("OK")
+}
+
+// removeWatchpoint removes a watchpoint GDB set.
+func (s *gdbSession) removeWatchpoint(spec string) {
+	for i, w := range s.watchpoints {
+		if w.Spec == spec {
+			s.watchpoints = slices.Delete(s.watchpoints, i, i+1)
+			s.chip8.Watchpoints = slices.DeleteFunc(s.chip8.Watchpoints, func(other *Watchpoint) bool { return other == w })
+			return
+		}
+	}
+}
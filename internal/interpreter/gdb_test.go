@@ -0,0 +1,139 @@
+package interpreter
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gdbClient speaks just enough of the remote serial protocol to script a session.
+type gdbClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+	// Packets aren't acked once QStartNoAckMode is agreed
+	noAck bool
+}
+
+func (c *gdbClient) request(packet string) string {
+	c.t.Helper()
+	fmt.Fprintf(c.conn, "$%s#%02x", packet, gdbChecksum(packet))
+	if !c.noAck {
+		if ack, err := c.r.ReadByte(); err != nil || ack != '+' {
+			c.t.Fatalf("%s: Expected ack, got %q (%v)", packet, ack, err)
+		}
+	}
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.r.ReadString('$'); err != nil {
+		c.t.Fatalf("%s: No reply: %v", packet, err)
+	}
+	reply, err := c.r.ReadString('#')
+	if err != nil {
+		c.t.Fatalf("%s: No reply: %v", packet, err)
+	}
+	c.r.Discard(2)
+	if !c.noAck {
+		c.conn.Write([]byte("+"))
+	}
+	return strings.TrimSuffix(reply, "#")
+}
+
+func (c *gdbClient) expect(packet, expected string) {
+	c.t.Helper()
+	if reply := c.request(packet); reply != expected {
+		c.t.Errorf("%s: Expected %q, got %q", packet, expected, reply)
+	}
+}
+
+func TestGDB(t *testing.T) {
+	program := []byte{
+		0x60, 0x05, // 200: LD V0, 0x05
+		0x70, 0x01, // 202: ADD V0, 0x01
+		0xA3, 0x00, // 204: LD I, 0x300
+		0xF0, 0x33, // 206: LD B, V0
+		0x12, 0x02, // 208: JP 0x202
+	}
+	chip8 := NewCHIP8(&program, DefaultCHIP8Options())
+	listener, err := ServeGDB(chip8, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// Run frames like the window would
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			unlock := chip8.lockDebugger()
+			chip8.RunFrame()
+			unlock()
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	gdb := &gdbClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+
+	gdb.expect("?", "S05")
+	gdb.expect("QStartNoAckMode", "OK")
+	gdb.noAck = true
+	if registers := gdb.request("g"); len(registers) != 23*2 || !strings.HasPrefix(registers[32:], "00000200") {
+		t.Errorf("Expected halted at 0x200 with I=0, got registers %s", registers)
+	}
+
+	// Break before setting I, then step over it
+	gdb.expect("Z0,204,2", "OK")
+	gdb.expect("c", "S05")
+	gdb.expect("p11", "0204")
+	gdb.expect("p0", "06")
+	gdb.expect("s", "S05")
+	gdb.expect("p10", "0300")
+	gdb.expect("z0,204,2", "OK")
+
+	// Stop after the BCD is written
+	gdb.expect("Z2,300,3", "OK")
+	gdb.expect("c", "T05watch:300;")
+	gdb.expect("p11", "0208")
+	gdb.expect("m300,3", "000006")
+
+	gdb.expect("M300,2:abcd", "OK")
+	gdb.expect("m300,2", "abcd")
+	gdb.expect("P0=2a", "OK")
+	gdb.expect("p0", "2a")
+	gdb.expect("P12=02", "OK")
+	gdb.expect("p12", "02")
+	gdb.expect("P12=ff", "E01")
+	gdb.expect("P12=11", "E01")
+	gdb.expect("P12=10", "OK")
+	gdb.expect("P12=00", "OK")
+
+	// Addresses past memory are refused, and a bad G changes nothing
+	gdb.expect("P11=ffff", "E01")
+	gdb.expect("P10=1000", "E01")
+	gdb.expect("cffff", "E01")
+	registers := gdb.request("g")
+	gdb.expect("G77"+registers[2:34]+"ffff"+registers[38:], "E01")
+	gdb.expect("p0", "2a")
+	gdb.expect("p11", "0208")
+
+	gdb.expect("D", "OK")
+	time.Sleep(50 * time.Millisecond)
+	unlock := chip8.lockDebugger()
+	defer unlock()
+	if chip8.debug.halted || len(chip8.Watchpoints) > 0 {
+		t.Errorf("Expected running without watchpoints after detaching, got halted=%v with %d watchpoints", chip8.debug.halted, len(chip8.Watchpoints))
+	}
+}
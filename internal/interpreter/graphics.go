@@ -0,0 +1,189 @@
+package interpreter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"strings"
+)
+
+// GraphicsMode selects how the TUI paints the CHIP-8 display.
+type GraphicsMode string
+
+const (
+	// Colored terminal cells. Works everywhere.
+	GraphicsCells GraphicsMode = "cells"
+	// DEC Sixel bitmap graphics.
+	GraphicsSixel GraphicsMode = "sixel"
+	// Kitty terminal graphics protocol.
+	GraphicsKitty GraphicsMode = "kitty"
+	// Pick the best protocol the terminal advertises, falling back to cells.
+	GraphicsAuto GraphicsMode = "auto"
+)
+
+var SupportedGraphicsModes = []GraphicsMode{GraphicsCells, GraphicsSixel, GraphicsKitty, GraphicsAuto}
+
+// ParseGraphicsMode validates a user supplied graphics mode.
+func ParseGraphicsMode(s string) (GraphicsMode, error) {
+	for _, mode := range SupportedGraphicsModes {
+		if strings.EqualFold(s, string(mode)) {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("unknown graphics mode %q, expected one of %v", s, SupportedGraphicsModes)
+}
+
+// detectGraphicsMode guesses which image protocol the terminal speaks.
+// Querying the terminal directly would race with BubbleTea for stdin, so
+// rely on the environment variables terminals are known to set instead.
+func detectGraphicsMode() GraphicsMode {
+	term := os.Getenv("TERM")
+	termProgram := os.Getenv("TERM_PROGRAM")
+
+	// Multiplexers swallow image sequences unless passthrough is configured.
+	if os.Getenv("TMUX") != "" || strings.HasPrefix(term, "screen") {
+		return GraphicsCells
+	}
+
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "",
+		term == "xterm-kitty",
+		term == "xterm-ghostty",
+		termProgram == "ghostty",
+		termProgram == "WezTerm":
+		return GraphicsKitty
+	case strings.HasPrefix(term, "foot"),
+		strings.HasPrefix(term, "mlterm"),
+		strings.Contains(term, "sixel"),
+		termProgram == "iTerm.app",
+		termProgram == "mintty",
+		termProgram == "contour":
+		return GraphicsSixel
+	}
+	return GraphicsCells
+}
+
+// resolve turns GraphicsAuto into a concrete mode.
+func (mode GraphicsMode) resolve() GraphicsMode {
+	if mode == GraphicsAuto {
+		return detectGraphicsMode()
+	}
+	return mode
+}
+
+// writeImage encodes img with the given protocol, drawn at the cursor position.
+func writeImage(w io.Writer, mode GraphicsMode, img *image.Paletted) error {
+	switch mode {
+	case GraphicsSixel:
+		return writeSixel(w, img)
+	case GraphicsKitty:
+		return writeKitty(w, img)
+	}
+	return fmt.Errorf("graphics mode %q cannot draw images", mode)
+}
+
+// writeSixel encodes img as a DEC Sixel sequence.
+// https://vt100.net/docs/vt3xx-gp/chapter14.html
+func writeSixel(w io.Writer, img *image.Paletted) error {
+	var buf bytes.Buffer
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+
+	// Enter sixel mode, with square pixels and the image size up front
+	fmt.Fprintf(&buf, "\x1bP0;1;0q\"1;1;%d;%d", width, height)
+	for i, c := range img.Palette {
+		rgba := toRGBA(c)
+		fmt.Fprintf(&buf, "#%d;2;%d;%d;%d", i, int(rgba.R)*100/0xFF, int(rgba.G)*100/0xFF, int(rgba.B)*100/0xFF)
+	}
+
+	for band := 0; band < height; band += 6 {
+		for i := range img.Palette {
+			fmt.Fprintf(&buf, "#%d", i)
+			var run int
+			var last byte
+			for x := 0; x < width; x++ {
+				var sixel byte
+				for row := 0; row < 6 && band+row < height; row++ {
+					if img.Pix[(band+row)*img.Stride+x] == uint8(i) {
+						sixel |= 1 << row
+					}
+				}
+				if sixel == last || run == 0 {
+					last = sixel
+					run++
+					continue
+				}
+				writeSixelRun(&buf, last, run)
+				last, run = sixel, 1
+			}
+			writeSixelRun(&buf, last, run)
+			// Carriage return to paint the next color over the same band
+			buf.WriteByte('$')
+		}
+		// Move down to the next band
+		buf.WriteByte('-')
+	}
+	buf.WriteString("\x1b\\")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeSixelRun(buf *bytes.Buffer, sixel byte, run int) {
+	char := sixel + 63
+	if run > 3 {
+		fmt.Fprintf(buf, "!%d%c", run, char)
+		return
+	}
+	for ; run > 0; run-- {
+		buf.WriteByte(char)
+	}
+}
+
+// Kitty limits each escape sequence to this much base64 payload
+const kittyChunkSize = 4096
+
+// writeKitty encodes img as a PNG and transmits it with the Kitty graphics protocol.
+// The same image and placement id are reused so each frame replaces the last one.
+// https://sw.kovidgoyal.net/kitty/graphics-protocol/
+func writeKitty(w io.Writer, img *image.Paletted) error {
+	// Encode the palette's real colors, not the terminal profile's idea of them
+	palette := make(color.Palette, len(img.Palette))
+	for i, c := range img.Palette {
+		palette[i] = toRGBA(c)
+	}
+	img = &image.Paletted{Pix: img.Pix, Stride: img.Stride, Rect: img.Rect, Palette: palette}
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		return err
+	}
+	payload := base64.StdEncoding.EncodeToString(encoded.Bytes())
+
+	var buf bytes.Buffer
+	for first := true; first || len(payload) > 0; first = false {
+		chunk := payload
+		if len(chunk) > kittyChunkSize {
+			chunk = chunk[:kittyChunkSize]
+		}
+		payload = payload[len(chunk):]
+
+		more := 0
+		if len(payload) > 0 {
+			more = 1
+		}
+		if first {
+			// q=2 silences replies that would otherwise show up as keypresses
+			fmt.Fprintf(&buf, "\x1b_Ga=T,f=100,i=1,p=1,q=2,C=1,m=%d;%s\x1b\\", more, chunk)
+		} else {
+			fmt.Fprintf(&buf, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
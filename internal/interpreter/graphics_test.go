@@ -0,0 +1,92 @@
+package interpreter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// testImage is 4x2 pixels in lipgloss colors, which read as black unless
+// they're converted without the terminal's color profile.
+func testImage() *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, 4, 2), color.Palette{lipgloss.Color("#000000"), lipgloss.Color("#ff8000")})
+	copy(img.Pix, []uint8{
+		1, 0, 0, 0,
+		1, 1, 1, 1,
+	})
+	return img
+}
+
+func TestWriteSixel(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeSixel(&buf, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	want := "\x1bP0;1;0q\"1;1;4;2" +
+		"#0;2;0;0;0#1;2;100;50;0" +
+		"#0?@@@$#1BAAA$-" +
+		"\x1b\\"
+	if got := buf.String(); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestWriteKitty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeKitty(&buf, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	payload, ok := strings.CutPrefix(buf.String(), "\x1b_Ga=T,f=100,i=1,p=1,q=2,C=1,m=0;")
+	if !ok || !strings.HasSuffix(payload, "\x1b\\") {
+		t.Fatalf("Expected a single Kitty sequence, got %q", buf.String())
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(payload, "\x1b\\"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orange := color.RGBA{0xFF, 0x80, 0, 0xFF}
+	for _, pixel := range []struct {
+		x, y int
+		want color.RGBA
+	}{{0, 0, orange}, {1, 0, color.RGBA{0, 0, 0, 0xFF}}, {3, 1, orange}} {
+		if got := toRGBA(img.At(pixel.x, pixel.y)); got != pixel.want {
+			t.Errorf("Expected %v at %d,%d, got %v", pixel.want, pixel.x, pixel.y, got)
+		}
+	}
+}
+
+func TestWriteKittyChunks(t *testing.T) {
+	// Noise doesn't compress, so the PNG needs several chunks
+	img := image.NewPaletted(image.Rect(0, 0, 256, 128), color.Palette{color.Black, color.White})
+	random := rand.New(rand.NewSource(1))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(random.Intn(2))
+	}
+	var buf bytes.Buffer
+	if err := writeKitty(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	sequences := strings.Split(strings.TrimSuffix(buf.String(), "\x1b\\"), "\x1b\\")
+	if len(sequences) < 2 {
+		t.Fatalf("Expected several chunks, got %d", len(sequences))
+	}
+	for i, sequence := range sequences {
+		_, chunk, _ := strings.Cut(sequence, ";")
+		more := i < len(sequences)-1
+		if strings.Contains(sequence, "m=1;") != more || len(chunk) > kittyChunkSize {
+			t.Errorf("Chunk %d of %d is malformed: %.40q", i+1, len(sequences), sequence)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package interpreter
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// How long notifications stay on screen
+const notificationDuration = 2 * time.Second
+
+// hud tracks what the overlay shows about the running interpreter.
+type hud struct {
+	// A short-lived notification, like "Speed x2". Debuggers post them from their
+	// own goroutines, so they're guarded.
+	messageMu    sync.Mutex
+	message      string
+	messageUntil time.Time
+
+	// Instructions per second, sampled about once a second
+	ips         float64
+	sampledAt   time.Time
+	sampledFrom uint64
+
+	// Show the high scores
+	leaderboard bool
+}
+
+// restartIPS samples instructions per second afresh, for when the cycle count
+// jumps, which would otherwise wrap the next sample around.
+func (chip8 *CHIP8) restartIPS() {
+	chip8.hud.sampledAt = time.Now()
+	chip8.hud.sampledFrom = chip8.cycles
+}
+
+// notify shows a short message over the display and logs it.
+func (chip8 *CHIP8) notify(format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	chip8.hud.messageMu.Lock()
+	chip8.hud.message = message
+	chip8.hud.messageUntil = time.Now().Add(notificationDuration)
+	chip8.hud.messageMu.Unlock()
+	chip8.Logger.Info(message)
+}
+
+// notification returns the current message, if it hasn't expired.
+func (chip8 *CHIP8) notification() string {
+	chip8.hud.messageMu.Lock()
+	defer chip8.hud.messageMu.Unlock()
+	if time.Now().After(chip8.hud.messageUntil) {
+		return ""
+	}
+	return chip8.hud.message
+}
+
+// mode describes the variant and quirks in use.
+func (chip8 *CHIP8) mode() string {
+	quirks := chip8.Options.CosmacQuirks
+	var enabled []string
+	if quirks.ResetVF {
+		enabled = append(enabled, "reset_vf")
+	}
+	if quirks.IncrementI {
+		enabled = append(enabled, "increment_i")
+	}
+
+	switch {
+	case quirks.ResetVF && quirks.IncrementI:
+		return "COSMAC-VIP"
+	case len(enabled) > 0:
+		return "CHIP-8 (" + strings.Join(enabled, ", ") + ")"
+	}
+	return "CHIP-8"
+}
+
+// playback describes whether the interpreter is paused, and how fast it's running.
+func (chip8 *CHIP8) playback() string {
+	switch {
+	case chip8.control.paused:
+		return "Paused"
+	case chip8.control.fastForward:
+		return "Fast forward"
+	}
+	return fmt.Sprintf("Speed x%g", chip8.speed())
+}
+
+// drawHUD overlays runtime stats and notifications in the top left of the screen,
+// and the memory viewer when it's open.
+func (chip8 *CHIP8) drawHUD(screen *ebiten.Image) {
+	chip8.drawMemoryViewer(screen)
+
+	var lines []string
+	if chip8.Options.HUD {
+		now := time.Now()
+		if elapsed := now.Sub(chip8.hud.sampledAt); elapsed >= time.Second {
+			chip8.hud.ips = float64(chip8.cycles-chip8.hud.sampledFrom) / elapsed.Seconds()
+			chip8.hud.sampledAt = now
+			chip8.hud.sampledFrom = chip8.cycles
+		}
+		lines = append(lines,
+			fmt.Sprintf("FPS %.0f  IPS %.0f", ebiten.ActualFPS(), chip8.hud.ips),
+			chip8.mode(),
+			chip8.playback(),
+			fmt.Sprintf("PC %04X  I %04X", chip8.pc, chip8.I),
+		)
+	}
+	if message := chip8.notification(); message != "" {
+		lines = append(lines, message)
+	}
+	lines = append(lines, chip8.leaderboardLines()...)
+	if len(lines) == 0 {
+		return
+	}
+
+	// The debug font is 6x16 pixels per character
+	longest := 0
+	for _, line := range lines {
+		longest = max(longest, len(line))
+	}
+	vector.DrawFilledRect(screen, 0, 0, float32(longest*6+8), float32(len(lines)*16+4), color.RGBA{0, 0, 0, 0xA0}, false)
+	ebitenutil.DebugPrintAt(screen, strings.Join(lines, "\n"), 4, 2)
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	_ "embed"
 	"errors"
+	"image/color"
+	"io"
 	"math/rand"
 	"slices"
 	"time"
@@ -19,6 +21,8 @@ import (
 const (
 	// In CHIP-8, the program starts at address 0x200.
 	programStartAddress = 0x200
+	// 4KB of memory, like the COSMAC VIP
+	memorySize = 4096
 	// The display parameters for original CHIP-8
 	DisplayWidth  = 64
 	DisplayHeight = 32
@@ -62,7 +66,7 @@ var font = [16][5]byte{
 
 type CHIP8 struct {
 	// Define 4k of RAM.
-	memory [4096]byte
+	memory [memorySize]byte
 
 	// Current instruction in memory to execute.
 	pc uint16
@@ -79,7 +83,7 @@ type CHIP8 struct {
 	// Sound timer. Decremented at 60Hz until 0. Emits beep while not 0.
 	soundTimer byte
 
-	// The beep to play, when appropriate
+	// The beep to play, when appropriate. Loaded on first use.
 	beep *audio.Player
 
 	// The execution stack for subroutines
@@ -88,7 +92,26 @@ type CHIP8 struct {
 	// The current display of the program
 	display Display
 
-	// Size of program being executed.
+	// The display as a texture for the window, and the pixels last uploaded to it
+	frame       *ebiten.Image
+	framePixels []byte
+	// Fills the window around the display
+	borderColor color.Color
+
+	// How many instructions have been executed
+	cycles uint64
+
+	// Overlay state for the window
+	hud hud
+
+	// Pause, frame advance and speed
+	control control
+
+	// Post-processing shaders for the window, created on first use
+	effects *effects
+
+	// The program being executed, and its size plus where it's loaded.
+	program     []byte
 	programSize int
 
 	// Represent the currently pressed keys
@@ -96,10 +119,43 @@ type CHIP8 struct {
 
 	// If set, there pressedKeys that need to be processed
 	dirtyKeys bool
+	// Where the keyboard and gamepads go on the keypad
+	keypad keypad
 
 	// Tweakable settings to use when running the interpreter
 	Options CHIP8Options
 
+	// Records every instruction executed, when set
+	Tracer *Tracer
+	// Counts every instruction executed, when set
+	Profiler *Profiler
+	// Collects every sprite drawn, when set
+	Sprites *SpriteRecorder
+	// Memory frozen at a value every frame
+	Cheats []Cheat
+	// Called back as the program runs, when set
+	Script *Script
+	// Records the best scores, when set
+	HighScores *HighScores
+	// Runs frames in lockstep with another player, when set
+	Netplay *Netplay
+
+	// Where CXNN gets its random numbers, so runs can be repeated with Seed
+	random *rand.Rand
+
+	// Stop when the program touches memory or registers. By default a hit pauses
+	// and shows a notification, unless OnWatch handles it.
+	Watchpoints []*Watchpoint
+	OnWatch     func(WatchHit)
+	// The instruction being executed, for watchpoint hits
+	lastPC          uint16
+	lastInstruction Instruction
+
+	// Set while a remote debugger is in control
+	debug *debugger
+	// The memory viewer and search, toggled with F3
+	memview memoryViewer
+
 	// Logger object to use
 	Logger *log.Logger
 }
@@ -113,9 +169,22 @@ type CHIP8Options struct {
 	InstructionLimit int `mapstructure:"instruction_limit"`
 	// Enable quirks for COSMAC-like behavior
 	CosmacQuirks COSMACQuirks `mapstructure:"cosmac-vip"`
-	// Colors!
+	// Colors! A named palette, optionally overriding its off and on colors
+	Palette  string `mapstructure:"palette"`
 	OffColor string `mapstructure:"off_color"`
 	OnColor  string `mapstructure:"on_color"`
+	// CRT and phosphor post-processing in the window
+	Effects EffectOptions `mapstructure:"effects"`
+	// Blend recent frames together to hide flicker
+	FrameBlend FrameBlendOptions `mapstructure:"frame_blend"`
+	// Window size, scaling and fullscreen
+	Window WindowOptions `mapstructure:"window"`
+	// Overlay runtime stats in the window
+	HUD bool `mapstructure:"hud"`
+	// Split the keypad between two players
+	Keypad KeypadOptions `mapstructure:"keypad"`
+	// Where the program keeps its score, like "[0x2F0]*100 + [0x2F1]*10 + [0x2F2]"
+	Score string `mapstructure:"score"`
 }
 
 type COSMACQuirks struct {
@@ -135,34 +204,64 @@ func NewCHIP8(program *[]byte, opts CHIP8Options) *CHIP8 {
 	chip8 := &CHIP8{
 		pc:      programStartAddress,
 		Options: opts,
+		Logger:  log.New(io.Discard),
+		control: control{speedIndex: normalSpeedIndex},
+		random:  rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 
+	// Keep a copy of the program, for resetting
+	chip8.program = slices.Clone(*program)
 	chip8.programSize = len(*program) + programStartAddress
 	// Load program into memory.
 	copy(chip8.memory[programStartAddress:], *program)
 
-	chip8.display.onColor = Colors[chip8.Options.OnColor]
-	chip8.display.offColor = Colors[chip8.Options.OffColor]
+	palette, err := chip8.Options.ResolvePalette()
+	if err != nil {
+		// Callers are expected to validate first, so don't render with missing colors
+		palette = Palettes[DefaultPalette]
+	}
+	chip8.display = newDisplay(palette)
+	if chip8.borderColor, err = ParseColor(chip8.Options.Window.BorderColor); err != nil {
+		chip8.borderColor = color.Black
+	}
+
+	chip8.keypad = newKeypad(chip8.Options.Keypad)
+	chip8.loadFont()
 
-	// Load font into memory
-	// From 0x000 to 0x1FF
+	return chip8
+}
+
+// Only one audio context can exist, so every interpreter shares it
+var audioContext *audio.Context
+
+// playBeep plays the beep, loading it on first use so interpreters that never
+// make a sound don't need an audio device.
+func (chip8 *CHIP8) playBeep() {
+	if chip8.beep == nil {
+		// Load sound file
+		data, err := mp3.DecodeWithSampleRate(44100, bytes.NewReader(beepData))
+		if err != nil {
+			panic(err)
+		}
+		if audioContext == nil {
+			audioContext = audio.NewContext(44100)
+		}
+		chip8.beep, err = audioContext.NewPlayer(data)
+		if err != nil {
+			panic(err)
+		}
+	}
+	chip8.beep.Play()
+}
+
+// Load font into memory
+// From 0x000 to 0x1FF
+func (chip8 *CHIP8) loadFont() {
 	for i := 0; i < 16; i++ {
 		for j := 0; j < 5; j++ {
 			chip8.memory[i*5+j] = font[i][j]
 		}
 	}
-
-	// Load sound file
-	data, err := mp3.DecodeWithSampleRate(44100, bytes.NewReader(beepData))
-	if err != nil {
-		panic(err)
-	}
-	chip8.beep, err = audio.NewContext(44100).NewPlayer(data)
-	if err != nil {
-		panic(err)
-	}
-
-	return chip8
 }
 
 func DefaultCHIP8Options() CHIP8Options {
@@ -171,8 +270,10 @@ func DefaultCHIP8Options() CHIP8Options {
 		ThrottleSpeed:      0,
 		InstructionLimit:   -1,
 		CosmacQuirks:       COSMACQuirks{},
-		OffColor:           "Iris",
-		OnColor:            "Pine",
+		Palette:            DefaultPalette,
+		Effects:            DefaultEffectOptions(),
+		FrameBlend:         FrameBlendOptions{Mode: BlendOff, Frames: 3},
+		Window:             DefaultWindowOptions(),
 	}
 }
 
@@ -205,12 +306,16 @@ func (i Instruction) nibbles(start, end int) uint16 {
 
 func (ch8 *CHIP8) stepInterpreter() {
 
+	ch8.applyCheats()
+	if ch8.Script != nil {
+		ch8.Script.beforeFrame()
+	}
 	exec := true
 
 	for exec {
 
-		// Throttle the CPU based on a configurable delay
-		if ch8.Options.ThrottleSpeed*10 > 0 {
+		// Throttle the CPU based on a configurable delay. Fast forward ignores it.
+		if ch8.Options.ThrottleSpeed*10 > 0 && !ch8.control.fastForward && !ch8.control.unthrottled {
 			elapsedTime := time.Since(lastUpdate)
 			delay := time.Second / time.Duration(ch8.Options.ThrottleSpeed*10)
 			if elapsedTime < delay {
@@ -222,10 +327,34 @@ func (ch8 *CHIP8) stepInterpreter() {
 		if ch8.Options.InstructionLimit != -1 && int(ch8.pc)/2 >= ch8.Options.InstructionLimit {
 			break
 		}
+		if ch8.finished() {
+			// Don't run off into empty memory
+			break
+		}
+		if ch8.debug != nil && ch8.debug.beforeInstruction(ch8.pc) {
+			break
+		}
 
 		instruction := ch8.readNextInstruction()
+		if ch8.Tracer != nil {
+			ch8.Tracer.record(ch8, ch8.pc-2, instruction)
+		}
+		if ch8.Profiler != nil {
+			ch8.Profiler.record(ch8, ch8.pc-2, instruction)
+		}
+		if ch8.Script != nil {
+			ch8.Script.instruction(ch8.pc-2, instruction)
+		}
+		ch8.cycles++
 		ch8.Logger.Debugf("[%04X] %04X", ch8.pc-2, instruction)
 
+		watching := len(ch8.Watchpoints) > 0
+		var before registerState
+		if watching {
+			ch8.lastPC, ch8.lastInstruction = ch8.pc-2, instruction
+			before = ch8.registerState()
+		}
+
 		firstNibble := instruction.nibbles(0, 0)
 
 		switch firstNibble {
@@ -426,7 +555,7 @@ func (ch8 *CHIP8) stepInterpreter() {
 			// CXNN: Set VX to a random number AND NN.
 			value := instruction.nibbles(2, 3)
 			registerX := instruction.nibbles(1, 1)
-			randomNumber := rand.Intn(256)
+			randomNumber := ch8.random.Intn(256)
 			ch8.Logger.Debugf("[%04X] Setting V%X to (%d AND %X)", instruction, registerX, randomNumber, value)
 			ch8.V[registerX] = byte(randomNumber & int(value))
 
@@ -447,25 +576,24 @@ func (ch8 *CHIP8) stepInterpreter() {
 			//    This is how many contiguous blocks of memory, read from I, to draw.
 			spriteHeight := instruction.nibbles(3, 3)
 			ch8.Logger.Debugf("[%04X] Drawing %d-sized sprite at (%d, %d)", instruction, spriteHeight, drawX, drawY)
+			if watching {
+				ch8.watchMemory(ch8.I, spriteHeight, false)
+			}
+			if ch8.Sprites != nil {
+				ch8.Sprites.record(ch8.memory[:], ch8.I, spriteHeight)
+			}
 			for y := uint16(0); y < spriteHeight; y++ {
-				// Each byte in the sprite data is a line of 8 pixels.
+				// Each byte in the sprite data is a line of 8 pixels, clipped at the edges.
 				line := ch8.memory[ch8.I+y]
-				yLoc := drawY + byte(y)
-				for x := 0; x < 8 && drawX+byte(x) < DisplayWidth && yLoc < DisplayHeight; x++ {
-					xLoc := drawX + byte(x)
-					pixel := (line >> (7 - x)) & 1
-
-					if pixel != 0 {
-						currentPixel := ch8.display.content[xLoc][yLoc]
-						ch8.display.content[xLoc][yLoc] ^= 1
-
-						if currentPixel != 0 {
-							// Pixel was set, turn on VF flag.
-							ch8.V[0xF] = 1
-						}
-					}
+				if ch8.display.content.XORByte(0, int(drawX), int(drawY)+int(y), line) {
+					// A set pixel was turned off, turn on VF flag.
+					ch8.V[0xF] = 1
 				}
 			}
+			ch8.display.dirty = true
+			if ch8.Script != nil {
+				ch8.Script.drew(drawX, drawY, spriteHeight, ch8.I)
+			}
 			exec = false
 
 		case 0xE:
@@ -551,16 +679,30 @@ func (ch8 *CHIP8) stepInterpreter() {
 			case 0x33:
 				// FX33: Store the binary-coded decimal equivalent of the value stored in register VX at addresses I, I + 1, and I + 2
 				ch8.Logger.Debugf("[%04X] Storing BCD of V%d at memory addresses I, I + 1, and I + 2", instruction, registerX)
+				if watching {
+					ch8.watchMemory(ch8.I, 3, true)
+				}
 				ch8.memory[ch8.I] = ch8.V[registerX] / 100
 				ch8.memory[ch8.I+1] = (ch8.V[registerX] / 10) % 10
 				ch8.memory[ch8.I+2] = ch8.V[registerX] % 10
+				ch8.memview.wrote(ch8.I, 3)
+				if ch8.Script != nil {
+					ch8.Script.wrote(ch8.I, 3)
+				}
 
 			case 0x55:
 				// FX55: Store registers V0 through VX in memory starting at address I
 				ch8.Logger.Debugf("[%04X] Storing V0 through V%d at memory address I", instruction, registerX)
+				if watching {
+					ch8.watchMemory(ch8.I, registerX+1, true)
+				}
 				for i := uint16(0); i <= uint16(registerX); i++ {
 					ch8.memory[ch8.I+i] = ch8.V[i]
 				}
+				ch8.memview.wrote(ch8.I, registerX+1)
+				if ch8.Script != nil {
+					ch8.Script.wrote(ch8.I, registerX+1)
+				}
 				if ch8.Options.CosmacQuirks.IncrementI {
 					// COSMAC VIP incremented the I register while it worked. Each time it stored or loaded one register, it incremented I. After the instruction was finished, I would be set to the new value I + X + 1.
 					ch8.I = registerX + 1
@@ -569,6 +711,9 @@ func (ch8 *CHIP8) stepInterpreter() {
 			case 0x65:
 				// FX65: Read registers V0 through VX from memory starting at address I
 				ch8.Logger.Debugf("[%04X] Reading V0 through V%d from memory address I", instruction, registerX)
+				if watching {
+					ch8.watchMemory(ch8.I, registerX+1, false)
+				}
 				for i := uint16(0); i <= uint16(registerX); i++ {
 					ch8.V[i] = ch8.memory[ch8.I+i]
 				}
@@ -584,7 +729,26 @@ func (ch8 *CHIP8) stepInterpreter() {
 		default:
 			ch8.Logger.Warnf("[%04X] Unsupported instruction!", instruction)
 		}
+
+		if watching {
+			ch8.watchInstruction(before)
+			if ch8.control.watchBreak {
+				// Stop right after the instruction that triggered it
+				ch8.control.watchBreak = false
+				exec = false
+			}
+		}
+		if ch8.debug != nil && ch8.debug.afterInstruction() {
+			exec = false
+		}
+	}
+	if ch8.Script != nil {
+		ch8.Script.afterFrame()
+	}
+	if ch8.HighScores != nil {
+		ch8.HighScores.afterFrame()
 	}
+	ch8.display.recordFrame(ch8.Options.FrameBlend)
 }
 
 // Convert keypad key to hex value
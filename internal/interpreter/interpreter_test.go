@@ -30,3 +30,62 @@ func TestNibbles(t *testing.T) {
 		})
 	}
 }
+
+func TestResolvePalette(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     CHIP8Options
+		expected [2]string
+		wantErr  bool
+	}{
+		{"default", CHIP8Options{}, [2]string{"#c4a7e7", "#31748f"}, false},
+		{"named palette", CHIP8Options{Palette: "Amber"}, [2]string{"#1a0f00", "#ffb000"}, false},
+		{"named colors", CHIP8Options{OffColor: "base", OnColor: "Love"}, [2]string{"#191724", "#eb6f92"}, false},
+		{"hex override", CHIP8Options{Palette: "gameboy", OnColor: "#123ABC"}, [2]string{"#9bbc0f", "#123ABC"}, false},
+		{"unknown palette", CHIP8Options{Palette: "vaporwave"}, [2]string{}, true},
+		{"unknown color", CHIP8Options{OnColor: "Teal"}, [2]string{}, true},
+		{"short hex", CHIP8Options{OffColor: "#fff"}, [2]string{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			palette, err := test.opts.ResolvePalette()
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got palette %v", palette)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(palette[0]) != test.expected[0] || string(palette[1]) != test.expected[1] {
+				t.Errorf("Expected: %v, Got: %v", test.expected, palette[:2])
+			}
+		})
+	}
+}
+
+func TestWindowFit(t *testing.T) {
+	tests := []struct {
+		opts          WindowOptions
+		width, height int
+		scale, x, y   float64
+	}{
+		{WindowOptions{}, 640, 320, 10, 0, 0},
+		{WindowOptions{}, 800, 320, 10, 80, 0},
+		{WindowOptions{}, 700, 700, 10.9375, 0, 175},
+		{WindowOptions{IntegerScaling: true}, 700, 350, 10, 30, 15},
+		{WindowOptions{Padding: 32}, 704, 384, 10, 32, 32},
+		{WindowOptions{}, 10, 10, 1, -27, -11},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%+v in %dx%d", test.opts, test.width, test.height), func(t *testing.T) {
+			scale, x, y := test.opts.fit(test.width, test.height, DisplayWidth, DisplayHeight)
+			if scale != test.scale || x != test.x || y != test.y {
+				t.Errorf("Expected: %v at (%v, %v), Got: %v at (%v, %v)", test.scale, test.x, test.y, scale, x, y)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package interpreter
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// KeypadOptions split the keypad between two players, for games like Pong that
+// put both players on one side of the usual layout. Each player's controls get
+// their own part of the keyboard, away from the usual layout, and their own
+// gamepad. Every keypad key also stays where it usually is.
+type KeypadOptions struct {
+	Player1 PlayerControls `mapstructure:"player1"`
+	Player2 PlayerControls `mapstructure:"player2"`
+}
+
+// PlayerControls name the keypad key, 0 to F, behind each of a player's
+// controls. Controls left empty aren't used.
+type PlayerControls struct {
+	Up    string `mapstructure:"up"`
+	Down  string `mapstructure:"down"`
+	Left  string `mapstructure:"left"`
+	Right string `mapstructure:"right"`
+	A     string `mapstructure:"a"`
+	B     string `mapstructure:"b"`
+}
+
+// The keyboard keys for each player's up, down, left, right, a and b, none of
+// them in the usual layout
+var playerKeyboards = [2][6]string{
+	{"i", "k", "j", "l", "u", "o"},
+	{"up", "down", "left", "right", ",", "."},
+}
+
+// The gamepad buttons for up, down, left, right, a and b
+var playerButtons = [6]ebiten.StandardGamepadButton{
+	ebiten.StandardGamepadButtonLeftTop,
+	ebiten.StandardGamepadButtonLeftBottom,
+	ebiten.StandardGamepadButtonLeftLeft,
+	ebiten.StandardGamepadButtonLeftRight,
+	ebiten.StandardGamepadButtonRightBottom,
+	ebiten.StandardGamepadButtonRightRight,
+}
+
+// How far a stick is pushed before it counts as a direction
+const stickThreshold = 0.5
+
+func (controls PlayerControls) list() [6]string {
+	return [6]string{controls.Up, controls.Down, controls.Left, controls.Right, controls.A, controls.B}
+}
+
+// Validate reports controls that aren't keypad keys.
+func (opts KeypadOptions) Validate() error {
+	for i, controls := range []PlayerControls{opts.Player1, opts.Player2} {
+		for _, control := range controls.list() {
+			if _, err := parseKeypadKey(control); control != "" && err != nil {
+				return fmt.Errorf("player%d: %w", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Split reports whether any player has controls, so the keypad is split.
+func (opts KeypadOptions) Split() bool {
+	return opts.Player1 != PlayerControls{} || opts.Player2 != PlayerControls{}
+}
+
+func parseKeypadKey(s string) (byte, error) {
+	key, err := strconv.ParseUint(s, 16, 8)
+	if len(s) != 1 || err != nil {
+		return 0, fmt.Errorf("%q is not a keypad key, 0 to F", s)
+	}
+	return byte(key), nil
+}
+
+// keypad maps the keyboard and gamepads to keypad keys.
+type keypad struct {
+	// Keyboard keys the players claim, by name
+	keys map[string]byte
+	// Each player's controls, in the order of playerButtons, or -1 if unused
+	controls [2][6]int
+}
+
+func newKeypad(opts KeypadOptions) keypad {
+	k := keypad{keys: map[string]byte{}}
+	for player, controls := range []PlayerControls{opts.Player1, opts.Player2} {
+		for i, control := range controls.list() {
+			k.controls[player][i] = -1
+			if key, err := parseKeypadKey(control); err == nil {
+				k.keys[playerKeyboards[player][i]] = key
+				k.controls[player][i] = int(key)
+			}
+		}
+	}
+	return k
+}
+
+// keyboardKey converts a key held on the keyboard to the keypad. Players' keys
+// come first, then the usual layout.
+func (k keypad) keyboardKey(key ebiten.Key) (byte, bool) {
+	if hex, ok := k.keys[ebitenKeyName(key)]; ok {
+		return hex, true
+	}
+	hex, err := ebitenKeyToHex(key)
+	return hex, err == nil
+}
+
+// gamepadKeys are the keypad keys held on gamepads. The first gamepad connected
+// is player 1's, the second player 2's.
+func (k keypad) gamepadKeys() []byte {
+	var keys []byte
+	ids := ebiten.AppendGamepadIDs(nil)
+	for player := 0; player < len(ids) && player < len(k.controls); player++ {
+		id := ids[player]
+		if !ebiten.IsStandardGamepadLayoutAvailable(id) {
+			continue
+		}
+		x := ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickHorizontal)
+		y := ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickVertical)
+		stick := [6]bool{y < -stickThreshold, y > stickThreshold, x < -stickThreshold, x > stickThreshold}
+		for i, button := range playerButtons {
+			key := k.controls[player][i]
+			if key >= 0 && (stick[i] || ebiten.IsStandardGamepadButtonPressed(id, button)) {
+				keys = append(keys, byte(key))
+			}
+		}
+	}
+	return keys
+}
+
+// Action is the keys held during a step, one bit per keypad key: bit 0 for key 0
+// up to bit 15 for key F. 0 holds nothing.
+type Action uint16
+
+// actionOf is the action holding the keys.
+func actionOf(keys []byte) Action {
+	var a Action
+	for _, key := range keys {
+		a |= 1 << (key & 0xF)
+	}
+	return a
+}
+
+func (a Action) keys() []byte {
+	keys := []byte{}
+	for key := byte(0); key < 16; key++ {
+		if a&(1<<key) != 0 {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,98 @@
+package interpreter
+
+import (
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+func TestSplitKeypad(t *testing.T) {
+	// Pong's paddles
+	opts := KeypadOptions{
+		Player1: PlayerControls{Up: "1", Down: "4"},
+		Player2: PlayerControls{Up: "c", Down: "D"},
+	}
+	if err := opts.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	k := newKeypad(opts)
+	for key, want := range map[ebiten.Key]byte{
+		ebiten.KeyI:         0x1,
+		ebiten.KeyK:         0x4,
+		ebiten.KeyArrowUp:   0xC,
+		ebiten.KeyArrowDown: 0xD,
+		// The usual layout is untouched
+		ebiten.KeyW: 0x5,
+		ebiten.KeyQ: 0x4,
+		ebiten.Key1: 0x1,
+	} {
+		if got, ok := k.keyboardKey(key); !ok || got != want {
+			t.Errorf("Expected %v to press %X, got %X", key, want, got)
+		}
+	}
+	if _, ok := k.keyboardKey(ebiten.KeyArrowLeft); ok {
+		t.Error("Expected player 2 to have no left")
+	}
+
+	unsplit := newKeypad(KeypadOptions{})
+	if got, _ := unsplit.keyboardKey(ebiten.KeyW); got != 0x5 {
+		t.Errorf("Expected W to press 5 without a split, got %X", got)
+	}
+
+	for _, bad := range []string{"10", "g", "-1"} {
+		opts := KeypadOptions{Player2: PlayerControls{A: bad}}
+		if err := opts.Validate(); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestSplitKeypadReachable(t *testing.T) {
+	// Both players with every control, claiming 12 keypad keys
+	k := newKeypad(KeypadOptions{
+		Player1: PlayerControls{Up: "2", Down: "8", Left: "4", Right: "6", A: "5", B: "7"},
+		Player2: PlayerControls{Up: "3", Down: "9", Left: "A", Right: "B", A: "C", B: "D"},
+	})
+	reachable := map[byte]bool{}
+	for key := ebiten.Key(0); key <= ebiten.KeyMax; key++ {
+		if hex, ok := k.keyboardKey(key); ok {
+			reachable[hex] = true
+		}
+	}
+	for hex := byte(0); hex < 16; hex++ {
+		if !reachable[hex] {
+			t.Errorf("Expected keypad key %X to have a keyboard key", hex)
+		}
+	}
+
+	// No player key takes one from the usual layout
+	for player, keys := range playerKeyboards {
+		for _, name := range keys {
+			for key := ebiten.Key(0); key <= ebiten.KeyMax; key++ {
+				if _, err := ebitenKeyToHex(key); err == nil && ebitenKeyName(key) == name {
+					t.Errorf("Player %d's %q is on the usual layout", player+1, name)
+				}
+			}
+		}
+	}
+}
+
+func TestRomInfoKeypad(t *testing.T) {
+	info := RomInfo{Keys: map[string]int{"up": 1, "down": 4, "player2Up": 12, "player2Down": 13}}
+	opts := DefaultCHIP8Options()
+	info.Apply(&opts)
+	want := KeypadOptions{
+		Player1: PlayerControls{Up: "1", Down: "4"},
+		Player2: PlayerControls{Up: "C", Down: "D"},
+	}
+	if opts.Keypad != want {
+		t.Errorf("Expected %+v, got %+v", want, opts.Keypad)
+	}
+
+	// One player games keep the usual layout
+	opts = DefaultCHIP8Options()
+	RomInfo{Keys: map[string]int{"up": 5}}.Apply(&opts)
+	if opts.Keypad.Split() {
+		t.Error("Expected no split for a one player game")
+	}
+}
@@ -1,51 +1,74 @@
 package interpreter
 
 import (
-	"time"
+	"slices"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
-	"github.com/hajimehoshi/ebiten/v2/vector"
 )
 
 func (chip8 *CHIP8) Update() error {
-	if ebiten.IsKeyPressed(ebiten.KeyEscape) {
+	defer chip8.lockDebugger()()
+	// The memory viewer gets the first look at keys, and all of them while typing
+	// or searching
+	wasEditing := chip8.memview.capturing()
+	for _, key := range inpututil.AppendJustPressedKeys(nil) {
+		chip8.memoryViewerKey(ebitenKeyName(key))
+	}
+	editing := wasEditing || chip8.memview.capturing()
+	if ebiten.IsKeyPressed(ebiten.KeyEscape) && !editing {
 		return ebiten.Termination
 	}
-	// Calculate elapsed time since last timer update
-	elapsed := time.Since(lastDelayTimerUpdate)
-	if chip8.delayTimer > 0 {
-		if elapsed >= decrementInterval {
-			chip8.delayTimer--
-			elapsed -= decrementInterval
-			lastDelayTimerUpdate = lastDelayTimerUpdate.Add(decrementInterval)
-		}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF1) {
+		chip8.Options.HUD = !chip8.Options.HUD
 	}
-
-	elapsed = time.Since(lastSoundTimerUpdate)
-	if chip8.soundTimer > 0 {
-		chip8.beep.Play()
-		if elapsed >= decrementInterval {
-			chip8.soundTimer--
-			elapsed -= decrementInterval
-			lastSoundTimerUpdate = lastSoundTimerUpdate.Add(decrementInterval)
+	if inpututil.IsKeyJustPressed(ebiten.KeyF2) {
+		chip8.Options.Effects.Enabled = !chip8.Options.Effects.Enabled
+		chip8.notify("Effects %s", onOff(chip8.Options.Effects.Enabled))
+	}
+	// Both players have to run the same frames, so netplay can't be paused, sped
+	// up or reset
+	if chip8.Netplay == nil {
+		if inpututil.IsKeyJustPressed(ebiten.KeyF5) {
+			chip8.togglePause()
 		}
-	} else {
-		if chip8.beep.IsPlaying() {
-			chip8.beep.Pause()
-			chip8.beep.SetPosition(0)
+		if inpututil.IsKeyJustPressed(ebiten.KeyF6) {
+			chip8.stepFrame()
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyF7) {
+			chip8.changeSpeed(-1)
 		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyF8) {
+			chip8.changeSpeed(1)
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyF9) {
+			chip8.Reset()
+			chip8.notify("Reset")
+		}
+		chip8.setFastForward(ebiten.IsKeyPressed(ebiten.KeyTab))
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF12) {
+		chip8.toggleCheats()
 	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyH) && !editing {
+		chip8.toggleLeaderboard()
+	}
+	chip8.updateWindow()
 
 	// Handle input
 	var keys []ebiten.Key
-	keys = inpututil.AppendPressedKeys(keys)
-	if len(keys) > 0 {
+	if !editing {
+		keys = inpututil.AppendPressedKeys(keys)
+	}
+	var gamepadKeys []byte
+	if !editing {
+		gamepadKeys = chip8.keypad.gamepadKeys()
+	}
+	if len(keys) > 0 || len(gamepadKeys) > 0 {
 		// For any pressed keys, convert them to hex
-		var keypresses []byte
+		keypresses := gamepadKeys
 		for _, key := range keys {
-			keypress, err := ebitenKeyToHex(key)
-			if err == nil {
+			if keypress, ok := chip8.keypad.keyboardKey(key); ok && !slices.Contains(keypresses, keypress) {
 				keypresses = append(keypresses, keypress)
 			}
 		}
@@ -57,44 +80,67 @@ func (chip8 *CHIP8) Update() error {
 		}
 	}
 
-	chip8.stepInterpreter()
-	if int(chip8.pc) == chip8.programSize {
+	chip8.tick()
+	if chip8.finished() {
 		return ebiten.Termination
 	}
 	return nil
 }
 
 func (chip8 *CHIP8) Draw(screen *ebiten.Image) {
-	// Iterate over CHIP-8 display data.
-	for x := 0; x < DisplayWidth; x++ {
-		for y := 0; y < DisplayHeight; y++ {
-			if chip8.display.content[x][y] != 0 {
-				// Draw a filled rectangle for each set CHIP-8 pixel
-				vector.DrawFilledRect(
-					screen,
-					float32(x*chip8.Options.DisplayScaleFactor),
-					float32(y*chip8.Options.DisplayScaleFactor),
-					float32(chip8.Options.DisplayScaleFactor),
-					float32(chip8.Options.DisplayScaleFactor),
-					chip8.display.onColor,
-					false,
-				)
-			} else {
-				// Draw a rectangle for each unset CHIP-8 pixel
-				vector.DrawFilledRect(
-					screen,
-					float32(x*chip8.Options.DisplayScaleFactor),
-					float32(y*chip8.Options.DisplayScaleFactor),
-					float32(chip8.Options.DisplayScaleFactor),
-					float32(chip8.Options.DisplayScaleFactor),
-					chip8.display.offColor,
-					false,
-				)
+	// Fill the window around the display
+	screen.Fill(chip8.borderColor)
+	width, height := chip8.display.width(), chip8.display.height()
+	bounds := screen.Bounds()
+	scale, x, y := chip8.Options.Window.fit(bounds.Dx(), bounds.Dy(), width, height)
+
+	if chip8.Options.Effects.Enabled {
+		if chip8.effects == nil {
+			var err error
+			chip8.effects, err = newEffects()
+			if err != nil {
+				chip8.Logger.Error("Disabling display effects", "err", err)
+				chip8.Options.Effects.Enabled = false
 			}
 		}
+		if chip8.effects != nil {
+			frame := chip8.display.present(chip8.Options.FrameBlend)
+			chip8.effects.draw(screen, frame, width, height, chip8.display.palette, chip8.Options.Effects, scale, x, y)
+			chip8.drawHUD(screen)
+			return
+		}
+	}
+
+	// Keep the display in a texture at its native resolution, and only upload
+	// pixels when they've changed. Blended frames change as old frames fade out.
+	if chip8.frame == nil || chip8.frame.Bounds().Dx() != width || chip8.frame.Bounds().Dy() != height {
+		chip8.frame = ebiten.NewImage(width, height)
+		chip8.framePixels = make([]byte, width*height*4)
+		chip8.display.dirty = true
 	}
+	blend := chip8.Options.FrameBlend
+	if chip8.display.dirty || blend.enabled() {
+		chip8.display.rgba(chip8.display.present(blend), chip8.framePixels)
+		chip8.frame.WritePixels(chip8.framePixels)
+		chip8.display.dirty = false
+	}
+
+	// Blow it up to fit the window. The default nearest filter keeps pixels sharp.
+	geoM := ebiten.GeoM{}
+	geoM.Scale(scale, scale)
+	geoM.Translate(x, y)
+	screen.DrawImage(chip8.frame, &ebiten.DrawImageOptions{GeoM: geoM})
+	chip8.drawHUD(screen)
 }
 
+// Layout uses the whole window as the screen, and Draw fits the display inside it.
 func (chip8 *CHIP8) Layout(outsideWidth, outsideHeight int) (screenWidth, screenHeight int) {
-	return DisplayWidth * chip8.Options.DisplayScaleFactor, DisplayHeight * chip8.Options.DisplayScaleFactor
+	return outsideWidth, outsideHeight
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
 }
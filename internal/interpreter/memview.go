@@ -0,0 +1,491 @@
+package interpreter
+
+import (
+	"fmt"
+	"image/color"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// What the memory viewer keeps in view
+type followMode int
+
+const (
+	followPC followMode = iota
+	followI
+	followNothing
+)
+
+func (f followMode) String() string {
+	switch f {
+	case followPC:
+		return "PC"
+	case followI:
+		return "I"
+	}
+	return "nothing"
+}
+
+// The memory viewer shows a page of 16 rows of 16 bytes
+const (
+	memoryViewColumns = 16
+	memoryViewRows    = 16
+	memoryViewPage    = memoryViewColumns * memoryViewRows
+	// Rows kept above the followed address, for context
+	memoryViewContext = 4
+	// How long written bytes stay highlighted
+	memoryWriteHighlight = time.Second
+	// As sprites, the page is two bands of 8 sprites, each 16 bytes tall
+	spriteViewColumns = 8
+	spriteViewHeight  = 16
+)
+
+// memoryViewer is a hex and ASCII view of memory that can change it, toggled
+// with F3.
+type memoryViewer struct {
+	open   bool
+	follow followMode
+	// Show the page as sprite bitmaps instead of hex
+	sprites bool
+	// The selected byte, and the first address shown
+	cursor, top uint16
+	// Typing a new value for the selected byte, and the hex digits so far
+	editing bool
+	digits  string
+	// When each byte was last written, to highlight recent writes
+	writtenAt [memorySize]time.Time
+	// Searching memory for a value to freeze, toggled with /. The search is kept
+	// after leaving search mode, to pick up again later.
+	searching bool
+	search    *MemorySearch
+	// Typing a value to search for, into digits
+	searchingValue bool
+}
+
+// capturing reports whether the viewer takes every key, so none reach the keypad.
+func (v *memoryViewer) capturing() bool {
+	return v.open && (v.editing || v.searching)
+}
+
+// candidate reports whether the search has narrowed down to an address.
+func (v *memoryViewer) candidate(addr uint16) bool {
+	if v.search == nil || len(v.search.candidates) == memorySize {
+		return false
+	}
+	_, found := slices.BinarySearch(v.search.candidates, addr)
+	return found
+}
+
+// wrote marks bytes the program just wrote.
+func (v *memoryViewer) wrote(addr uint16, length uint16) {
+	if !v.open {
+		return
+	}
+	now := time.Now()
+	for i := uint16(0); i < length && int(addr+i) < memorySize; i++ {
+		v.writtenAt[addr+i] = now
+	}
+}
+
+func (v *memoryViewer) recentlyWritten(addr uint16) bool {
+	return time.Since(v.writtenAt[addr]) < memoryWriteHighlight
+}
+
+// updateMemoryViewer moves the cursor to the followed address and scrolls it into view.
+func (chip8 *CHIP8) updateMemoryViewer() {
+	v := &chip8.memview
+	switch v.follow {
+	case followPC:
+		v.cursor = min(chip8.pc, memorySize-1)
+	case followI:
+		v.cursor = min(chip8.I, memorySize-1)
+	}
+	if v.cursor < v.top || v.cursor >= v.top+memoryViewPage {
+		row := int(v.cursor) &^ (memoryViewColumns - 1)
+		v.top = uint16(min(max(row-memoryViewContext*memoryViewColumns, 0), memorySize-memoryViewPage))
+	}
+}
+
+// move shifts the cursor by delta bytes and stops following anything.
+func (v *memoryViewer) move(delta int) {
+	v.follow = followNothing
+	v.cursor = uint16(min(max(int(v.cursor)+delta, 0), memorySize-1))
+}
+
+// memoryViewerKey handles a key for the memory viewer, named like BubbleTea
+// names keys, and reports whether it used it. While a value is being typed, the
+// viewer takes every key.
+func (chip8 *CHIP8) memoryViewerKey(key string) bool {
+	v := &chip8.memview
+	if key == "f3" {
+		v.open = !v.open
+		v.editing, v.digits = false, ""
+		v.searching, v.searchingValue = false, false
+		chip8.notify("Memory viewer %s", onOff(v.open))
+		return true
+	}
+	if !v.open {
+		return false
+	}
+
+	if v.editing {
+		switch {
+		case key == "enter" || key == "esc":
+			v.editing, v.digits = false, ""
+		case len(key) == 1 && strings.Contains("0123456789abcdef", key):
+			v.digits += key
+			if len(v.digits) == 2 {
+				value, _ := strconv.ParseUint(v.digits, 16, 8)
+				chip8.memory[v.cursor] = byte(value)
+				chip8.tamper()
+				v.writtenAt[v.cursor] = time.Now()
+				v.digits = ""
+				v.move(1)
+			}
+		}
+		return true
+	}
+	if v.searching && chip8.memorySearchKey(key) {
+		return true
+	}
+
+	switch key {
+	case "/":
+		if v.search == nil {
+			v.search = NewMemorySearch(&chip8.memory)
+		}
+		v.searching = true
+		chip8.notify("Searching %d addresses", len(v.search.candidates))
+	case "f4":
+		v.follow = (v.follow + 1) % (followNothing + 1)
+		chip8.notify("Memory viewer follows %s", v.follow)
+	case "f10":
+		v.sprites = !v.sprites
+	case "up":
+		v.move(-memoryViewColumns)
+	case "down":
+		v.move(memoryViewColumns)
+	case "left":
+		v.move(-1)
+	case "right":
+		v.move(1)
+	case "pgup":
+		v.move(-memoryViewPage)
+	case "pgdown":
+		v.move(memoryViewPage)
+	case "enter":
+		v.follow = followNothing
+		v.editing = true
+	default:
+		// While searching, keys the viewer doesn't use still don't reach the keypad
+		return v.searching
+	}
+	chip8.updateMemoryViewer()
+	return true
+}
+
+// memorySearchKey handles a key in search mode, and reports whether it used it.
+// Each filter compares memory with the last snapshot and then takes a new one:
+//
+//	s  start over        e  unchanged   c  changed
+//	i  increased         d  decreased   =  equal to a hex value
+//	n  next candidate    f  freeze or thaw the selected byte
+func (chip8 *CHIP8) memorySearchKey(key string) bool {
+	v := &chip8.memview
+	if v.searchingValue {
+		switch {
+		case key == "enter" || key == "esc":
+			v.searchingValue, v.digits = false, ""
+		case len(key) == 1 && strings.Contains("0123456789abcdef", key):
+			v.digits += key
+			if len(v.digits) == 2 {
+				value, _ := strconv.ParseUint(v.digits, 16, 8)
+				v.searchingValue, v.digits = false, ""
+				chip8.filterMemorySearch(fmt.Sprintf("Equal to %02X", value), SearchValue(byte(value)))
+			}
+		}
+		return true
+	}
+
+	switch key {
+	case "/", "enter", "esc":
+		v.searching = false
+		chip8.notify("Search kept, press / to resume")
+	case "s":
+		v.search = NewMemorySearch(&chip8.memory)
+		chip8.notify("New search of %d addresses", len(v.search.candidates))
+	case "e":
+		chip8.filterMemorySearch("Unchanged", SearchEqual)
+	case "c":
+		chip8.filterMemorySearch("Changed", SearchChanged)
+	case "i":
+		chip8.filterMemorySearch("Increased", SearchIncreased)
+	case "d":
+		chip8.filterMemorySearch("Decreased", SearchDecreased)
+	case "=":
+		v.searchingValue = true
+	case "n":
+		chip8.nextSearchCandidate()
+	case "f":
+		chip8.toggleFreeze(v.cursor)
+	default:
+		return false
+	}
+	return true
+}
+
+func (chip8 *CHIP8) filterMemorySearch(name string, keep func(before, now byte) bool) {
+	search := chip8.memview.search
+	search.Filter(&chip8.memory, keep)
+	chip8.notify("%s: %d candidates", name, len(search.candidates))
+	if len(search.candidates) > 0 {
+		chip8.nextSearchCandidate()
+	}
+}
+
+// nextSearchCandidate moves the cursor to the next candidate after it, wrapping
+// around to the first.
+func (chip8 *CHIP8) nextSearchCandidate() {
+	v := &chip8.memview
+	candidates := v.search.candidates
+	if len(candidates) == 0 {
+		return
+	}
+	i, found := slices.BinarySearch(candidates, v.cursor+1)
+	if !found && i == len(candidates) {
+		i = 0
+	}
+	v.move(int(candidates[i]) - int(v.cursor))
+	chip8.updateMemoryViewer()
+}
+
+// ebitenKeyName names a key like BubbleTea does, for the memory viewer.
+func ebitenKeyName(key ebiten.Key) string {
+	switch {
+	case key >= ebiten.KeyDigit0 && key <= ebiten.KeyDigit9:
+		return string(rune('0' + key - ebiten.KeyDigit0))
+	case key >= ebiten.KeyNumpad0 && key <= ebiten.KeyNumpad9:
+		return string(rune('0' + key - ebiten.KeyNumpad0))
+	case key >= ebiten.KeyA && key <= ebiten.KeyZ:
+		return string(rune('a' + key - ebiten.KeyA))
+	}
+	switch key {
+	case ebiten.KeySlash:
+		return "/"
+	case ebiten.KeyComma:
+		return ","
+	case ebiten.KeyPeriod:
+		return "."
+	case ebiten.KeyEqual:
+		return "="
+	case ebiten.KeyF3:
+		return "f3"
+	case ebiten.KeyF4:
+		return "f4"
+	case ebiten.KeyF10:
+		return "f10"
+	case ebiten.KeyArrowUp:
+		return "up"
+	case ebiten.KeyArrowDown:
+		return "down"
+	case ebiten.KeyArrowLeft:
+		return "left"
+	case ebiten.KeyArrowRight:
+		return "right"
+	case ebiten.KeyPageUp:
+		return "pgup"
+	case ebiten.KeyPageDown:
+		return "pgdown"
+	case ebiten.KeyEnter, ebiten.KeyNumpadEnter:
+		return "enter"
+	case ebiten.KeyEscape:
+		return "esc"
+	}
+	return ""
+}
+
+// memoryViewHeader describes what the viewer is showing.
+func (chip8 *CHIP8) memoryViewHeader() string {
+	v := &chip8.memview
+	header := fmt.Sprintf("Memory %04X-%04X  following %s", v.top, v.top+memoryViewPage-1, v.follow)
+	switch {
+	case v.editing:
+		header += fmt.Sprintf("  %04X = %-2s", v.cursor, v.digits+"_")
+	case v.searchingValue:
+		header += fmt.Sprintf("  find = %-2s", v.digits+"_")
+	case v.searching:
+		header += fmt.Sprintf("  search: %d", len(v.search.candidates))
+	}
+	return header
+}
+
+// memoryViewLine is the text of a row of the hex view.
+func (chip8 *CHIP8) memoryViewLine(row uint16) string {
+	var hex, text strings.Builder
+	for addr := row; addr < row+memoryViewColumns; addr++ {
+		fmt.Fprintf(&hex, " %02X", chip8.memory[addr])
+		text.WriteByte(printable(chip8.memory[addr]))
+	}
+	return fmt.Sprintf("%04X %s  %s", row, hex.String(), text.String())
+}
+
+// Where a byte's hex digits and character are in a line of the hex view
+func memoryViewHexColumn(i int) int  { return 6 + i*3 }
+func memoryViewTextColumn(i int) int { return 6 + memoryViewColumns*3 + 1 + i }
+
+// memoryViewHighlight picks the color to mark a byte with, if any: the cursor,
+// recent writes, frozen bytes, search candidates, PC and I, in that order.
+func (chip8 *CHIP8) memoryViewHighlight(addr uint16) (lipgloss.Color, bool) {
+	v := &chip8.memview
+	switch {
+	case addr == v.cursor:
+		return Colors["Text"], true
+	case v.recentlyWritten(addr):
+		return Colors["Love"], true
+	case chip8.frozen(addr):
+		return Colors["Pine"], true
+	case v.candidate(addr):
+		return Colors["Iris"], true
+	case addr == chip8.pc || addr == chip8.pc+1:
+		return Colors["Foam"], true
+	case addr == chip8.I:
+		return Colors["Gold"], true
+	}
+	return "", false
+}
+
+// memoryViewText renders the viewer as terminal text.
+func (chip8 *CHIP8) memoryViewText() string {
+	chip8.updateMemoryViewer()
+	v := &chip8.memview
+	muted := lipgloss.NewStyle().Foreground(Colors["Muted"])
+
+	var view strings.Builder
+	view.WriteString(chip8.memoryViewHeader() + "\n")
+	if v.sprites {
+		for band := 0; band < memoryViewPage/(spriteViewColumns*spriteViewHeight); band++ {
+			start := v.top + uint16(band*spriteViewColumns*spriteViewHeight)
+			view.WriteString(muted.Render(fmt.Sprintf("%04X", start)) + "\n")
+			// Two rows of pixels per line
+			for y := 0; y < spriteViewHeight; y += 2 {
+				for column := 0; column < spriteViewColumns; column++ {
+					addr := start + uint16(column*spriteViewHeight+y)
+					top, bottom := chip8.memory[addr], chip8.memory[addr+1]
+					for bit := 7; bit >= 0; bit-- {
+						view.WriteString(halfBlock(top>>bit&1 == 1, bottom>>bit&1 == 1))
+					}
+					view.WriteString(" ")
+				}
+				view.WriteString("\n")
+			}
+		}
+		return strings.TrimSuffix(view.String(), "\n")
+	}
+
+	for row := v.top; row < v.top+memoryViewPage; row += memoryViewColumns {
+		view.WriteString(muted.Render(fmt.Sprintf("%04X", row)) + " ")
+		var text strings.Builder
+		for i := 0; i < memoryViewColumns; i++ {
+			addr := row + uint16(i)
+			hex, char := fmt.Sprintf("%02X", chip8.memory[addr]), string(printable(chip8.memory[addr]))
+			if c, ok := chip8.memoryViewHighlight(addr); ok {
+				style := lipgloss.NewStyle().Foreground(Colors["Base"]).Background(c)
+				hex, char = style.Render(hex), style.Render(char)
+			}
+			view.WriteString(" " + hex)
+			text.WriteString(char)
+		}
+		view.WriteString("  " + text.String() + "\n")
+	}
+	return strings.TrimSuffix(view.String(), "\n")
+}
+
+// printable is the byte as an ASCII character, or a dot.
+func printable(b byte) byte {
+	if b >= 0x20 && b < 0x7F {
+		return b
+	}
+	return '.'
+}
+
+func halfBlock(top, bottom bool) string {
+	switch {
+	case top && bottom:
+		return "█"
+	case top:
+		return "▀"
+	case bottom:
+		return "▄"
+	}
+	return " "
+}
+
+// drawMemoryViewer overlays the viewer in the top right of the window.
+func (chip8 *CHIP8) drawMemoryViewer(screen *ebiten.Image) {
+	if !chip8.memview.open {
+		return
+	}
+	chip8.updateMemoryViewer()
+	v := &chip8.memview
+
+	// The debug font is 6x16 pixels per character
+	const charWidth, lineHeight, spriteScale = 6, 16, 3
+	width := len(chip8.memoryViewLine(0))*charWidth + 8
+	height := (memoryViewRows+1)*lineHeight + 4
+	left := float32(screen.Bounds().Dx() - width)
+	vector.DrawFilledRect(screen, left, 0, float32(width), float32(height), color.RGBA{0, 0, 0, 0xC0}, false)
+	ebitenutil.DebugPrintAt(screen, chip8.memoryViewHeader(), int(left)+4, 2)
+
+	if v.sprites {
+		on := toRGBA(chip8.display.palette[1])
+		off := toRGBA(chip8.display.palette[0])
+		bandHeight := spriteViewHeight*spriteScale + lineHeight
+		for band := 0; band < memoryViewPage/(spriteViewColumns*spriteViewHeight); band++ {
+			start := v.top + uint16(band*spriteViewColumns*spriteViewHeight)
+			y0 := lineHeight + 4 + band*bandHeight
+			ebitenutil.DebugPrintAt(screen, fmt.Sprintf("%04X", start), int(left)+4, y0)
+			for column := 0; column < spriteViewColumns; column++ {
+				x0 := left + 4 + float32(column*(8*spriteScale+6))
+				for y := 0; y < spriteViewHeight; y++ {
+					addr := start + uint16(column*spriteViewHeight+y)
+					for bit := 0; bit < 8; bit++ {
+						c := off
+						if chip8.memory[addr]>>(7-bit)&1 == 1 {
+							c = on
+						}
+						if addr == v.cursor {
+							c = blendColors(c, toRGBA(Colors["Love"]), 0x80)
+						}
+						vector.DrawFilledRect(screen, x0+float32(bit*spriteScale), float32(y0+lineHeight+y*spriteScale), spriteScale, spriteScale, c, false)
+					}
+				}
+			}
+		}
+		return
+	}
+
+	for r := 0; r < memoryViewRows; r++ {
+		row := v.top + uint16(r*memoryViewColumns)
+		y := (r+1)*lineHeight + 2
+		for i := 0; i < memoryViewColumns; i++ {
+			c, ok := chip8.memoryViewHighlight(row + uint16(i))
+			if !ok {
+				continue
+			}
+			highlight := toRGBA(c)
+			highlight.A = 0x90
+			x := left + 4 + float32(memoryViewHexColumn(i)*charWidth)
+			vector.DrawFilledRect(screen, x, float32(y), 2*charWidth, lineHeight, highlight, false)
+			x = left + 4 + float32(memoryViewTextColumn(i)*charWidth)
+			vector.DrawFilledRect(screen, x, float32(y), charWidth, lineHeight, highlight, false)
+		}
+		ebitenutil.DebugPrintAt(screen, chip8.memoryViewLine(row), int(left)+4, y)
+	}
+}
@@ -0,0 +1,45 @@
+package interpreter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMemoryViewer(t *testing.T) {
+	program := []byte{
+		0xA3, 0x00, // 200: LD I, 0x300
+		0x60, 0x7B, // 202: LD V0, 0x7B
+		0xF0, 0x33, // 204: LD B, V0
+		0x12, 0x06, // 206: JP 0x206
+	}
+	chip8 := NewCHIP8(&program, DefaultCHIP8Options())
+	for _, key := range []string{"f3", "f4"} {
+		if !chip8.memoryViewerKey(key) {
+			t.Fatalf("Expected the viewer to use %s", key)
+		}
+	}
+	chip8.RunFrame()
+	chip8.updateMemoryViewer()
+
+	v := &chip8.memview
+	if v.cursor != 0x300 || v.top != 0x2C0 {
+		t.Errorf("Expected to follow I to 0x300 with context above, got cursor %04X top %04X", v.cursor, v.top)
+	}
+	if !v.recentlyWritten(0x302) || v.recentlyWritten(0x303) {
+		t.Error("Expected only the BCD digits to be highlighted as written")
+	}
+	if line := chip8.memoryViewLine(0x300); !strings.HasPrefix(line, "0300  01 02 03 00") {
+		t.Errorf("Expected the BCD digits in the view, got %q", line)
+	}
+
+	// Poke two bytes, ignoring keys that aren't hex digits
+	for _, key := range []string{"right", "enter", "4", "q", "1", "f", "f", "esc"} {
+		chip8.memoryViewerKey(key)
+	}
+	if chip8.memory[0x301] != 0x41 || chip8.memory[0x302] != 0xFF || v.editing || v.cursor != 0x303 {
+		t.Errorf("Expected 41 FF poked at 0x301, got % X with cursor at %04X", chip8.memory[0x301:0x303], v.cursor)
+	}
+	if chip8.memoryViewerKey("a") {
+		t.Error("Expected keypad keys to go to the program when not editing")
+	}
+}
@@ -0,0 +1,254 @@
+package interpreter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Bumped whenever the netplay messages change, so mismatched players find out
+// before they desync
+const netplayVersion = 1
+
+// How long to wait on the other player before saying so
+const netplayWaitNotice = time.Second
+
+// Netplay keeps interpreters on two machines in lockstep. A frame only runs once
+// both players' keys for it are known, so both machines run the same frames with
+// the same keys and the same random numbers. Keys are sent Delay frames ahead of
+// when they're used, to hide the time they take to arrive.
+type Netplay struct {
+	chip8   *CHIP8
+	conn    io.ReadWriteCloser
+	encoder *json.Encoder
+	decoder *json.Decoder
+	hello   netplayHello
+
+	// The next frame to run
+	frame uint64
+	// Local keys by frame, kept until the frame runs
+	local map[uint64]Action
+	// State hashes after each frame, kept until the other player's arrives, and
+	// the latest, to send them
+	hashes   map[uint64]uint64
+	lastHash uint64
+	// The frame was held up since then, waiting for the other player
+	waitingSince time.Time
+	noticeShown  bool
+
+	// Shared with the goroutine reading from the other player
+	mu           sync.Mutex
+	remote       map[uint64]Action
+	remoteHashes map[uint64]uint64
+	err          error
+}
+
+// netplayHello is what the host tells a joining player about the game.
+type netplayHello struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Program []byte `json:"program"`
+	// Seeds CXNN on both machines
+	Seed             int64        `json:"seed"`
+	Delay            int          `json:"delay"`
+	Quirks           COSMACQuirks `json:"quirks"`
+	InstructionLimit int          `json:"instruction_limit"`
+}
+
+// netplayInput is the keys a player holds for a frame, along with the state hash
+// after an earlier frame, if any, to catch the machines drifting apart.
+type netplayInput struct {
+	Frame  uint64 `json:"frame"`
+	Keys   Action `json:"keys"`
+	Hashed uint64 `json:"hashed,omitempty"`
+	Hash   uint64 `json:"hash,omitempty"`
+}
+
+// ErrDesync means the two machines ended up in different states, so they're no
+// longer playing the same game.
+var ErrDesync = errors.New("the game desynced")
+
+func newNetplay(conn io.ReadWriteCloser) *Netplay {
+	return &Netplay{
+		conn:         conn,
+		encoder:      json.NewEncoder(conn),
+		decoder:      json.NewDecoder(conn),
+		local:        map[uint64]Action{},
+		hashes:       map[uint64]uint64{},
+		remote:       map[uint64]Action{},
+		remoteHashes: map[uint64]uint64{},
+	}
+}
+
+// HostNetplay starts a game with a player who connected, sending them the ROM
+// and how to run it. Keys are delayed by delay frames.
+func HostNetplay(chip8 *CHIP8, conn io.ReadWriteCloser, rom Rom, delay int) (*Netplay, error) {
+	n := newNetplay(conn)
+	n.hello = netplayHello{
+		Version:          netplayVersion,
+		Name:             rom.Name,
+		Program:          rom.Program,
+		Seed:             time.Now().UnixNano(),
+		Delay:            max(delay, 0),
+		Quirks:           chip8.Options.CosmacQuirks,
+		InstructionLimit: chip8.Options.InstructionLimit,
+	}
+	if err := n.encoder.Encode(n.hello); err != nil {
+		return nil, err
+	}
+	n.Attach(chip8)
+	return n, nil
+}
+
+// JoinNetplay joins a hosted game, returning the ROM to create an interpreter
+// for. Attach it to start playing.
+func JoinNetplay(conn io.ReadWriteCloser) (*Netplay, Rom, error) {
+	n := newNetplay(conn)
+	if err := n.decoder.Decode(&n.hello); err != nil {
+		return nil, Rom{}, fmt.Errorf("not a CHIP-8 host: %w", err)
+	}
+	if n.hello.Version != netplayVersion {
+		return nil, Rom{}, fmt.Errorf("the host plays netplay version %d, this is version %d", n.hello.Version, netplayVersion)
+	}
+	return n, Rom{Name: n.hello.Name, Program: n.hello.Program}, nil
+}
+
+// Attach starts playing on the interpreter, from power on. The host's quirks
+// replace the interpreter's, since they change how the program runs.
+func (n *Netplay) Attach(chip8 *CHIP8) {
+	n.chip8 = chip8
+	chip8.Options.CosmacQuirks = n.hello.Quirks
+	chip8.Options.InstructionLimit = n.hello.InstructionLimit
+	chip8.Reset()
+	chip8.Seed(n.hello.Seed)
+	chip8.Netplay = n
+	// Nobody holds anything before the first keys arrive
+	for frame := uint64(0); frame < uint64(n.hello.Delay); frame++ {
+		n.local[frame] = 0
+		n.remote[frame] = 0
+	}
+	go n.read()
+}
+
+// Close leaves the game.
+func (n *Netplay) Close() error {
+	return n.conn.Close()
+}
+
+// Err is why the game stopped, if it did.
+func (n *Netplay) Err() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.err
+}
+
+func (n *Netplay) fail(err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.err == nil {
+		n.err = err
+	}
+}
+
+// read takes in the other player's keys and hashes as they arrive.
+func (n *Netplay) read() {
+	for {
+		var input netplayInput
+		if err := n.decoder.Decode(&input); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = errors.New("the other player left")
+			}
+			n.fail(err)
+			return
+		}
+		n.mu.Lock()
+		n.remote[input.Frame] = input.Keys
+		if input.Hashed > 0 {
+			n.remoteHashes[input.Hashed] = input.Hash
+		}
+		n.mu.Unlock()
+	}
+}
+
+// tick runs the next frame if the other player's keys for it are in, in place of
+// the usual frontend update. Each tick runs at most one frame, so frontends
+// should tick 60 times a second.
+func (n *Netplay) tick() {
+	chip8 := n.chip8
+	if err := n.Err(); err != nil {
+		// Keep the reason on screen
+		if chip8.notification() == "" {
+			chip8.notify("Netplay stopped: %v", err)
+		}
+		chip8.silence()
+		return
+	}
+
+	// Send the keys held now, for the frame they'll be used in
+	target := n.frame + uint64(n.hello.Delay)
+	if _, sent := n.local[target]; !sent {
+		input := netplayInput{Frame: target, Keys: actionOf(chip8.pressedKeys)}
+		if n.frame > 0 {
+			input.Hashed, input.Hash = n.frame, n.lastHash
+		}
+		if err := n.encoder.Encode(input); err != nil {
+			n.fail(err)
+			return
+		}
+		n.local[target] = input.Keys
+	}
+
+	n.mu.Lock()
+	remote, ready := n.remote[n.frame]
+	delete(n.remote, n.frame)
+	n.mu.Unlock()
+	if !ready {
+		if n.waitingSince.IsZero() {
+			n.waitingSince = time.Now()
+		} else if !n.noticeShown && time.Since(n.waitingSince) > netplayWaitNotice {
+			chip8.notify("Waiting for the other player")
+			n.noticeShown = true
+		}
+		return
+	}
+	n.waitingSince, n.noticeShown = time.Time{}, false
+
+	// Run the frame with everyone's keys, then go back to the local keys so the
+	// frontend keeps track of them as usual
+	held := chip8.pressedKeys
+	chip8.pressedKeys = (n.local[n.frame] | remote).keys()
+	chip8.dirtyKeys = true
+	chip8.RunFrame()
+	chip8.pressedKeys = held
+	if chip8.soundTimer > 0 {
+		chip8.playBeep()
+	} else {
+		chip8.silence()
+	}
+	delete(n.local, n.frame)
+	n.frame++
+
+	n.lastHash = chip8.SaveState().Hash()
+	n.hashes[n.frame] = n.lastHash
+	n.checkSync()
+}
+
+// checkSync compares state hashes after the frames both players have run.
+func (n *Netplay) checkSync() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for frame, theirs := range n.remoteHashes {
+		ours, ok := n.hashes[frame]
+		if !ok {
+			continue
+		}
+		if ours != theirs && n.err == nil {
+			n.err = fmt.Errorf("%w after frame %d", ErrDesync, frame)
+		}
+		delete(n.hashes, frame)
+		delete(n.remoteHashes, frame)
+	}
+}
@@ -0,0 +1,114 @@
+package interpreter
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// startNetplay hosts pointsProgram and joins it over loopback.
+func startNetplay(t *testing.T, delay int) (host, guest *CHIP8) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	joined := make(chan *CHIP8)
+	go func() {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Error(err)
+			close(joined)
+			return
+		}
+		n, rom, err := JoinNetplay(conn)
+		if err != nil {
+			t.Error(err)
+			close(joined)
+			return
+		}
+		guest := NewCHIP8(&rom.Program, DefaultCHIP8Options())
+		n.Attach(guest)
+		joined <- guest
+	}()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := DefaultCHIP8Options()
+	options.CosmacQuirks.EnableAll()
+	host = NewCHIP8(&pointsProgram, options)
+	if _, err := HostNetplay(host, conn, Rom{Name: "points.ch8", Program: pointsProgram}, delay); err != nil {
+		t.Fatal(err)
+	}
+	guest = <-joined
+	if guest == nil {
+		t.FailNow()
+	}
+	t.Cleanup(func() {
+		host.Netplay.Close()
+		guest.Netplay.Close()
+	})
+	return host, guest
+}
+
+// tickUntil ticks both machines until they've run a number of frames, or one
+// stops.
+func tickUntil(t *testing.T, frames uint64, host, guest *CHIP8) {
+	deadline := time.Now().Add(5 * time.Second)
+	for host.Netplay.frame < frames || guest.Netplay.frame < frames {
+		if host.Netplay.Err() != nil || guest.Netplay.Err() != nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out at frames %d and %d", host.Netplay.frame, guest.Netplay.frame)
+		}
+		if host.Netplay.frame < frames {
+			host.tick()
+		}
+		if guest.Netplay.frame < frames {
+			guest.tick()
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestNetplayLockstep(t *testing.T) {
+	host, guest := startNetplay(t, 2)
+	if !guest.Options.CosmacQuirks.IncrementI {
+		t.Error("Expected the guest to use the host's quirks")
+	}
+
+	// Only the guest holds key 5, so the points come from the guest's keys
+	guest.pressedKeys = []byte{5}
+	tickUntil(t, 12, host, guest)
+	guest.pressedKeys = nil
+	tickUntil(t, 20, host, guest)
+	for _, chip8 := range []*CHIP8{host, guest} {
+		if err := chip8.Netplay.Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Keys held for frames 0-11 land on frames 2-13, and the game checks them
+	// every other frame
+	if points := host.memory[0x301]; points != 6 {
+		t.Errorf("Expected 6 points on the host, got %d", points)
+	}
+	if host.SaveState().Hash() != guest.SaveState().Hash() || host.memory[0x302] != guest.memory[0x302] {
+		t.Error("Expected both machines in the same state, random numbers included")
+	}
+}
+
+func TestNetplayDesync(t *testing.T) {
+	host, guest := startNetplay(t, 0)
+	tickUntil(t, 2, host, guest)
+	guest.memory[0x400] = 1
+	tickUntil(t, 10, host, guest)
+	if err := host.Netplay.Err(); !errors.Is(err, ErrDesync) {
+		t.Errorf("Expected the host to notice the desync, got %v", err)
+	}
+}
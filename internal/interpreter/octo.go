@@ -0,0 +1,817 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// assembleOcto assembles Octo source, the language Octo cartridges hold, into a
+// program. It understands Octo's instructions, labels, control structures,
+// :alias, :const, :calc, :macro and the other directives real programs use, but
+// not :stringmode.
+// https://github.com/JohnEarnest/Octo/blob/gh-pages/docs/Manual.md
+func assembleOcto(source string) (program []byte, err error) {
+	a := &octoAssembler{
+		tokens:    tokenizeOcto(source),
+		here:      programStartAddress,
+		labels:    map[string]int{},
+		constants: map[string]float64{},
+		aliases:   map[string]int{},
+		macros:    map[string]*octoMacro{},
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(octoError)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+
+	// Programs start with a jump to main, unless main comes first
+	a.address(0x1000, octoToken{text: "main"})
+	a.mainJump = true
+	for a.pos < len(a.tokens) {
+		a.statement()
+	}
+	if len(a.flow) > 0 {
+		top := a.flow[len(a.flow)-1]
+		a.fail(top.token, "%s is never closed", top.token.text)
+	}
+	for _, fixup := range a.fixups {
+		a.resolve(fixup)
+	}
+	return a.rom, nil
+}
+
+// octoToken is a word of Octo source, and the line it's on for errors.
+type octoToken struct {
+	text string
+	line int
+}
+
+func tokenizeOcto(source string) []octoToken {
+	var tokens []octoToken
+	for n, line := range strings.Split(source, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			text := fields[i]
+			// Strings may hold spaces
+			for strings.HasPrefix(text, `"`) && (len(text) == 1 || !strings.HasSuffix(text, `"`)) && i+1 < len(fields) {
+				i++
+				text += " " + fields[i]
+			}
+			tokens = append(tokens, octoToken{text: text, line: n + 1})
+		}
+	}
+	return tokens
+}
+
+type octoError struct {
+	line    int
+	message string
+}
+
+func (e octoError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.line, e.message)
+}
+
+type octoMacro struct {
+	params []string
+	body   []octoToken
+	calls  int
+}
+
+// octoFlow is an open control structure: a loop, or an if ... begin.
+type octoFlow struct {
+	token octoToken
+	// Where the loop starts, or the jump to patch when the block ends
+	addr int
+	// Jumps out of the loop from its whiles
+	breaks []int
+}
+
+// How a label used before it's defined is filled in
+type octoFixupKind int
+
+const (
+	// The low 12 bits of the instruction
+	fixupAddress octoFixupKind = iota
+	// The 16 bits after i := long
+	fixupLong
+	// The bytes of the two instructions :unpack makes
+	fixupUnpack
+)
+
+type octoFixup struct {
+	addr  int
+	token octoToken
+	kind  octoFixupKind
+}
+
+type octoAssembler struct {
+	tokens []octoToken
+	pos    int
+
+	rom  []byte
+	here int
+
+	labels    map[string]int
+	constants map[string]float64
+	aliases   map[string]int
+	macros    map[string]*octoMacro
+	fixups    []octoFixup
+	flow      []*octoFlow
+	// The jump to main at the start is still there
+	mainJump bool
+}
+
+func (a *octoAssembler) fail(token octoToken, format string, args ...any) {
+	panic(octoError{line: token.line, message: fmt.Sprintf(format, args...)})
+}
+
+func (a *octoAssembler) next() octoToken {
+	if a.pos >= len(a.tokens) {
+		line := 0
+		if len(a.tokens) > 0 {
+			line = a.tokens[len(a.tokens)-1].line
+		}
+		a.fail(octoToken{line: line}, "unexpected end of program")
+	}
+	a.pos++
+	return a.tokens[a.pos-1]
+}
+
+func (a *octoAssembler) peek() string {
+	if a.pos >= len(a.tokens) {
+		return ""
+	}
+	return a.tokens[a.pos].text
+}
+
+func (a *octoAssembler) expect(text string) {
+	if token := a.next(); token.text != text {
+		a.fail(token, "expected %s, got %q", text, token.text)
+	}
+}
+
+// emit writes bytes at the current address.
+func (a *octoAssembler) emit(token octoToken, data ...byte) {
+	for _, b := range data {
+		if a.here < programStartAddress || a.here >= memorySize {
+			a.fail(token, "address %#x is outside the program", a.here)
+		}
+		i := a.here - programStartAddress
+		for len(a.rom) <= i {
+			a.rom = append(a.rom, 0)
+		}
+		a.rom[i] = b
+		a.here++
+	}
+}
+
+func (a *octoAssembler) inst(token octoToken, op int) {
+	a.emit(token, byte(op>>8), byte(op))
+}
+
+func (a *octoAssembler) statement() {
+	token := a.next()
+	if macro, ok := a.macros[token.text]; ok {
+		a.expand(token, macro)
+		return
+	}
+	if x, ok := a.register(token.text); ok {
+		a.assignment(token, x)
+		return
+	}
+
+	switch token.text {
+	case ":":
+		a.label(a.next(), 0)
+	case ":next":
+		a.label(a.next(), 1)
+	case ":alias":
+		name, register := a.next(), a.next()
+		x, ok := a.register(register.text)
+		if !ok {
+			a.fail(register, "expected a register, got %q", register.text)
+		}
+		a.aliases[name.text] = x
+	case ":const":
+		name := a.next()
+		a.define(name, float64(a.value(a.next())))
+	case ":calc":
+		name := a.next()
+		a.expect("{")
+		a.define(name, a.calc())
+	case ":byte":
+		a.emit(token, a.byteValue())
+	case ":org":
+		a.here = a.value(a.next())
+	case ":call":
+		a.address(0x2000, a.next())
+	case ":unpack":
+		a.unpack(token)
+	case ":macro":
+		a.macro()
+	case ":breakpoint":
+		a.next()
+	case ":monitor":
+		a.next()
+		a.next()
+	case ":assert":
+		message := "assertion failed"
+		if strings.HasPrefix(a.peek(), `"`) {
+			message = strings.Trim(a.next().text, `"`)
+		}
+		a.expect("{")
+		if a.calc() == 0 {
+			a.fail(token, "%s", message)
+		}
+
+	case "clear":
+		a.inst(token, 0x00E0)
+	case "return", ";":
+		a.inst(token, 0x00EE)
+	case "scroll-down":
+		a.inst(token, 0x00C0|a.nibble())
+	case "scroll-up":
+		a.inst(token, 0x00D0|a.nibble())
+	case "scroll-right":
+		a.inst(token, 0x00FB)
+	case "scroll-left":
+		a.inst(token, 0x00FC)
+	case "exit":
+		a.inst(token, 0x00FD)
+	case "lores":
+		a.inst(token, 0x00FE)
+	case "hires":
+		a.inst(token, 0x00FF)
+	case "jump":
+		a.address(0x1000, a.next())
+	case "jump0":
+		a.address(0xB000, a.next())
+	case "native":
+		a.address(0x0000, a.next())
+	case "sprite":
+		x, y := a.nextRegister(), a.nextRegister()
+		a.inst(token, 0xD000|x<<8|y<<4|a.nibble())
+	case "bcd":
+		a.inst(token, 0xF033|a.nextRegister()<<8)
+	case "save", "load":
+		x := a.nextRegister()
+		if a.peek() == "-" {
+			a.next()
+			y := a.nextRegister()
+			a.inst(token, map[string]int{"save": 0x5002, "load": 0x5003}[token.text]|x<<8|y<<4)
+		} else {
+			a.inst(token, map[string]int{"save": 0xF055, "load": 0xF065}[token.text]|x<<8)
+		}
+	case "saveflags":
+		a.inst(token, 0xF075|a.nextRegister()<<8)
+	case "loadflags":
+		a.inst(token, 0xF085|a.nextRegister()<<8)
+	case "delay", "buzzer", "pitch":
+		a.expect(":=")
+		a.inst(token, map[string]int{"delay": 0xF015, "buzzer": 0xF018, "pitch": 0xF03A}[token.text]|a.nextRegister()<<8)
+	case "plane":
+		a.inst(token, 0xF001|a.nibble()<<8)
+	case "audio":
+		a.inst(token, 0xF002)
+	case "i":
+		a.index()
+
+	case "if":
+		a.conditional(token)
+	case "else":
+		block := a.block(token, "if")
+		jump := a.here
+		a.inst(token, 0x1000)
+		a.patch(block.addr, a.here)
+		block.addr = jump
+		block.token = token
+	case "end":
+		block := a.block(token, "if")
+		a.flow = a.flow[:len(a.flow)-1]
+		a.patch(block.addr, a.here)
+	case "loop":
+		a.flow = append(a.flow, &octoFlow{token: token, addr: a.here})
+	case "while":
+		loop := a.loop(token)
+		a.skip(a.condition(true))
+		loop.breaks = append(loop.breaks, a.here)
+		a.inst(token, 0x1000)
+	case "again":
+		loop := a.loop(token)
+		if a.flow[len(a.flow)-1] != loop {
+			a.fail(token, "again before the end of an if")
+		}
+		a.flow = a.flow[:len(a.flow)-1]
+		a.inst(token, 0x1000|loop.addr)
+		for _, jump := range loop.breaks {
+			a.patch(jump, a.here)
+		}
+
+	default:
+		if _, err := parseOctoNumber(token.text); err == nil || token.text == "{" {
+			a.pos--
+			a.emit(token, a.byteValue())
+			return
+		}
+		if strings.HasPrefix(token.text, ":") {
+			a.fail(token, "%s isn't supported", token.text)
+		}
+		// Anything else is a subroutine to call
+		a.address(0x2000, token)
+	}
+}
+
+// label names the current address, plus offset.
+func (a *octoAssembler) label(name octoToken, offset int) {
+	if name.text == "main" && a.mainJump && a.here == programStartAddress+2 && offset == 0 {
+		// Main comes first, so it doesn't need jumping to
+		a.mainJump = false
+		a.rom, a.here = nil, programStartAddress
+		a.fixups = a.fixups[1:]
+	}
+	if _, ok := a.labels[name.text]; ok {
+		a.fail(name, "label %q is defined twice", name.text)
+	}
+	a.labels[name.text] = a.here + offset
+}
+
+func (a *octoAssembler) define(name octoToken, value float64) {
+	if _, ok := a.labels[name.text]; ok {
+		a.fail(name, "%q is already a label", name.text)
+	}
+	a.constants[name.text] = value
+}
+
+// register reads a register, like v3 or vA, or an alias for one.
+func (a *octoAssembler) register(text string) (int, bool) {
+	if x, ok := a.aliases[text]; ok {
+		return x, true
+	}
+	if len(text) == 2 && (text[0] == 'v' || text[0] == 'V') {
+		if x, err := strconv.ParseUint(text[1:], 16, 4); err == nil {
+			return int(x), true
+		}
+	}
+	return 0, false
+}
+
+func (a *octoAssembler) nextRegister() int {
+	token := a.next()
+	x, ok := a.register(token.text)
+	if !ok {
+		a.fail(token, "expected a register, got %q", token.text)
+	}
+	return x
+}
+
+func parseOctoNumber(text string) (int, error) {
+	digits, negative := strings.CutPrefix(text, "-")
+	base := 10
+	if rest, ok := strings.CutPrefix(strings.ToLower(digits), "0x"); ok {
+		digits, base = rest, 16
+	} else if rest, ok := strings.CutPrefix(strings.ToLower(digits), "0b"); ok {
+		digits, base = rest, 2
+	}
+	value, err := strconv.ParseInt(digits, base, 32)
+	if negative {
+		value = -value
+	}
+	return int(value), err
+}
+
+// lookup finds the value of a number, constant or label defined so far.
+func (a *octoAssembler) lookup(text string) (float64, bool) {
+	if value, err := parseOctoNumber(text); err == nil {
+		return float64(value), true
+	}
+	if value, ok := a.constants[text]; ok {
+		return value, true
+	}
+	if addr, ok := a.labels[text]; ok {
+		return float64(addr), true
+	}
+	return 0, false
+}
+
+// value reads a number, constant or label that's already defined, or a { ... }
+// expression.
+func (a *octoAssembler) value(token octoToken) int {
+	if token.text == "{" {
+		return int(a.calc())
+	}
+	value, ok := a.lookup(token.text)
+	if !ok {
+		a.fail(token, "undefined name %q", token.text)
+	}
+	return int(value)
+}
+
+func (a *octoAssembler) byteValue() byte {
+	token := a.next()
+	value := a.value(token)
+	if value < -128 || value > 0xFF {
+		a.fail(token, "%d doesn't fit in a byte", value)
+	}
+	return byte(value)
+}
+
+func (a *octoAssembler) nibble() int {
+	token := a.next()
+	value := a.value(token)
+	if value < 0 || value > 0xF {
+		a.fail(token, "%d doesn't fit in a nibble", value)
+	}
+	return value
+}
+
+// address writes an instruction taking a 12 bit address, which may be a label
+// defined later.
+func (a *octoAssembler) address(op int, token octoToken) {
+	value, ok := a.lookup(token.text)
+	if token.text == "{" {
+		value, ok = a.calc(), true
+	}
+	if !ok {
+		a.fixups = append(a.fixups, octoFixup{addr: a.here, token: token, kind: fixupAddress})
+	} else if value < 0 || value > 0xFFF {
+		a.fail(token, "address %#x is out of range", int(value))
+	}
+	a.inst(token, op|int(value))
+}
+
+// resolve fills in a label used before it was defined.
+func (a *octoAssembler) resolve(fixup octoFixup) {
+	addr, ok := a.labels[fixup.token.text]
+	if !ok {
+		a.fail(fixup.token, "undefined name %q", fixup.token.text)
+	}
+	i := fixup.addr - programStartAddress
+	switch fixup.kind {
+	case fixupAddress:
+		if addr > 0xFFF {
+			a.fail(fixup.token, "address %#x is out of range", addr)
+		}
+		a.rom[i] |= byte(addr >> 8)
+		a.rom[i+1] = byte(addr)
+	case fixupLong:
+		a.rom[i], a.rom[i+1] = byte(addr>>8), byte(addr)
+	case fixupUnpack:
+		a.rom[i+1] |= byte(addr >> 8)
+		a.rom[i+3] = byte(addr)
+	}
+}
+
+// patch points the jump at addr to target.
+func (a *octoAssembler) patch(addr, target int) {
+	i := addr - programStartAddress
+	a.rom[i] = a.rom[i]&0xF0 | byte(target>>8)&0x0F
+	a.rom[i+1] = byte(target)
+}
+
+// assignment compiles the instructions that start with a register, like v0 += 1.
+func (a *octoAssembler) assignment(token octoToken, x int) {
+	op := a.next()
+	if y, ok := a.register(a.peek()); ok {
+		a.next()
+		codes := map[string]int{":=": 0x0, "|=": 0x1, "&=": 0x2, "^=": 0x3, "+=": 0x4, "-=": 0x5, ">>=": 0x6, "=-": 0x7, "<<=": 0xE}
+		code, ok := codes[op.text]
+		if !ok {
+			a.fail(op, "unknown operator %q", op.text)
+		}
+		a.inst(token, 0x8000|x<<8|y<<4|code)
+		return
+	}
+
+	switch op.text {
+	case ":=":
+		switch a.peek() {
+		case "random":
+			a.next()
+			a.inst(token, 0xC000|x<<8|int(a.byteValue()))
+		case "key":
+			a.next()
+			a.inst(token, 0xF00A|x<<8)
+		case "delay":
+			a.next()
+			a.inst(token, 0xF007|x<<8)
+		default:
+			a.inst(token, 0x6000|x<<8|int(a.byteValue()))
+		}
+	case "+=":
+		a.inst(token, 0x7000|x<<8|int(a.byteValue()))
+	case "-=":
+		a.inst(token, 0x7000|x<<8|int(-a.byteValue()))
+	default:
+		a.fail(op, "unknown operator %q", op.text)
+	}
+}
+
+// index compiles the instructions that start with i.
+func (a *octoAssembler) index() {
+	op := a.next()
+	switch op.text {
+	case ":=":
+		switch token := a.next(); token.text {
+		case "hex":
+			a.inst(token, 0xF029|a.nextRegister()<<8)
+		case "bighex":
+			a.inst(token, 0xF030|a.nextRegister()<<8)
+		case "long":
+			target := a.next()
+			a.inst(token, 0xF000)
+			value, ok := a.lookup(target.text)
+			if !ok {
+				a.fixups = append(a.fixups, octoFixup{addr: a.here, token: target, kind: fixupLong})
+			}
+			a.inst(target, int(value))
+		default:
+			a.address(0xA000, token)
+		}
+	case "+=":
+		a.inst(op, 0xF01E|a.nextRegister()<<8)
+	default:
+		a.fail(op, "unknown operator %q", op.text)
+	}
+}
+
+// unpack loads a label's address into v0 and v1: v0 gets a nibble, or with long
+// nothing, above the address's high bits, and v1 its low byte.
+func (a *octoAssembler) unpack(token octoToken) {
+	high := 0
+	if a.peek() == "long" {
+		a.next()
+	} else {
+		high = a.nibble() << 4
+	}
+	target := a.next()
+	value, ok := a.lookup(target.text)
+	if !ok {
+		a.fixups = append(a.fixups, octoFixup{addr: a.here, token: target, kind: fixupUnpack})
+	}
+	addr := int(value)
+	a.inst(token, 0x6000|high|addr>>8)
+	a.inst(token, 0x6100|addr&0xFF)
+}
+
+// octoCondition is what comes between if and then, or after while.
+type octoCondition struct {
+	token octoToken
+	x     int
+	op    string
+	// The right-hand side, a register or a byte
+	y        int
+	register bool
+}
+
+// Each comparison and the comparison that's true when it isn't
+var octoNegations = map[string]string{
+	"==": "!=", "!=": "==",
+	"key": "-key", "-key": "key",
+	"<": ">=", ">=": "<",
+	">": "<=", "<=": ">",
+}
+
+// condition reads a condition, negated if asked.
+func (a *octoAssembler) condition(negate bool) octoCondition {
+	token := a.next()
+	x, ok := a.register(token.text)
+	if !ok {
+		a.fail(token, "expected a register, got %q", token.text)
+	}
+	op := a.next()
+	negation, ok := octoNegations[op.text]
+	if !ok {
+		a.fail(op, "unknown comparison %q", op.text)
+	}
+	cond := octoCondition{token: token, x: x, op: op.text}
+	if negate {
+		cond.op = negation
+	}
+	if op.text == "key" || op.text == "-key" {
+		return cond
+	}
+	if y, ok := a.register(a.peek()); ok {
+		a.next()
+		cond.y, cond.register = y, true
+	} else {
+		cond.y = int(a.byteValue())
+	}
+	return cond
+}
+
+// skip writes instructions that skip the next one when the condition is false.
+func (a *octoAssembler) skip(cond octoCondition) {
+	token, x, y := cond.token, cond.x, cond.y
+	switch cond.op {
+	case "key":
+		a.inst(token, 0xE0A1|x<<8)
+		return
+	case "-key":
+		a.inst(token, 0xE09E|x<<8)
+		return
+	case "==":
+		if cond.register {
+			a.inst(token, 0x9000|x<<8|y<<4)
+		} else {
+			a.inst(token, 0x4000|x<<8|y)
+		}
+		return
+	case "!=":
+		if cond.register {
+			a.inst(token, 0x5000|x<<8|y<<4)
+		} else {
+			a.inst(token, 0x3000|x<<8|y)
+		}
+		return
+	}
+
+	// Inequalities subtract in VF and test the borrow
+	if cond.register {
+		a.inst(token, 0x8F00|y<<4)
+	} else {
+		a.inst(token, 0x6F00|y)
+	}
+	switch cond.op {
+	case ">":
+		a.inst(token, 0x8F05|x<<4)
+		a.inst(token, 0x3F01)
+	case "<":
+		a.inst(token, 0x8F07|x<<4)
+		a.inst(token, 0x3F01)
+	case ">=":
+		a.inst(token, 0x8F07|x<<4)
+		a.inst(token, 0x3F00)
+	case "<=":
+		a.inst(token, 0x8F05|x<<4)
+		a.inst(token, 0x3F00)
+	}
+}
+
+// conditional compiles if ... then, which skips the next instruction, and
+// if ... begin, which skips a block.
+func (a *octoAssembler) conditional(token octoToken) {
+	start := a.pos
+	a.condition(false)
+	switch kind := a.next(); kind.text {
+	case "then":
+		a.pos = start
+		a.skip(a.condition(false))
+		a.next()
+	case "begin":
+		a.pos = start
+		a.skip(a.condition(true))
+		a.next()
+		a.flow = append(a.flow, &octoFlow{token: token, addr: a.here})
+		a.inst(token, 0x1000)
+	default:
+		a.fail(kind, "expected then or begin, got %q", kind.text)
+	}
+}
+
+// block finds the if ... begin that else or end closes.
+func (a *octoAssembler) block(token octoToken, opener string) *octoFlow {
+	if len(a.flow) == 0 || a.flow[len(a.flow)-1].token.text == "loop" {
+		a.fail(token, "%s without %s ... begin", token.text, opener)
+	}
+	return a.flow[len(a.flow)-1]
+}
+
+// loop finds the innermost loop.
+func (a *octoAssembler) loop(token octoToken) *octoFlow {
+	for i := len(a.flow) - 1; i >= 0; i-- {
+		if a.flow[i].token.text == "loop" {
+			return a.flow[i]
+		}
+	}
+	a.fail(token, "%s without loop", token.text)
+	return nil
+}
+
+// macro defines a macro: :macro name params... { body }
+func (a *octoAssembler) macro() {
+	name := a.next()
+	macro := &octoMacro{}
+	for a.peek() != "{" {
+		macro.params = append(macro.params, a.next().text)
+	}
+	a.next()
+	for depth := 1; ; {
+		token := a.next()
+		if token.text == "{" {
+			depth++
+		} else if token.text == "}" {
+			if depth--; depth == 0 {
+				break
+			}
+		}
+		macro.body = append(macro.body, token)
+	}
+	a.macros[name.text] = macro
+}
+
+// expand replaces a macro's name and arguments with its body.
+func (a *octoAssembler) expand(token octoToken, macro *octoMacro) {
+	args := map[string]string{"CALLS": strconv.Itoa(macro.calls)}
+	for _, param := range macro.params {
+		args[param] = a.next().text
+	}
+	macro.calls++
+	body := make([]octoToken, len(macro.body))
+	for i, t := range macro.body {
+		if arg, ok := args[t.text]; ok {
+			t.text = arg
+		}
+		body[i] = octoToken{text: t.text, line: token.line}
+	}
+	a.tokens = append(a.tokens[:a.pos], append(body, a.tokens[a.pos:]...)...)
+}
+
+// Octo's expression operators. Expressions are worked out right to left, with
+// no precedence, so 2 * 3 + 1 is 8.
+var (
+	octoBinary = map[string]func(a, b float64) float64{
+		"+":   func(a, b float64) float64 { return a + b },
+		"-":   func(a, b float64) float64 { return a - b },
+		"*":   func(a, b float64) float64 { return a * b },
+		"/":   func(a, b float64) float64 { return a / b },
+		"%":   math.Mod,
+		"&":   func(a, b float64) float64 { return float64(int(a) & int(b)) },
+		"|":   func(a, b float64) float64 { return float64(int(a) | int(b)) },
+		"^":   func(a, b float64) float64 { return float64(int(a) ^ int(b)) },
+		"<<":  func(a, b float64) float64 { return float64(int(a) << int(b)) },
+		">>":  func(a, b float64) float64 { return float64(int(a) >> int(b)) },
+		"pow": math.Pow,
+		"min": math.Min,
+		"max": math.Max,
+		"<":   func(a, b float64) float64 { return float64(truth(a < b)) },
+		"<=":  func(a, b float64) float64 { return float64(truth(a <= b)) },
+		"==":  func(a, b float64) float64 { return float64(truth(a == b)) },
+		"!=":  func(a, b float64) float64 { return float64(truth(a != b)) },
+		">=":  func(a, b float64) float64 { return float64(truth(a >= b)) },
+		">":   func(a, b float64) float64 { return float64(truth(a > b)) },
+	}
+	octoUnary = map[string]func(a float64) float64{
+		"-":     func(a float64) float64 { return -a },
+		"~":     func(a float64) float64 { return float64(^int(a)) },
+		"!":     func(a float64) float64 { return float64(truth(a == 0)) },
+		"sin":   math.Sin,
+		"cos":   math.Cos,
+		"tan":   math.Tan,
+		"exp":   math.Exp,
+		"log":   math.Log,
+		"abs":   math.Abs,
+		"sqrt":  math.Sqrt,
+		"sign":  func(a float64) float64 { return float64(truth(a > 0) - truth(a < 0)) },
+		"ceil":  math.Ceil,
+		"floor": math.Floor,
+	}
+)
+
+// calc works out an expression up to its closing brace.
+func (a *octoAssembler) calc() float64 {
+	value := a.expression()
+	a.expect("}")
+	return value
+}
+
+func (a *octoAssembler) expression() float64 {
+	left := a.term()
+	if op, ok := octoBinary[a.peek()]; ok {
+		a.next()
+		return op(left, a.expression())
+	}
+	return left
+}
+
+func (a *octoAssembler) term() float64 {
+	token := a.next()
+	if op, ok := octoUnary[token.text]; ok {
+		return op(a.term())
+	}
+	switch token.text {
+	case "(":
+		value := a.expression()
+		a.expect(")")
+		return value
+	case "HERE":
+		return float64(a.here)
+	case "PI":
+		return math.Pi
+	case "E":
+		return math.E
+	}
+	value, ok := a.lookup(token.text)
+	if !ok {
+		a.fail(token, "undefined name %q", token.text)
+	}
+	return value
+}
@@ -0,0 +1,118 @@
+package interpreter
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestAssembleOcto(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []byte
+	}{
+		{"main first", ": main clear jump main", []byte{0x00, 0xE0, 0x12, 0x00}},
+		{"data before main", ": dot 0x80\n: main i := dot sprite v0 v1 1", []byte{0x12, 0x03, 0x80, 0xA2, 0x02, 0xD0, 0x11}},
+		{"forward call", ": main draw ;\n: draw clear return", []byte{0x22, 0x04, 0x00, 0xEE, 0x00, 0xE0, 0x00, 0xEE}},
+		{"bytes", ": main # start\n0x00 0xE0 -1 0b101\n255", []byte{0x00, 0xE0, 0xFF, 0x05, 0xFF}},
+		{
+			"alias and const",
+			":alias x v3\n:const speed 2\n: main x := speed x += 1 x -= 1 x -= v4 x =- v5 x := random 0x0F vA := key",
+			[]byte{0x63, 0x02, 0x73, 0x01, 0x73, 0xFF, 0x83, 0x45, 0x83, 0x57, 0xC3, 0x0F, 0xFA, 0x0A},
+		},
+		{
+			"if then",
+			": main if v0 == 3 then v1 := 1 if v0 != v2 then return if v0 key then clear",
+			[]byte{0x40, 0x03, 0x61, 0x01, 0x50, 0x20, 0x00, 0xEE, 0xE0, 0xA1, 0x00, 0xE0},
+		},
+		{
+			"if begin else end",
+			": main if v0 > v1 begin clear else return end",
+			[]byte{0x8F, 0x10, 0x8F, 0x05, 0x3F, 0x00, 0x12, 0x0C, 0x00, 0xE0, 0x12, 0x0E, 0x00, 0xEE},
+		},
+		{
+			"loop while again",
+			": main loop while v0 != 5 v0 += 1 again",
+			[]byte{0x40, 0x05, 0x12, 0x08, 0x70, 0x01, 0x12, 0x00},
+		},
+		{
+			"macro and calc",
+			":macro twice op { op op }\n:calc big { 2 * 3 + 1 }\n: main twice clear v0 := big :byte { 1 << 4 }",
+			[]byte{0x00, 0xE0, 0x00, 0xE0, 0x60, 0x08, 0x10},
+		},
+		{
+			"unpack and long",
+			": main :unpack 0xA data i := long data\n: data 0x42",
+			[]byte{0x60, 0xA2, 0x61, 0x08, 0xF0, 0x00, 0x02, 0x08, 0x42},
+		},
+		{
+			"timers and memory",
+			": main delay := v1 buzzer := v2 v3 := delay i := hex v4 i += v5 bcd v6 save v7 load v8",
+			[]byte{0xF1, 0x15, 0xF2, 0x18, 0xF3, 0x07, 0xF4, 0x29, 0xF5, 0x1E, 0xF6, 0x33, 0xF7, 0x55, 0xF8, 0x65},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			program, err := assembleOcto(test.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(program, test.want) {
+				t.Errorf("Expected % X, got % X", test.want, program)
+			}
+		})
+	}
+}
+
+// The comparisons Octo builds from subtraction have to agree with the interpreter
+func TestAssembleOctoComparisons(t *testing.T) {
+	for _, op := range []string{"<", ">", "<=", ">="} {
+		for _, values := range [][2]int{{1, 2}, {2, 2}, {3, 2}} {
+			source := fmt.Sprintf(": main v0 := %d v1 := %d v2 := 0 if v0 %s v1 then v2 := 1 v3 := 0 if v0 %s v1 begin v3 := 1 end : done jump done",
+				values[0], values[1], op, op)
+			program, err := assembleOcto(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chip8 := NewCHIP8(&program, DefaultCHIP8Options())
+			for i := 0; i < 20; i++ {
+				chip8.RunFrame()
+			}
+			want := map[string]bool{"<": values[0] < values[1], ">": values[0] > values[1], "<=": values[0] <= values[1], ">=": values[0] >= values[1]}[op]
+			if (chip8.V[2] == 1) != want || (chip8.V[3] == 1) != want {
+				t.Errorf("%d %s %d: expected %t, got then %d and begin %d", values[0], op, values[1], want, chip8.V[2], chip8.V[3])
+			}
+		}
+	}
+}
+
+func TestAssembleOctoErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{": main jump nowhere", `line 1: undefined name "nowhere"`},
+		{": main\nloop clear", "line 2: loop is never closed"},
+		{": main\nend", "line 2: end without if ... begin"},
+		{": main v0 := 300", "line 1: 300 doesn't fit in a byte"},
+		{": main :stringmode", "line 1: :stringmode isn't supported"},
+		{": main\n: main", `line 2: label "main" is defined twice`},
+		{": main v0 +=", "line 1: unexpected end of program"},
+	}
+	for _, test := range tests {
+		_, err := assembleOcto(test.source)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q: expected %q, got %v", test.source, test.want, err)
+		}
+	}
+}
+
+func TestDisassembleBytes(t *testing.T) {
+	program := []byte{0x12, 0x00, 0xFF, 0x80, 0x00}
+	assembled, err := assembleOcto(disassembleBytes(program))
+	if err != nil || !bytes.Equal(assembled, program) {
+		t.Errorf("Expected % X, got % X (%v)", program, assembled, err)
+	}
+}
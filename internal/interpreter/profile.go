@@ -0,0 +1,335 @@
+package interpreter
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// Profile report formats
+const (
+	ProfileText        = "text"
+	ProfileJSON        = "json"
+	ProfileDisassembly = "asm"
+)
+
+var ProfileFormats = []string{ProfileText, ProfileJSON, ProfileDisassembly}
+
+// ProfileFormatFor picks a report format from a file name: JSON for .json, an
+// annotated disassembly for .asm, and text for anything else.
+func ProfileFormatFor(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return ProfileJSON
+	case ".asm":
+		return ProfileDisassembly
+	}
+	return ProfileText
+}
+
+// Profiler counts how often each instruction runs, and where the time goes.
+type Profiler struct {
+	cycles uint64
+	counts [memorySize]uint64
+	// The last instruction run at each address, in case the program rewrote itself
+	opcodes [memorySize]Instruction
+	classes map[string]uint64
+
+	subroutines map[uint16]*SubroutineProfile
+	// Entry points of the subroutines being run, innermost last
+	calls []uint16
+}
+
+func NewProfiler() *Profiler {
+	return &Profiler{
+		classes:     map[string]uint64{},
+		subroutines: map[uint16]*SubroutineProfile{},
+	}
+}
+
+// record counts an instruction about to run at pc.
+func (p *Profiler) record(chip8 *CHIP8, pc uint16, instruction Instruction) {
+	p.cycles++
+	p.counts[pc]++
+	p.opcodes[pc] = instruction
+	p.classes[opcodeClass(instruction)]++
+
+	// Follow the stack: it grew if the last instruction was a call, putting us at
+	// the start of a subroutine, and shrank if it was a return
+	depth := len(chip8.stack)
+	if depth < len(p.calls) {
+		p.calls = p.calls[:depth]
+	}
+	for len(p.calls) < depth {
+		p.calls = append(p.calls, pc)
+		p.subroutine(pc).Calls++
+	}
+
+	for i, entry := range p.calls {
+		// Count recursive subroutines once
+		if !slices.Contains(p.calls[:i], entry) {
+			p.subroutine(entry).Cycles++
+		}
+	}
+	if len(p.calls) > 0 {
+		p.subroutine(p.calls[len(p.calls)-1]).SelfCycles++
+	}
+}
+
+func (p *Profiler) subroutine(entry uint16) *SubroutineProfile {
+	sub, ok := p.subroutines[entry]
+	if !ok {
+		sub = &SubroutineProfile{Address: entry}
+		p.subroutines[entry] = sub
+	}
+	return sub
+}
+
+// opcodeClass names the kind of an instruction, like 8XY4 or FX33.
+func opcodeClass(i Instruction) string {
+	switch i >> 12 {
+	case 0x0:
+		switch {
+		case i == 0x00E0, i == 0x00EE, i >= 0x00FB && i <= 0x00FF:
+			return fmt.Sprintf("%04X", uint16(i))
+		case i&0xFFF0 == 0x00C0:
+			return "00CN"
+		case i&0xFFF0 == 0x00D0:
+			return "00DN"
+		}
+		return "0NNN"
+	case 0x1, 0x2, 0xA, 0xB:
+		return fmt.Sprintf("%XNNN", uint16(i>>12))
+	case 0x3, 0x4, 0x6, 0x7, 0xC:
+		return fmt.Sprintf("%XXNN", uint16(i>>12))
+	case 0x5, 0x8, 0x9:
+		return fmt.Sprintf("%XXY%X", uint16(i>>12), uint16(i&0xF))
+	case 0xD:
+		return "DXYN"
+	}
+	// E and F
+	return fmt.Sprintf("%XX%02X", uint16(i>>12), uint16(i&0xFF))
+}
+
+// ProfileReport summarizes a profile of a program.
+type ProfileReport struct {
+	Cycles      uint64 `json:"cycles"`
+	ProgramSize int    `json:"program_size"`
+	// How many bytes of the program ran as instructions
+	CoveredBytes int                 `json:"covered_bytes"`
+	Addresses    []AddressProfile    `json:"addresses"`
+	Classes      []ClassProfile      `json:"classes"`
+	Subroutines  []SubroutineProfile `json:"subroutines"`
+	// Parts of the program that never ran, which may be data
+	Unexecuted []MemoryRange `json:"unexecuted"`
+
+	program []byte
+	counts  []uint64
+	opcodes []Instruction
+}
+
+// AddressProfile is how often the instruction at an address ran.
+type AddressProfile struct {
+	Address  uint16 `json:"address"`
+	Count    uint64 `json:"count"`
+	Opcode   uint16 `json:"opcode"`
+	Mnemonic string `json:"mnemonic"`
+}
+
+// ClassProfile is how often a kind of instruction ran.
+type ClassProfile struct {
+	Class string `json:"class"`
+	Count uint64 `json:"count"`
+}
+
+// SubroutineProfile is the time spent in a subroutine, found by following 2NNN
+// calls and 00EE returns.
+type SubroutineProfile struct {
+	Address uint16 `json:"address"`
+	Calls   uint64 `json:"calls"`
+	// Instructions run inside it, including in subroutines it called
+	Cycles uint64 `json:"cycles"`
+	// Instructions run in it alone
+	SelfCycles uint64 `json:"self_cycles"`
+}
+
+// MemoryRange is the addresses from Start to End, inclusive.
+type MemoryRange struct {
+	Start uint16 `json:"start"`
+	End   uint16 `json:"end"`
+}
+
+// Report summarizes the profile of the program loaded in chip8.
+func (p *Profiler) Report(chip8 *CHIP8) ProfileReport {
+	start, end := programStartAddress, min(programStartAddress+len(chip8.program), memorySize)
+	report := ProfileReport{
+		Cycles:      p.cycles,
+		ProgramSize: end - start,
+		program:     slices.Clone(chip8.memory[start:end]),
+		counts:      slices.Clone(p.counts[start:end]),
+		opcodes:     make([]Instruction, end-start),
+	}
+
+	// Bytes that were run, as either half of an instruction
+	covered := make([]bool, end-start)
+	for addr := start; addr < end; addr++ {
+		report.opcodes[addr-start] = p.opcode(chip8, addr)
+		if p.counts[addr] == 0 {
+			continue
+		}
+		covered[addr-start] = true
+		if addr+1 < end {
+			covered[addr+1-start] = true
+		}
+		report.Addresses = append(report.Addresses, AddressProfile{
+			Address:  uint16(addr),
+			Count:    p.counts[addr],
+			Opcode:   uint16(p.opcodes[addr]),
+			Mnemonic: p.opcodes[addr].Mnemonic(),
+		})
+	}
+	for i := 0; i < len(covered); i++ {
+		if covered[i] {
+			report.CoveredBytes++
+			continue
+		}
+		first := i
+		for i+1 < len(covered) && !covered[i+1] {
+			i++
+		}
+		report.Unexecuted = append(report.Unexecuted, MemoryRange{uint16(start + first), uint16(start + i)})
+	}
+
+	for class, count := range p.classes {
+		report.Classes = append(report.Classes, ClassProfile{class, count})
+	}
+	slices.SortFunc(report.Classes, func(a, b ClassProfile) int {
+		if a.Count != b.Count {
+			return cmp.Compare(b.Count, a.Count)
+		}
+		return strings.Compare(a.Class, b.Class)
+	})
+	for _, sub := range p.subroutines {
+		report.Subroutines = append(report.Subroutines, *sub)
+	}
+	slices.SortFunc(report.Subroutines, func(a, b SubroutineProfile) int {
+		if a.Cycles != b.Cycles {
+			return cmp.Compare(b.Cycles, a.Cycles)
+		}
+		return cmp.Compare(a.Address, b.Address)
+	})
+	return report
+}
+
+// opcode is the instruction that ran at an address, or what's in memory there if
+// nothing did.
+func (p *Profiler) opcode(chip8 *CHIP8, addr int) Instruction {
+	if p.counts[addr] > 0 || addr+1 >= memorySize {
+		return p.opcodes[addr]
+	}
+	return Instruction(uint16(chip8.memory[addr])<<8 | uint16(chip8.memory[addr+1]))
+}
+
+// Write writes the report in one of the ProfileFormats.
+func (r ProfileReport) Write(w io.Writer, format string) error {
+	switch format {
+	case ProfileText:
+		return r.writeText(w)
+	case ProfileJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	case ProfileDisassembly:
+		return r.writeDisassembly(w)
+	}
+	return fmt.Errorf("unknown profile format %q, expected %s", format, strings.Join(ProfileFormats, ", "))
+}
+
+// How many of the busiest addresses the text report lists
+const profileHotSpots = 20
+
+func (r ProfileReport) percent(count uint64) float64 {
+	if r.Cycles == 0 {
+		return 0
+	}
+	return float64(count) * 100 / float64(r.Cycles)
+}
+
+func (r ProfileReport) writeText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	coverage := 0.0
+	if r.ProgramSize > 0 {
+		coverage = float64(r.CoveredBytes) * 100 / float64(r.ProgramSize)
+	}
+	fmt.Fprintf(w, "%d instructions run, covering %d of %d program bytes (%.1f%%)\n", r.Cycles, r.CoveredBytes, r.ProgramSize, coverage)
+
+	hot := slices.Clone(r.Addresses)
+	slices.SortStableFunc(hot, func(a, b AddressProfile) int { return cmp.Compare(b.Count, a.Count) })
+	fmt.Fprintf(w, "\nHot spots\n")
+	fmt.Fprintf(tw, "Address\tCount\t%%\t\n")
+	for _, addr := range hot[:min(len(hot), profileHotSpots)] {
+		fmt.Fprintf(tw, "0x%03X\t%d\t%.1f\t  %s\n", addr.Address, addr.Count, r.percent(addr.Count), addr.Mnemonic)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nInstructions\n")
+	fmt.Fprintf(tw, "Class\tCount\t%%\t\n")
+	for _, class := range r.Classes {
+		fmt.Fprintf(tw, "%s\t%d\t%.1f\t\n", class.Class, class.Count, r.percent(class.Count))
+	}
+	tw.Flush()
+
+	if len(r.Subroutines) > 0 {
+		fmt.Fprintf(w, "\nSubroutines\n")
+		fmt.Fprintf(tw, "Address\tCalls\tCycles\t%%\tSelf\t%%\t\n")
+		for _, sub := range r.Subroutines {
+			fmt.Fprintf(tw, "0x%03X\t%d\t%d\t%.1f\t%d\t%.1f\t\n", sub.Address, sub.Calls, sub.Cycles, r.percent(sub.Cycles), sub.SelfCycles, r.percent(sub.SelfCycles))
+		}
+		tw.Flush()
+	}
+
+	if len(r.Unexecuted) > 0 {
+		fmt.Fprintf(w, "\nNever executed (code or data)\n")
+		for _, region := range r.Unexecuted {
+			fmt.Fprintf(w, "0x%03X-0x%03X  %d bytes\n", region.Start, region.End, region.End-region.Start+1)
+		}
+	}
+	return nil
+}
+
+// writeDisassembly lists the program with how often each instruction ran.
+func (r ProfileReport) writeDisassembly(w io.Writer) error {
+	subroutines := map[uint16]SubroutineProfile{}
+	for _, sub := range r.Subroutines {
+		subroutines[sub.Address] = sub
+	}
+
+	fmt.Fprintf(w, "; %d instructions run\n", r.Cycles)
+	fmt.Fprintf(w, ";   count  address  opcode  instruction\n")
+	for i := 0; i < len(r.program); {
+		addr := uint16(programStartAddress + i)
+		if sub, ok := subroutines[addr]; ok {
+			fmt.Fprintf(w, "\n; subroutine 0x%03X: %d calls, %d cycles (%.1f%%), %d self\n", addr, sub.Calls, sub.Cycles, r.percent(sub.Cycles), sub.SelfCycles)
+		}
+
+		count := "-"
+		if r.counts[i] > 0 {
+			count = fmt.Sprint(r.counts[i])
+		}
+		// A lone byte, before an instruction that ran at an odd address or at the end
+		if i+1 >= len(r.program) || r.counts[i] == 0 && r.counts[i+1] > 0 {
+			fmt.Fprintf(w, "%9s  0x%03X    %02X      DB 0x%02X\n", count, addr, r.program[i], r.program[i])
+			i++
+			continue
+		}
+		instruction := r.opcodes[i]
+		fmt.Fprintf(w, "%9s  0x%03X    %04X    %s\n", count, addr, uint16(instruction), instruction.Mnemonic())
+		i += 2
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package interpreter
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestProfiler(t *testing.T) {
+	program := []byte{
+		0x22, 0x08, // 200: CALL 0x208
+		0x22, 0x08, // 202: CALL 0x208
+		0x12, 0x04, // 204: JP 0x204
+		0x00, 0x00, // 206: never runs
+		0x71, 0x01, // 208: ADD V1, 0x01
+		0x00, 0xEE, // 20A: RET
+	}
+	chip8 := NewCHIP8(&program, DefaultCHIP8Options())
+	chip8.Profiler = NewProfiler()
+	for i := 0; i < 3; i++ {
+		chip8.RunFrame()
+	}
+	report := chip8.Profiler.Report(chip8)
+
+	// Two calls of two instructions each, then the jump in each frame
+	if report.Cycles != 9 {
+		t.Errorf("Expected 9 cycles, got %d", report.Cycles)
+	}
+	if i := slices.IndexFunc(report.Addresses, func(a AddressProfile) bool { return a.Address == 0x208 }); i < 0 || report.Addresses[i].Count != 2 {
+		t.Errorf("Expected 0x208 to run twice, got %v", report.Addresses)
+	}
+	if report.Classes[0] != (ClassProfile{"1NNN", 3}) {
+		t.Errorf("Expected jumps to be the most common instruction, got %v", report.Classes)
+	}
+	if len(report.Subroutines) != 1 || report.Subroutines[0] != (SubroutineProfile{Address: 0x208, Calls: 2, Cycles: 4, SelfCycles: 4}) {
+		t.Errorf("Expected 2 calls of 2 cycles to 0x208, got %v", report.Subroutines)
+	}
+	if !slices.Equal(report.Unexecuted, []MemoryRange{{0x206, 0x207}}) {
+		t.Errorf("Expected only 0x206-0x207 to never run, got %v", report.Unexecuted)
+	}
+
+	var listing strings.Builder
+	report.Write(&listing, ProfileDisassembly)
+	for _, line := range []string{
+		"        2  0x208    7101    ADD V1, 0x01",
+		"        -  0x206    0000    ",
+		"; subroutine 0x208: 2 calls, 4 cycles",
+	} {
+		if !strings.Contains(listing.String(), line) {
+			t.Errorf("Expected the disassembly to have %q, got\n%s", line, listing.String())
+		}
+	}
+}
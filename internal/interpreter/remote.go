@@ -0,0 +1,253 @@
+package interpreter
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+//go:embed remote.html
+var remotePage []byte
+
+// Messages waiting for a slow browser before it's dropped
+const remoteBacklog = 64
+
+// RemoteViewer runs an interpreter for browsers to watch and play over
+// WebSocket. The first browser to connect is the controller, whose keys go to the
+// keypad, and the rest spectate. When the controller leaves, the browser that's
+// been watching longest takes over.
+type RemoteViewer struct {
+	chip8 *CHIP8
+
+	mu sync.Mutex
+	// Connected browsers, the controller first
+	clients []*remoteClient
+	// The keys the controller holds
+	keys Action
+	// What browsers were last sent, so only changes are sent
+	width, height int
+	pixels        []byte
+	sound         bool
+}
+
+type remoteClient struct {
+	conn *wsConn
+	// Messages to write, in order
+	send chan []byte
+}
+
+// remoteMessage is sent each way as JSON. Browsers get hello when they connect,
+// then frame for the whole display, diff for the pixels that changed, role when
+// they take control, viewers when browsers come and go, and sound when the beep
+// starts or stops. Browsers send keys.
+type remoteMessage struct {
+	Type string `json:"type"`
+	// hello and role
+	Controller bool `json:"controller,omitempty"`
+	// hello: the off and on colors
+	Palette []string `json:"palette,omitempty"`
+	// hello and viewers
+	Viewers int `json:"viewers,omitempty"`
+	// frame: a byte per pixel, row by row, 1 for lit pixels
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	Pixels []byte `json:"pixels,omitempty"`
+	// diff: pixel indexes, each followed by its new value
+	Changes []int `json:"changes,omitempty"`
+	// sound
+	Sound bool `json:"sound,omitempty"`
+	// keys
+	Keys Action `json:"keys,omitempty"`
+}
+
+// NewRemoteViewer serves an interpreter to browsers. Run it to start the program.
+func NewRemoteViewer(chip8 *CHIP8) *RemoteViewer {
+	v := &RemoteViewer{chip8: chip8}
+	v.width, v.height, v.pixels = v.chip8.Pixels()
+	return v
+}
+
+// ServeHTTP serves the viewer page, and the WebSocket it connects back to.
+func (v *RemoteViewer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(remotePage)
+	case "/ws":
+		v.serveWebSocket(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Run plays the program at 60 frames a second until it finishes or ctx is
+// done, then hangs up on every browser.
+func (v *RemoteViewer) Run(ctx context.Context) {
+	defer v.Close()
+	ticker := time.NewTicker(time.Second / 60)
+	defer ticker.Stop()
+	for !v.chip8.finished() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			v.frame()
+		}
+	}
+}
+
+// Close hangs up on every browser.
+func (v *RemoteViewer) Close() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for len(v.clients) > 0 {
+		v.leaveLocked(v.clients[0])
+	}
+}
+
+// frame runs a frame with the controller's keys and sends browsers what changed.
+func (v *RemoteViewer) frame() {
+	v.mu.Lock()
+	keys := v.keys
+	v.mu.Unlock()
+	v.chip8.HoldKeys(keys)
+	v.chip8.RunFrame()
+	v.update()
+}
+
+// update sends browsers the display and sound, if they changed.
+func (v *RemoteViewer) update() {
+	width, height, pixels := v.chip8.Pixels()
+	sound := v.chip8.soundTimer > 0
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if width != v.width || height != v.height {
+		v.width, v.height, v.pixels = width, height, pixels
+		v.broadcastLocked(v.frameMessage())
+	} else {
+		var changes []int
+		for i, pixel := range pixels {
+			if pixel != v.pixels[i] {
+				changes = append(changes, i, int(pixel))
+			}
+		}
+		v.pixels = pixels
+		// Past a point the whole display is smaller
+		if len(changes) > len(pixels)/2 {
+			v.broadcastLocked(v.frameMessage())
+		} else if len(changes) > 0 {
+			v.broadcastLocked(remoteMessage{Type: "diff", Changes: changes})
+		}
+	}
+	if sound != v.sound {
+		v.sound = sound
+		v.broadcastLocked(remoteMessage{Type: "sound", Sound: sound})
+	}
+}
+
+func (v *RemoteViewer) frameMessage() remoteMessage {
+	return remoteMessage{Type: "frame", Width: v.width, Height: v.height, Pixels: v.pixels}
+}
+
+func (v *RemoteViewer) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		v.chip8.Logger.Debug("Rejected viewer", "address", r.RemoteAddr, "err", err)
+		return
+	}
+	c := &remoteClient{conn: conn, send: make(chan []byte, remoteBacklog)}
+	go c.write()
+
+	v.mu.Lock()
+	v.broadcastLocked(remoteMessage{Type: "viewers", Viewers: len(v.clients) + 1})
+	v.clients = append(v.clients, c)
+	palette := v.chip8.display.palette
+	v.sendLocked(c, remoteMessage{
+		Type:       "hello",
+		Controller: len(v.clients) == 1,
+		Palette:    []string{string(palette[0]), string(palette[1])},
+		Viewers:    len(v.clients),
+	})
+	v.sendLocked(c, v.frameMessage())
+	if v.sound {
+		v.sendLocked(c, remoteMessage{Type: "sound", Sound: true})
+	}
+	v.mu.Unlock()
+	v.chip8.Logger.Info("Viewer connected", "address", r.RemoteAddr)
+
+	for {
+		data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		var message remoteMessage
+		if json.Unmarshal(data, &message) != nil || message.Type != "keys" {
+			continue
+		}
+		v.mu.Lock()
+		// Spectators' keys go nowhere
+		if len(v.clients) > 0 && v.clients[0] == c {
+			v.keys = message.Keys
+		}
+		v.mu.Unlock()
+	}
+
+	v.mu.Lock()
+	v.leaveLocked(c)
+	v.mu.Unlock()
+	v.chip8.Logger.Info("Viewer left", "address", r.RemoteAddr)
+}
+
+// leaveLocked hangs up on a browser, handing control on if it had it.
+func (v *RemoteViewer) leaveLocked(c *remoteClient) {
+	i := slices.Index(v.clients, c)
+	if i < 0 {
+		return
+	}
+	v.clients = slices.Delete(v.clients, i, i+1)
+	close(c.send)
+	c.conn.Close()
+	if i == 0 {
+		// Let go of whatever the controller held
+		v.keys = 0
+		if len(v.clients) > 0 {
+			v.sendLocked(v.clients[0], remoteMessage{Type: "role", Controller: true})
+		}
+	}
+	v.broadcastLocked(remoteMessage{Type: "viewers", Viewers: len(v.clients)})
+}
+
+func (v *RemoteViewer) broadcastLocked(message remoteMessage) {
+	// Go through a copy, since browsers that fall behind are dropped
+	for _, c := range slices.Clone(v.clients) {
+		v.sendLocked(c, message)
+	}
+}
+
+// sendLocked queues a message for a browser, dropping it if it's too far behind.
+func (v *RemoteViewer) sendLocked(c *remoteClient, message remoteMessage) {
+	if !slices.Contains(v.clients, c) {
+		return
+	}
+	data, _ := json.Marshal(message)
+	select {
+	case c.send <- data:
+	default:
+		v.chip8.Logger.Warn("Dropping a viewer that fell behind")
+		v.leaveLocked(c)
+	}
+}
+
+func (c *remoteClient) write() {
+	for data := range c.send {
+		if c.conn.WriteMessage(data) != nil {
+			// Reading fails too, which cleans up
+			c.conn.Close()
+		}
+	}
+}
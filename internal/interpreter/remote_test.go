@@ -0,0 +1,214 @@
+package interpreter
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testViewer is a browser connected to a RemoteViewer.
+type testViewer struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// handshake asks the server for a WebSocket, with any extra headers.
+func handshake(t *testing.T, server *httptest.Server, headers string) (net.Conn, *bufio.Reader, *http.Response) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: chip8\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"+headers+"\r\n")
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, reader, response
+}
+
+func dialViewer(t *testing.T, server *httptest.Server) *testViewer {
+	conn, reader, response := handshake(t, server, "")
+	// The example from RFC 6455
+	if response.StatusCode != http.StatusSwitchingProtocols || response.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Expected a WebSocket, got %s %v", response.Status, response.Header)
+	}
+	return &testViewer{conn: conn, reader: reader}
+}
+
+func (tv *testViewer) read(t *testing.T) remoteMessage {
+	t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(tv.reader, header[:]); err != nil {
+		t.Fatal(err)
+	}
+	length := int(header[1] & 0x7F)
+	if length == 126 {
+		var extended [2]byte
+		io.ReadFull(tv.reader, extended[:])
+		length = int(binary.BigEndian.Uint16(extended[:]))
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(tv.reader, data); err != nil {
+		t.Fatal(err)
+	}
+	var message remoteMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+func (tv *testViewer) expect(t *testing.T, kind string) remoteMessage {
+	t.Helper()
+	message := tv.read(t)
+	if message.Type != kind {
+		t.Fatalf("Expected %s, got %+v", kind, message)
+	}
+	return message
+}
+
+// send writes a message the way browsers do, masked.
+func (tv *testViewer) send(message remoteMessage) {
+	data, _ := json.Marshal(message)
+	mask := [4]byte{1, 2, 3, 4}
+	frame := append([]byte{0x80 | wsText, 0x80 | byte(len(data))}, mask[:]...)
+	for i, b := range data {
+		frame = append(frame, b^mask[i%4])
+	}
+	tv.conn.Write(frame)
+}
+
+// waitForKeys waits for the viewer to take in a browser's keys.
+func waitForKeys(t *testing.T, v *RemoteViewer, want Action) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		v.mu.Lock()
+		keys := v.keys
+		v.mu.Unlock()
+		if keys == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected keys %b, got %b", want, keys)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRemoteViewer(t *testing.T) {
+	v := NewRemoteViewer(NewCHIP8(&pointsProgram, DefaultCHIP8Options()))
+	server := httptest.NewServer(v)
+	defer server.Close()
+	defer v.Close()
+
+	player := dialViewer(t, server)
+	if hello := player.expect(t, "hello"); !hello.Controller || len(hello.Palette) != 2 {
+		t.Errorf("Expected the first browser to play, got %+v", hello)
+	}
+	if frame := player.expect(t, "frame"); frame.Width != DisplayWidth || len(frame.Pixels) != DisplayWidth*DisplayHeight {
+		t.Errorf("Expected the whole display, got %+v", frame)
+	}
+
+	spectator := dialViewer(t, server)
+	if hello := spectator.expect(t, "hello"); hello.Controller || hello.Viewers != 2 {
+		t.Errorf("Expected the second browser to spectate, got %+v", hello)
+	}
+	spectator.expect(t, "frame")
+	if viewers := player.expect(t, "viewers"); viewers.Viewers != 2 {
+		t.Errorf("Expected 2 viewers, got %d", viewers.Viewers)
+	}
+
+	// Only the player's keys count
+	spectator.send(remoteMessage{Type: "keys", Keys: 1 << 5})
+	player.send(remoteMessage{Type: "keys", Keys: 1 << 6})
+	waitForKeys(t, v, 1<<6)
+	player.send(remoteMessage{Type: "keys", Keys: 1 << 5})
+	waitForKeys(t, v, 1<<5)
+	for i := 0; i < 4; i++ {
+		v.frame()
+	}
+	if points := v.chip8.memory[0x301]; points != 2 {
+		t.Errorf("Expected the player to score 2 points, got %d", points)
+	}
+
+	// Only changed pixels are sent
+	pixels := make([]byte, DisplayWidth*DisplayHeight)
+	pixels[3] = 0xFF
+	v.chip8.display.content.Pack(0, pixels)
+	v.update()
+	for _, viewer := range []*testViewer{player, spectator} {
+		if diff := viewer.expect(t, "diff"); !slices.Equal(diff.Changes, []int{3, 1}) {
+			t.Errorf("Expected pixel 3 to light, got %v", diff.Changes)
+		}
+	}
+
+	// The spectator takes over when the player leaves
+	player.conn.Close()
+	if role := spectator.expect(t, "role"); !role.Controller {
+		t.Error("Expected the spectator to take control")
+	}
+	waitForKeys(t, v, 0)
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, err := upgradeWebSocket(w, r); err == nil {
+			conn.Close()
+		}
+	}))
+	defer server.Close()
+
+	for origin, want := range map[string]int{
+		"":                             http.StatusSwitchingProtocols,
+		"Origin: http://chip8\r\n":     http.StatusSwitchingProtocols,
+		"Origin: http://evil.test\r\n": http.StatusForbidden,
+		"Origin: http://chip8:81\r\n":  http.StatusForbidden,
+		"Origin: null\r\n":             http.StatusForbidden,
+	} {
+		if _, _, response := handshake(t, server, origin); response.StatusCode != want {
+			t.Errorf("%q: expected %d, got %s", origin, want, response.Status)
+		}
+	}
+}
+
+func TestWebSocketControlFrames(t *testing.T) {
+	tests := map[string][]byte{
+		"split ping": {wsPing, 0x80, 1, 2, 3, 4},
+		"long ping":  append([]byte{0x80 | wsPing, 0x80 | 126, 0, 200, 1, 2, 3, 4}, make([]byte, 200)...),
+	}
+	for name, frame := range tests {
+		t.Run(name, func(t *testing.T) {
+			errs := make(chan error, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, err := upgradeWebSocket(w, r)
+				if err != nil {
+					errs <- err
+					return
+				}
+				defer conn.Close()
+				_, err = conn.ReadMessage()
+				errs <- err
+			}))
+			defer server.Close()
+
+			conn, _, _ := handshake(t, server, "")
+			conn.Write(frame)
+			if err := <-errs; err == nil || err == io.EOF {
+				t.Errorf("Expected the frame to be rejected, got %v", err)
+			}
+		})
+	}
+}
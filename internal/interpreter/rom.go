@@ -0,0 +1,128 @@
+package interpreter
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// The most program that fits in memory after the interpreter's reserved space
+const MaxProgramSize = memorySize - programStartAddress
+
+// Rom is a program ready to run, from a file, archive, cartridge or stdin.
+type Rom struct {
+	// The ROM's file name, for the window title and per-ROM config
+	Name    string
+	Program []byte
+	// Settings from an Octo cartridge, if the ROM came in one
+	Cartridge *CartridgeOptions
+}
+
+// Chooser picks one of several ROMs found in an archive, by index.
+type Chooser func(names []string) (int, error)
+
+// ReadRom loads the program at path, which may be a ROM file, a zip archive of
+// ROMs, an Octo cartridge GIF, or - for stdin. When an archive holds several ROMs,
+// choose picks one.
+func ReadRom(romFilePath string, choose Chooser) (Rom, error) {
+	var data []byte
+	var err error
+	name := filepath.Base(romFilePath)
+	if romFilePath == "-" {
+		name = "stdin"
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(romFilePath)
+	}
+	if err != nil {
+		return Rom{}, err
+	}
+
+	rom := Rom{Name: name, Program: data}
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		rom, err = readZip(data, choose)
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		rom, err = readCartridgeRom(name, data)
+	}
+	if err != nil {
+		return Rom{}, fmt.Errorf("%s: %w", name, err)
+	}
+
+	if err := ValidateProgram(rom.Program); err != nil {
+		return Rom{}, fmt.Errorf("%s: %w", rom.Name, err)
+	}
+	return rom, nil
+}
+
+// readZip loads a ROM from a zip archive.
+func readZip(data []byte, choose Chooser) (Rom, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return Rom{}, err
+	}
+
+	var roms []*zip.File
+	for _, file := range archive.File {
+		ext := strings.ToLower(path.Ext(file.Name))
+		if !file.FileInfo().IsDir() && (slices.Contains(RomExtensions, ext) || ext == ".gif") {
+			roms = append(roms, file)
+		}
+	}
+
+	var file *zip.File
+	switch len(roms) {
+	case 0:
+		return Rom{}, errors.New("no ROMs in archive")
+	case 1:
+		file = roms[0]
+	default:
+		names := make([]string, len(roms))
+		for i, rom := range roms {
+			names[i] = rom.Name
+		}
+		choice, err := choose(names)
+		if err != nil {
+			return Rom{}, err
+		}
+		file = roms[choice]
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return Rom{}, err
+	}
+	defer reader.Close()
+	program, err := io.ReadAll(reader)
+	if err != nil {
+		return Rom{}, err
+	}
+
+	if strings.EqualFold(path.Ext(file.Name), ".gif") {
+		return readCartridgeRom(path.Base(file.Name), program)
+	}
+	return Rom{Name: path.Base(file.Name), Program: program}, nil
+}
+
+func readCartridgeRom(name string, data []byte) (Rom, error) {
+	program, options, err := DecodeCartridge(bytes.NewReader(data))
+	return Rom{Name: name, Program: program, Cartridge: &options}, err
+}
+
+// ValidateProgram checks a program fits in memory between 0x200 and the end.
+func ValidateProgram(program []byte) error {
+	switch {
+	case len(program) == 0:
+		return errors.New("program is empty")
+	case len(program) > MaxProgramSize:
+		return fmt.Errorf("program is %d bytes, more than the %d that fit in memory", len(program), MaxProgramSize)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package interpreter
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadRomZip(t *testing.T) {
+	writeZip := func(files map[string][]byte) string {
+		path := filepath.Join(t.TempDir(), "roms.zip")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		archive := zip.NewWriter(f)
+		for name, data := range files {
+			w, err := archive.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(data)
+		}
+		if err := archive.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	noChoice := func(names []string) (int, error) {
+		t.Fatalf("Unexpected prompt for %v", names)
+		return 0, nil
+	}
+
+	rom, err := ReadRom(writeZip(map[string][]byte{"readme.txt": []byte("hi"), "games/pong.ch8": {0x00, 0xE0}}), noChoice)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rom.Name != "pong.ch8" || len(rom.Program) != 2 {
+		t.Errorf("Expected pong.ch8 with 2 bytes, got %s with %d", rom.Name, len(rom.Program))
+	}
+
+	rom, err = ReadRom(writeZip(map[string][]byte{"a.ch8": {1}, "b.ch8": {2, 2}}), func(names []string) (int, error) {
+		for i, name := range names {
+			if name == "b.ch8" {
+				return i, nil
+			}
+		}
+		return 0, nil
+	})
+	if err != nil || rom.Name != "b.ch8" {
+		t.Errorf("Expected chosen b.ch8, got %s (%v)", rom.Name, err)
+	}
+
+	if _, err := ReadRom(writeZip(map[string][]byte{"readme.txt": nil}), noChoice); err == nil {
+		t.Error("Expected error for archive without ROMs")
+	}
+}
+
+func TestValidateProgram(t *testing.T) {
+	if err := ValidateProgram(make([]byte, MaxProgramSize)); err != nil {
+		t.Errorf("Expected program filling memory to fit, got %v", err)
+	}
+	if err := ValidateProgram(make([]byte, MaxProgramSize+1)); err == nil {
+		t.Error("Expected error for program past the end of memory")
+	}
+	if err := ValidateProgram(nil); err == nil {
+		t.Error("Expected error for empty program")
+	}
+}
+
+func TestCartridgeRoundTrip(t *testing.T) {
+	// Big enough to need more than one frame
+	program := make([]byte, MaxProgramSize)
+	for i := range program {
+		program[i] = byte(i * 7)
+	}
+	opts := DefaultCHIP8Options()
+	opts.ThrottleSpeed = 120
+	opts.CosmacQuirks.ResetVF = true
+
+	path := filepath.Join(t.TempDir(), "cart.gif")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := EncodeCartridge(f, program, opts); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	f.Close()
+
+	rom, err := ReadRom(path, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(rom.Program, program) {
+		t.Error("Program changed in the cartridge")
+	}
+
+	loaded := DefaultCHIP8Options()
+	rom.Cartridge.Apply(&loaded)
+	if loaded.ThrottleSpeed != 120 || !loaded.CosmacQuirks.ResetVF || loaded.CosmacQuirks.IncrementI {
+		t.Errorf("Expected throttle 120 and only reset_vf, got %d and %+v", loaded.ThrottleSpeed, loaded.CosmacQuirks)
+	}
+	if loaded.OnColor != "#31748F" {
+		t.Errorf("Expected on color #31748F, got %s", loaded.OnColor)
+	}
+}
@@ -0,0 +1,139 @@
+package interpreter
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// RomInfo describes a ROM, as listed in the CHIP-8 community database.
+// https://github.com/chip-8/chip-8-database
+type RomInfo struct {
+	Title       string
+	Description string
+	Authors     []string
+	Release     string
+	// The variants the ROM was written for, like originalChip8 or superchip
+	Platforms []string
+	// Instructions per frame the ROM expects, or 0 if unknown
+	Tickrate int
+	// The keypad key behind each control, like up or player2Up
+	Keys map[string]int
+	// Where the ROM keeps its score, written like the score option
+	Score string
+}
+
+// RomDatabase maps the SHA1 hash of a ROM's contents to what's known about it.
+type RomDatabase map[string]RomInfo
+
+// The layout of programs.json in the CHIP-8 database
+type databaseProgram struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Authors     []string `json:"authors"`
+	Release     string   `json:"release"`
+	Roms        map[string]struct {
+		Platforms []string       `json:"platforms"`
+		Tickrate  int            `json:"tickrate"`
+		Keys      map[string]int `json:"keys"`
+		Score     string         `json:"score"`
+	} `json:"roms"`
+}
+
+// LoadRomDatabase reads the programs.json file of the CHIP-8 database.
+func LoadRomDatabase(path string) (RomDatabase, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var programs []databaseProgram
+	if err := json.Unmarshal(data, &programs); err != nil {
+		return nil, err
+	}
+
+	db := RomDatabase{}
+	for _, program := range programs {
+		for hash, rom := range program.Roms {
+			db[hash] = RomInfo{
+				Title:       program.Title,
+				Description: program.Description,
+				Authors:     program.Authors,
+				Release:     program.Release,
+				Platforms:   rom.Platforms,
+				Tickrate:    rom.Tickrate,
+				Keys:        rom.Keys,
+				Score:       rom.Score,
+			}
+		}
+	}
+	return db, nil
+}
+
+// RomHash is the hex SHA1 hash of a ROM, the key it's listed under in the database.
+func RomHash(program []byte) string {
+	sum := sha1.Sum(program)
+	return hex.EncodeToString(sum[:])
+}
+
+// Lookup finds a ROM in the database by its contents.
+func (db RomDatabase) Lookup(program []byte) (RomInfo, bool) {
+	info, ok := db[RomHash(program)]
+	return info, ok
+}
+
+// Apply adjusts options to suit the ROM. Settings the user has already chosen,
+// like a throttle speed or COSMAC quirks, are left alone.
+func (info RomInfo) Apply(opts *CHIP8Options) {
+	// Platforms are listed best first
+	if opts.CosmacQuirks == (COSMACQuirks{}) && len(info.Platforms) > 0 && info.Platforms[0] == "originalChip8" {
+		opts.CosmacQuirks.EnableAll()
+	}
+	if opts.ThrottleSpeed == 0 && info.Tickrate > 0 {
+		// Throttle speed is in tens of instructions per second, at 60 frames per second
+		opts.ThrottleSpeed = info.Tickrate * 6
+	}
+	if opts.Score == "" {
+		opts.Score = info.Score
+	}
+	// Two-player games get a split keypad, unless one is already set up
+	if !opts.Keypad.Split() && info.twoPlayer() {
+		opts.Keypad.Player1 = info.playerControls("")
+		opts.Keypad.Player2 = info.playerControls("player2")
+	}
+}
+
+// twoPlayer reports whether the database lists keys for a second player.
+func (info RomInfo) twoPlayer() bool {
+	for control := range info.Keys {
+		if strings.HasPrefix(control, "player2") {
+			return true
+		}
+	}
+	return false
+}
+
+// playerControls are the controls the database lists for a player, whose names
+// start with prefix.
+func (info RomInfo) playerControls(prefix string) PlayerControls {
+	control := func(name string) string {
+		if prefix != "" {
+			name = prefix + strings.ToUpper(name[:1]) + name[1:]
+		}
+		key, ok := info.Keys[name]
+		if !ok || key < 0 || key > 0xF {
+			return ""
+		}
+		return fmt.Sprintf("%X", key)
+	}
+	return PlayerControls{
+		Up:    control("up"),
+		Down:  control("down"),
+		Left:  control("left"),
+		Right: control("right"),
+		A:     control("a"),
+		B:     control("b"),
+	}
+}
@@ -0,0 +1,96 @@
+package interpreter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeRomDatabase writes a programs.json listing pointsProgram.
+func writeRomDatabase(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "programs.json")
+	data := `[{
+		"title": "Points",
+		"authors": ["Tester"],
+		"roms": {"` + RomHash(pointsProgram) + `": {"platforms": ["originalChip8"], "tickrate": 15, "score": "[0x301]"}}
+	}]`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadRomDatabase(t *testing.T) {
+	db, err := LoadRomDatabase(writeRomDatabase(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, ok := db.Lookup(pointsProgram)
+	if !ok {
+		t.Fatal("Expected the ROM to be listed")
+	}
+	if info.Title != "Points" || info.Tickrate != 15 || info.Score != "[0x301]" || len(info.Authors) != 1 {
+		t.Errorf("Expected the database's details, got %+v", info)
+	}
+	if _, ok := db.Lookup(loopProgram); ok {
+		t.Error("Expected an unlisted ROM not to be found")
+	}
+
+	if _, err := LoadRomDatabase(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected a missing database to fail")
+	}
+}
+
+func TestRomInfoApply(t *testing.T) {
+	info := RomInfo{Platforms: []string{"originalChip8"}, Tickrate: 15, Score: "[0x301]"}
+
+	opts := DefaultCHIP8Options()
+	info.Apply(&opts)
+	if opts.CosmacQuirks != (COSMACQuirks{ResetVF: true, IncrementI: true}) || opts.ThrottleSpeed != 90 || opts.Score != "[0x301]" {
+		t.Errorf("Expected the ROM's settings, got %+v", opts)
+	}
+
+	opts = DefaultCHIP8Options()
+	opts.CosmacQuirks.ResetVF = true
+	opts.ThrottleSpeed = 50
+	opts.Score = "[0x300]"
+	info.Apply(&opts)
+	if opts.CosmacQuirks != (COSMACQuirks{ResetVF: true}) || opts.ThrottleSpeed != 50 || opts.Score != "[0x300]" {
+		t.Errorf("Expected the user's settings to be kept, got %+v", opts)
+	}
+}
+
+func TestFindRoms(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"points.ch8":       pointsProgram,
+		"games/LOOP.CH8":   loopProgram,
+		"games/readme.txt": []byte("not a ROM"),
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := LoadRomDatabase(writeRomDatabase(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roms, err := FindRoms(dir, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roms) != 2 {
+		t.Fatalf("Expected 2 ROMs, got %+v", roms)
+	}
+	// Sorted by title, from the database when the ROM is listed
+	if roms[0].Title() != "LOOP.CH8" || roms[0].Known || roms[0].Size != int64(len(loopProgram)) {
+		t.Errorf("Expected the unlisted ROM by file name, got %+v", roms[0])
+	}
+	if roms[1].Title() != "Points" || !roms[1].Known || roms[1].Hash != RomHash(pointsProgram) {
+		t.Errorf("Expected the listed ROM by title, got %+v", roms[1])
+	}
+}
@@ -0,0 +1,233 @@
+package interpreter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// How many scores each ROM's leaderboard keeps
+const leaderboardSize = 10
+
+// HighScore is a game's score on a leaderboard.
+type HighScore struct {
+	Score  int       `json:"score"`
+	Player string    `json:"player"`
+	Date   time.Time `json:"date"`
+}
+
+func (s HighScore) String() string {
+	return fmt.Sprintf("%6d  %-10s %s", s.Score, s.Player, s.Date.Format(time.DateOnly))
+}
+
+// Leaderboard holds the best scores for each ROM, best first, by the SHA1 hash of
+// the ROM.
+type Leaderboard map[string][]HighScore
+
+// LoadLeaderboard reads a leaderboard saved by Save. It's empty if the file
+// doesn't exist yet.
+func LoadLeaderboard(path string) (Leaderboard, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Leaderboard{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	board := Leaderboard{}
+	if err := json.Unmarshal(data, &board); err != nil {
+		return nil, fmt.Errorf("%s: not a leaderboard: %w", path, err)
+	}
+	return board, nil
+}
+
+// Save writes the leaderboard to a file, making its directory if need be.
+func (board Leaderboard) Save(path string) error {
+	data, err := json.MarshalIndent(board, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Add puts a score on a ROM's leaderboard, returning its place from 1, or 0 if it
+// didn't make the cut. Ties go to whoever got there first.
+func (board Leaderboard) Add(hash string, score HighScore) int {
+	scores := board[hash]
+	place := len(scores)
+	for i, s := range scores {
+		if score.Score > s.Score {
+			place = i
+			break
+		}
+	}
+	if place >= leaderboardSize {
+		return 0
+	}
+	board[hash] = slices.Insert(scores, place, score)[:min(len(scores)+1, leaderboardSize)]
+	return place + 1
+}
+
+// ScoreFunc rates the state of the machine, usually from a score in memory.
+type ScoreFunc func(chip8 *CHIP8) float64
+
+// DoneFunc reports whether an episode is over.
+type DoneFunc func(chip8 *CHIP8) bool
+
+// ParseScore compiles an expression over registers and memory into a ScoreFunc,
+// like "[0x2F0]" for a byte, or "[0x2F0]*100 + [0x2F1]*10 + [0x2F2]" for BCD
+// digits. It's written like a watchpoint condition.
+func ParseScore(source string) (ScoreFunc, error) {
+	expr, err := parseExpression(source)
+	if err != nil {
+		return nil, fmt.Errorf("score %q: %w", source, err)
+	}
+	return func(chip8 *CHIP8) float64 { return float64(expr(chip8)) }, nil
+}
+
+// ParseDone compiles a condition over registers and memory into a DoneFunc, like
+// "[0x2F1] == 0".
+func ParseDone(source string) (DoneFunc, error) {
+	expr, err := parseExpression(source)
+	if err != nil {
+		return nil, fmt.Errorf("done %q: %w", source, err)
+	}
+	return func(chip8 *CHIP8) bool { return expr(chip8) != 0 }, nil
+}
+
+// HighScores follows the score a ROM keeps in memory and records the best of
+// each game on a leaderboard file. A game is over once its score goes down, like
+// when the next game starts from 0, or when the interpreter stops. Games played
+// with cheats on, or changed by hand with the memory viewer, a script or a
+// debugger, aren't recorded.
+type HighScores struct {
+	chip8  *CHIP8
+	score  ScoreFunc
+	path   string
+	hash   string
+	player string
+	board  Leaderboard
+
+	// The score after the last frame, and the best of this game
+	current, best int
+	cheated       bool
+}
+
+// TrackHighScores records the scores of the ROM the interpreter is running
+// under the player's name, using the score expression in its options.
+func TrackHighScores(chip8 *CHIP8, path, player string) (*HighScores, error) {
+	score, err := ParseScore(chip8.Options.Score)
+	if err != nil {
+		return nil, err
+	}
+	board, err := LoadLeaderboard(path)
+	if err != nil {
+		return nil, err
+	}
+	h := &HighScores{
+		chip8:  chip8,
+		score:  score,
+		path:   path,
+		hash:   RomHash(chip8.program),
+		player: player,
+		board:  board,
+	}
+	h.current = h.read()
+	h.best = h.current
+	chip8.HighScores = h
+	return h, nil
+}
+
+func (h *HighScores) read() int {
+	return int(h.score(h.chip8))
+}
+
+// afterFrame checks the score once a frame.
+func (h *HighScores) afterFrame() {
+	score := h.read()
+	if score < h.current {
+		h.gameOver()
+	}
+	h.current = score
+	h.best = max(h.best, score)
+	h.cheated = h.cheated || h.chip8.cheating()
+}
+
+// gameOver records the best score of the game that just ended, and starts the
+// next one.
+func (h *HighScores) gameOver() {
+	best, cheated := h.best, h.cheated
+	h.best, h.cheated = 0, false
+	if best <= 0 || cheated {
+		return
+	}
+
+	// Another game may have saved scores since this one started
+	if board, err := LoadLeaderboard(h.path); err == nil {
+		h.board = board
+	}
+	place := h.board.Add(h.hash, HighScore{Score: best, Player: h.player, Date: time.Now()})
+	if place == 0 {
+		return
+	}
+	if err := h.board.Save(h.path); err != nil {
+		h.chip8.Logger.Error("Could not save high scores", "err", err)
+		return
+	}
+	if place == 1 {
+		h.chip8.notify("New high score: %d", best)
+	} else {
+		h.chip8.notify("High score #%d: %d", place, best)
+	}
+}
+
+// Close records the game in progress.
+func (h *HighScores) Close() {
+	h.gameOver()
+}
+
+// Scores lists the ROM's leaderboard, best first.
+func (h *HighScores) Scores() []HighScore {
+	return h.board[h.hash]
+}
+
+// top is the best score yet, this game included.
+func (h *HighScores) top() int {
+	if scores := h.Scores(); len(scores) > 0 {
+		return max(scores[0].Score, h.best)
+	}
+	return h.best
+}
+
+// toggleLeaderboard shows or hides the ROM's high scores.
+func (chip8 *CHIP8) toggleLeaderboard() {
+	if chip8.HighScores == nil {
+		chip8.notify("No score set for this ROM")
+		return
+	}
+	chip8.hud.leaderboard = !chip8.hud.leaderboard
+}
+
+// leaderboardLines describes the ROM's high scores, for the overlay.
+func (chip8 *CHIP8) leaderboardLines() []string {
+	h := chip8.HighScores
+	if h == nil || !chip8.hud.leaderboard {
+		return nil
+	}
+	lines := []string{fmt.Sprintf("Score %d  Best %d", h.current, h.top())}
+	for i, score := range h.Scores() {
+		lines = append(lines, fmt.Sprintf("%2d. %s", i+1, score))
+	}
+	if len(h.Scores()) == 0 {
+		lines = append(lines, "No high scores yet")
+	}
+	return lines
+}
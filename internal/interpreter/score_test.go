@@ -0,0 +1,120 @@
+package interpreter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLeaderboardAdd(t *testing.T) {
+	board := Leaderboard{}
+	for i := 1; i <= leaderboardSize; i++ {
+		board.Add("rom", HighScore{Score: i * 10})
+	}
+	if place := board.Add("rom", HighScore{Score: 55, Player: "new"}); place != 6 {
+		t.Errorf("Expected 55 to place 6th, got %d", place)
+	}
+	if place := board.Add("rom", HighScore{Score: 10}); place != 0 {
+		t.Errorf("Expected 10 not to place, got %d", place)
+	}
+
+	scores := board["rom"]
+	if len(scores) != leaderboardSize || scores[0].Score != 100 || scores[5].Player != "new" {
+		t.Fatalf("Expected the best %d scores, got %v", leaderboardSize, scores)
+	}
+	if !slices.IsSortedFunc(scores, func(a, b HighScore) int { return b.Score - a.Score }) {
+		t.Errorf("Expected the best scores first, got %v", scores)
+	}
+}
+
+func TestHighScores(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores.json")
+	options := DefaultCHIP8Options()
+	options.Score = "[0x301]"
+	chip8 := NewCHIP8(&pointsProgram, options)
+	if _, err := TrackHighScores(chip8, path, "tester"); err != nil {
+		t.Fatal(err)
+	}
+
+	// play scores points with key 5 held, then starts over, which ends the game
+	play := func() {
+		chip8.pressedKeys = []byte{5}
+		chip8.dirtyKeys = true
+		for i := 0; i < 6; i++ {
+			chip8.RunFrame()
+		}
+		chip8.Reset()
+		chip8.RunFrame()
+	}
+	play()
+	chip8.Cheats = []Cheat{{Address: 0x400, Value: 1}}
+	play()
+
+	// Nor are games changed from the memory viewer or a script
+	chip8.Cheats = nil
+	for _, key := range []string{"f3", "enter", "0", "0", "esc", "f3"} {
+		chip8.memoryViewerKey(key)
+	}
+	play()
+	script := filepath.Join(t.TempDir(), "poke.lua")
+	if err := os.WriteFile(script, []byte("chip8.poke(0x301, 99)"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadScript(chip8, script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	play()
+	chip8.HighScores.Close()
+
+	board, err := LoadLeaderboard(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scores := board[RomHash(pointsProgram)]
+	if len(scores) != 1 || scores[0].Score != 3 || scores[0].Player != "tester" {
+		t.Errorf("Expected one game of 3 points, without the ones with cheats or changes, got %v", scores)
+	}
+}
+
+func TestTamper(t *testing.T) {
+	edits := map[string]func(chip8 *CHIP8){
+		"memory viewer": func(chip8 *CHIP8) {
+			for _, key := range []string{"f3", "enter", "0", "0", "esc"} {
+				chip8.memoryViewerKey(key)
+			}
+		},
+		"GDB": func(chip8 *CHIP8) {
+			(&gdbSession{chip8: chip8}).setRegister(0, []byte{1})
+		},
+		"DAP": func(chip8 *CHIP8) {
+			args := json.RawMessage(fmt.Sprintf(`{"variablesReference": %d, "name": "V0", "value": "1"}`, dapRegisters))
+			if _, err := (&DAPServer{chip8: chip8}).setVariable(args); err != nil {
+				t.Fatal(err)
+			}
+		},
+	}
+	for name, edit := range edits {
+		t.Run(name, func(t *testing.T) {
+			options := DefaultCHIP8Options()
+			options.Score = "[0x301]"
+			chip8 := NewCHIP8(&pointsProgram, options)
+			if _, err := TrackHighScores(chip8, filepath.Join(t.TempDir(), "scores.json"), "tester"); err != nil {
+				t.Fatal(err)
+			}
+			chip8.RunFrame()
+			if chip8.HighScores.cheated {
+				t.Fatal("Expected a fair game before the edit")
+			}
+			edit(chip8)
+			chip8.RunFrame()
+			if !chip8.HighScores.cheated {
+				t.Error("Expected the edit to count as cheating")
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package interpreter
+
+import (
+	"fmt"
+	"image/png"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Script runs a Lua script alongside a program, to automate tests or play
+// tool-assisted runs. The script registers callbacks for things the program
+// does, and uses the chip8 table to inspect and control the machine:
+//
+//	chip8.on_frame(function(frame) ... end)            after each frame
+//	chip8.on_instruction(function(pc, opcode) ... end) before each instruction
+//	chip8.on_write(function(addr, length) ... end)     after FX33 and FX55 store
+//	chip8.on_draw(function(x, y, height, addr) ... end) after DXYN draws
+//
+//	chip8.peek(addr), chip8.poke(addr, value)          memory
+//	chip8.reg(name), chip8.set_reg(name, value)        V0-VF, I, PC, DT, ST and SP
+//	chip8.press(key [, frames]), chip8.release(key)    hold keypad keys, 1 frame by default
+//	chip8.screenshot(path [, scale])                   save the display as a PNG
+//	chip8.save_state([path]), chip8.load_state(state)  snapshots, in memory or in files
+//	chip8.frame(), chip8.cycles()                      frames and instructions run
+//	chip8.pause(), chip8.exit([code])                  stop the program
+type Script struct {
+	chip8 *CHIP8
+	lua   *lua.LState
+	path  string
+
+	onFrame, onInstruction, onWrite, onDraw []*lua.LFunction
+
+	// Keys the script holds, and for how many more frames
+	held   map[byte]int
+	frames uint64
+
+	// Set by chip8.exit, to end the run
+	exit     bool
+	exitCode int
+	// A callback failed, so the script stops being called
+	failed bool
+}
+
+// LoadScript runs a Lua script, which sets up its callbacks for the program
+// about to run.
+func LoadScript(chip8 *CHIP8, path string) (*Script, error) {
+	s := &Script{chip8: chip8, lua: lua.NewState(), path: path, held: map[byte]int{}}
+	s.lua.SetGlobal("chip8", s.lua.SetFuncs(s.lua.NewTable(), map[string]lua.LGFunction{
+		"on_frame":       s.register(&s.onFrame),
+		"on_instruction": s.register(&s.onInstruction),
+		"on_write":       s.register(&s.onWrite),
+		"on_draw":        s.register(&s.onDraw),
+		"peek":           s.peek,
+		"poke":           s.poke,
+		"reg":            s.reg,
+		"set_reg":        s.setReg,
+		"press":          s.press,
+		"release":        s.release,
+		"screenshot":     s.screenshot,
+		"save_state":     s.saveState,
+		"load_state":     s.loadState,
+		"frame":          func(L *lua.LState) int { L.Push(lua.LNumber(s.frames)); return 1 },
+		"cycles":         func(L *lua.LState) int { L.Push(lua.LNumber(s.chip8.cycles)); return 1 },
+		"pause":          s.pause,
+		"exit":           s.exitRun,
+	}))
+	s.lua.SetGlobal("print", s.lua.NewFunction(s.print))
+
+	chip8.Script = s
+	if err := s.lua.DoFile(path); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close stops the script.
+func (s *Script) Close() {
+	s.lua.Close()
+	if s.chip8.Script == s {
+		s.chip8.Script = nil
+	}
+}
+
+// ExitCode is the code the script asked to exit with, if it did.
+func (s *Script) ExitCode() (int, bool) {
+	return s.exitCode, s.exit
+}
+
+func (s *Script) exited() bool {
+	return s != nil && s.exit
+}
+
+// call runs each callback, giving up on the script if one fails.
+func (s *Script) call(callbacks []*lua.LFunction, args ...lua.LValue) {
+	if s.failed {
+		return
+	}
+	for _, callback := range callbacks {
+		if err := s.lua.CallByParam(lua.P{Fn: callback, Protect: true}, args...); err != nil {
+			s.chip8.Logger.Error("Script failed, so it won't be called again", "script", s.path, "err", err)
+			s.failed = true
+			return
+		}
+	}
+}
+
+// beforeFrame holds the keys the script pressed.
+func (s *Script) beforeFrame() {
+	if len(s.held) == 0 {
+		return
+	}
+	for key := range s.held {
+		if !slices.Contains(s.chip8.pressedKeys, key) {
+			s.chip8.pressedKeys = append(s.chip8.pressedKeys, key)
+		}
+	}
+	s.chip8.dirtyKeys = true
+}
+
+func (s *Script) afterFrame() {
+	for key, frames := range s.held {
+		if frames <= 1 {
+			s.releaseKey(key)
+		} else {
+			s.held[key] = frames - 1
+		}
+	}
+	s.frames++
+	s.call(s.onFrame, lua.LNumber(s.frames))
+}
+
+func (s *Script) instruction(pc uint16, instruction Instruction) {
+	if len(s.onInstruction) > 0 {
+		s.call(s.onInstruction, lua.LNumber(pc), lua.LNumber(instruction))
+	}
+}
+
+func (s *Script) wrote(addr uint16, length uint16) {
+	if len(s.onWrite) > 0 {
+		s.call(s.onWrite, lua.LNumber(addr), lua.LNumber(length))
+	}
+}
+
+func (s *Script) drew(x, y byte, height uint16, addr uint16) {
+	if len(s.onDraw) > 0 {
+		s.call(s.onDraw, lua.LNumber(x), lua.LNumber(y), lua.LNumber(height), lua.LNumber(addr))
+	}
+}
+
+func (s *Script) register(callbacks *[]*lua.LFunction) lua.LGFunction {
+	return func(L *lua.LState) int {
+		*callbacks = append(*callbacks, L.CheckFunction(1))
+		return 0
+	}
+}
+
+// checkAddress reads an address argument, raising an error if it's outside memory.
+func checkAddress(L *lua.LState, n int) uint16 {
+	addr := L.CheckInt(n)
+	if addr < 0 || addr >= memorySize {
+		L.ArgError(n, fmt.Sprintf("%d is not an address in memory", addr))
+	}
+	return uint16(addr)
+}
+
+func checkByte(L *lua.LState, n int) byte {
+	value := L.CheckInt(n)
+	if value < 0 || value > 0xFF {
+		L.ArgError(n, fmt.Sprintf("%d is not a byte", value))
+	}
+	return byte(value)
+}
+
+func (s *Script) peek(L *lua.LState) int {
+	L.Push(lua.LNumber(s.chip8.memory[checkAddress(L, 1)]))
+	return 1
+}
+
+func (s *Script) poke(L *lua.LState) int {
+	addr := checkAddress(L, 1)
+	s.chip8.memory[addr] = checkByte(L, 2)
+	s.chip8.tamper()
+	s.chip8.memview.wrote(addr, 1)
+	return 0
+}
+
+func (s *Script) reg(L *lua.LState) int {
+	switch name := strings.ToUpper(L.CheckString(1)); {
+	case name == "PC":
+		L.Push(lua.LNumber(s.chip8.pc))
+	case name == "SP":
+		L.Push(lua.LNumber(len(s.chip8.stack)))
+	case isWatchableRegister(name):
+		L.Push(lua.LNumber(s.chip8.registerState().get(name)))
+	default:
+		L.ArgError(1, fmt.Sprintf("unknown register %q", name))
+	}
+	return 1
+}
+
+func (s *Script) setReg(L *lua.LState) int {
+	chip8 := s.chip8
+	switch name := strings.ToUpper(L.CheckString(1)); {
+	case name == "PC":
+		chip8.pc = checkAddress(L, 2)
+	case name == "I":
+		chip8.I = checkAddress(L, 2)
+	case name == "DT":
+		chip8.delayTimer = checkByte(L, 2)
+	case name == "ST":
+		chip8.soundTimer = checkByte(L, 2)
+	case isWatchableRegister(name):
+		index, _ := strconv.ParseUint(name[1:], 16, 4)
+		chip8.V[index] = checkByte(L, 2)
+	default:
+		L.ArgError(1, fmt.Sprintf("%q can't be set", name))
+	}
+	chip8.tamper()
+	return 0
+}
+
+func checkKey(L *lua.LState, n int) byte {
+	key := L.CheckInt(n)
+	if key < 0 || key > 0xF {
+		L.ArgError(n, fmt.Sprintf("%d is not a keypad key", key))
+	}
+	return byte(key)
+}
+
+func (s *Script) press(L *lua.LState) int {
+	key := checkKey(L, 1)
+	s.held[key] = max(L.OptInt(2, 1), 1)
+	return 0
+}
+
+func (s *Script) release(L *lua.LState) int {
+	s.releaseKey(checkKey(L, 1))
+	return 0
+}
+
+func (s *Script) releaseKey(key byte) {
+	delete(s.held, key)
+	s.chip8.pressedKeys = slices.DeleteFunc(s.chip8.pressedKeys, func(k byte) bool { return k == key })
+}
+
+func (s *Script) screenshot(L *lua.LState) int {
+	path := L.CheckString(1)
+	scale := L.OptInt(2, s.chip8.Options.DisplayScaleFactor)
+	f, err := os.Create(path)
+	if err != nil {
+		L.RaiseError("%v", err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, s.chip8.display.screenshot(scale)); err != nil {
+		L.RaiseError("%v", err)
+	}
+	return 0
+}
+
+// saveState returns a snapshot, and writes it to a file if given a path.
+func (s *Script) saveState(L *lua.LState) int {
+	state := s.chip8.SaveState()
+	if L.GetTop() >= 1 {
+		f, err := os.Create(L.CheckString(1))
+		if err != nil {
+			L.RaiseError("%v", err)
+		}
+		defer f.Close()
+		if err := state.Write(f); err != nil {
+			L.RaiseError("%v", err)
+		}
+	}
+	ud := L.NewUserData()
+	ud.Value = state
+	L.Push(ud)
+	return 1
+}
+
+// loadState restores a snapshot from save_state, or from a file.
+func (s *Script) loadState(L *lua.LState) int {
+	var err error
+	switch value := L.Get(1).(type) {
+	case *lua.LUserData:
+		state, ok := value.Value.(*State)
+		if !ok {
+			L.ArgError(1, "not a saved state")
+		}
+		err = s.chip8.LoadState(state)
+	case lua.LString:
+		err = s.chip8.LoadStateFile(string(value))
+	default:
+		L.ArgError(1, "expected a saved state or a path")
+	}
+	if err != nil {
+		L.RaiseError("%v", err)
+	}
+	s.chip8.tamper()
+	return 0
+}
+
+func (s *Script) pause(L *lua.LState) int {
+	if !s.chip8.control.paused {
+		s.chip8.togglePause()
+	}
+	return 0
+}
+
+func (s *Script) exitRun(L *lua.LState) int {
+	s.exit, s.exitCode = true, L.OptInt(1, 0)
+	return 0
+}
+
+// print logs its arguments, since the terminal may be showing the display.
+func (s *Script) print(L *lua.LState) int {
+	var args []string
+	for i := 1; i <= L.GetTop(); i++ {
+		args = append(args, L.ToStringMeta(L.Get(i)).String())
+	}
+	s.chip8.Logger.Info(strings.Join(args, "\t"), "script", s.path)
+	return 0
+}
@@ -0,0 +1,104 @@
+package interpreter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScript(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.lua")
+	script := `
+writes = 0
+chip8.on_write(function(addr, length)
+  assert(addr == 0x300 and length == 3)
+  writes = writes + 1
+end)
+chip8.on_instruction(function(pc, opcode)
+  if pc == 0x208 then assert(opcode == 0xC2FF) end
+end)
+
+chip8.press(5, 4)
+chip8.on_frame(function(frame)
+  if frame == 4 then
+    -- Two rounds with key 5 held
+    assert(chip8.peek(0x301) == 2, "expected 2 points, got " .. chip8.peek(0x301))
+    assert(writes == 2)
+    saved = chip8.save_state()
+    chip8.set_reg("V1", 9)
+    chip8.poke(0x301, 9)
+  elseif frame == 5 then
+    assert(chip8.reg("v1") == 9)
+    chip8.load_state(saved)
+    assert(chip8.reg("V1") == 2 and chip8.peek(0x301) == 2)
+    chip8.screenshot("` + filepath.ToSlash(filepath.Join(dir, "shot.png")) + `", 2)
+    chip8.exit(3)
+  end
+end)
+`
+	if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	chip8 := NewCHIP8(&pointsProgram, DefaultCHIP8Options())
+	s, err := LoadScript(chip8, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for frame := 0; frame < 10 && !chip8.Finished(); frame++ {
+		chip8.RunFrame()
+	}
+	if s.failed {
+		t.Fatal("Expected the script's checks to pass")
+	}
+	if code, ok := s.ExitCode(); !ok || code != 3 || chip8.Script.frames != 5 {
+		t.Errorf("Expected the script to exit with 3 after 5 frames, got %d after %d", code, chip8.Script.frames)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "shot.png")); err != nil {
+		t.Errorf("Expected a screenshot: %v", err)
+	}
+	if len(chip8.pressedKeys) != 0 {
+		t.Errorf("Expected the held key to be released, got %v", chip8.pressedKeys)
+	}
+}
+
+func TestScriptErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.lua")
+	os.WriteFile(path, []byte(`chip8.poke(0x1000, 1)`), 0o644)
+	chip8 := NewCHIP8(&pointsProgram, DefaultCHIP8Options())
+	if _, err := LoadScript(chip8, path); err == nil || !strings.Contains(err.Error(), "not an address") {
+		t.Errorf("Expected an error poking outside memory, got %v", err)
+	}
+	if chip8.Script != nil {
+		t.Error("Expected a failed script to be detached")
+	}
+}
+
+func TestSaveState(t *testing.T) {
+	chip8 := NewCHIP8(&pointsProgram, DefaultCHIP8Options())
+	chip8.display.content.XORByte(0, 3, 4, 0xF0)
+	chip8.RunFrame()
+	path := filepath.Join(t.TempDir(), "points.state")
+	if err := chip8.SaveStateFile(path); err != nil {
+		t.Fatal(err)
+	}
+	saved := chip8.SaveState()
+
+	chip8.Reset()
+	if err := chip8.LoadStateFile(path); err != nil {
+		t.Fatal(err)
+	}
+	restored := chip8.SaveState()
+	if restored.PC != saved.PC || restored.Memory != saved.Memory || string(restored.Pixels) != string(saved.Pixels) {
+		t.Error("Expected the machine back the way it was saved")
+	}
+	if !chip8.display.content.Pixel(0, 3, 4) || chip8.display.content.Pixel(0, 7, 4) {
+		t.Error("Expected the display restored")
+	}
+	if chip8.hud.sampledFrom != saved.Cycles {
+		t.Errorf("Expected the IPS sample to start over from %d cycles, got %d", saved.Cycles, chip8.hud.sampledFrom)
+	}
+}
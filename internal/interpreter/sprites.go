@@ -0,0 +1,146 @@
+package interpreter
+
+import (
+	"cmp"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// SpriteRecorder collects the sprites a program draws with DXYN.
+type SpriteRecorder struct {
+	// Draws by address and content, since sprites built in memory change
+	draws map[string]*SpriteDraw
+}
+
+func NewSpriteRecorder() *SpriteRecorder {
+	return &SpriteRecorder{draws: map[string]*SpriteDraw{}}
+}
+
+// SpriteDraw is a sprite drawn from an address, and how many times it was.
+type SpriteDraw struct {
+	Address uint16
+	Count   uint64
+	Data    []byte
+}
+
+// Sprite is a distinct sprite image, and every address it was drawn from.
+type Sprite struct {
+	Data  []byte
+	Draws []SpriteDraw
+}
+
+// Count is how many times the sprite was drawn, from any address.
+func (s Sprite) Count() uint64 {
+	var count uint64
+	for _, draw := range s.Draws {
+		count += draw.Count
+	}
+	return count
+}
+
+// record counts a draw of height bytes from memory at addr.
+func (r *SpriteRecorder) record(memory []byte, addr uint16, height uint16) {
+	if height == 0 || int(addr) >= len(memory) {
+		return
+	}
+	data := memory[addr:min(int(addr+height), len(memory))]
+	key := fmt.Sprintf("%04X:%X", addr, data)
+	draw, ok := r.draws[key]
+	if !ok {
+		draw = &SpriteDraw{Address: addr, Data: slices.Clone(data)}
+		r.draws[key] = draw
+	}
+	draw.Count++
+}
+
+// Sprites returns the distinct sprites drawn, in address order.
+func (r *SpriteRecorder) Sprites() []Sprite {
+	var draws []SpriteDraw
+	for _, draw := range r.draws {
+		draws = append(draws, *draw)
+	}
+	slices.SortFunc(draws, func(a, b SpriteDraw) int {
+		if a.Address != b.Address {
+			return cmp.Compare(a.Address, b.Address)
+		}
+		return slices.Compare(a.Data, b.Data)
+	})
+
+	var sprites []Sprite
+	index := map[string]int{}
+	for _, draw := range draws {
+		key := string(draw.Data)
+		i, ok := index[key]
+		if !ok {
+			i = len(sprites)
+			index[key] = i
+			sprites = append(sprites, Sprite{Data: draw.Data})
+		}
+		sprites[i].Draws = append(sprites[i].Draws, draw)
+	}
+	return sprites
+}
+
+// How many sprites a row of the sheet holds
+const spriteSheetColumns = 16
+
+// SpriteSheet draws the sprites in a grid, left to right and top to bottom, in
+// the palette's off and on colors. Each sprite pixel is a scale x scale square.
+func SpriteSheet(sprites []Sprite, palette Palette, scale int) *image.Paletted {
+	scale = max(scale, 1)
+	tallest := 1
+	for _, sprite := range sprites {
+		tallest = max(tallest, len(sprite.Data))
+	}
+	// A pixel of the off color between sprites, in the background color
+	cellWidth, cellHeight := (8+1)*scale, (tallest+1)*scale
+	columns := min(max(len(sprites), 1), spriteSheetColumns)
+	rows := max((len(sprites)+spriteSheetColumns-1)/spriteSheetColumns, 1)
+
+	background := blendColors(toRGBA(palette[0]), color.Black, 0x60)
+	img := image.NewPaletted(
+		image.Rect(0, 0, columns*cellWidth+scale, rows*cellHeight+scale),
+		color.Palette{background, toRGBA(palette[0]), toRGBA(palette[1])},
+	)
+	for i, sprite := range sprites {
+		left, top := (i%spriteSheetColumns)*cellWidth+scale, (i/spriteSheetColumns)*cellHeight+scale
+		for y, line := range sprite.Data {
+			for x := 0; x < 8; x++ {
+				index := uint8(1)
+				if line>>(7-x)&1 == 1 {
+					index = 2
+				}
+				for dy := 0; dy < scale; dy++ {
+					start := img.PixOffset(left+x*scale, top+y*scale+dy)
+					for dx := 0; dx < scale; dx++ {
+						img.Pix[start+dx] = index
+					}
+				}
+			}
+		}
+	}
+	return img
+}
+
+// WriteSpriteListing lists each sprite on the sheet, with where it was drawn from.
+func WriteSpriteListing(w io.Writer, sprites []Sprite) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Sprite\tHeight\tDraws\tAddresses")
+	for i, sprite := range sprites {
+		var addresses []string
+		for _, draw := range sprite.Draws {
+			address := fmt.Sprintf("0x%03X", draw.Address)
+			if draw.Address < programStartAddress {
+				address += " (font)"
+			}
+			addresses = append(addresses, address)
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%s\n", i, len(sprite.Data), sprite.Count(), strings.Join(addresses, ", "))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,50 @@
+package interpreter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSpriteRecorder(t *testing.T) {
+	program := []byte{
+		0xA2, 0x10, // 200: LD I, 0x210
+		0xD0, 0x13, // 202: DRW V0, V0, 3
+		0xA2, 0x13, // 204: LD I, 0x213
+		0xD0, 0x13, // 206: DRW V0, V0, 3
+		0xF0, 0x29, // 208: LD F, V0
+		0xD0, 0x15, // 20A: DRW V0, V0, 5
+		0x12, 0x0C, // 20C: JP 0x20C
+		0x00, 0x00, // 20E
+		0xE7, 0x81, 0xE7, // 210: a sprite
+		0xE7, 0x81, 0xE7, // 213: the same sprite again
+	}
+	chip8 := NewCHIP8(&program, DefaultCHIP8Options())
+	chip8.Sprites = NewSpriteRecorder()
+	for i := 0; i < 5; i++ {
+		chip8.RunFrame()
+	}
+
+	sprites := chip8.Sprites.Sprites()
+	if len(sprites) != 2 {
+		t.Fatalf("Expected the font 0 and one distinct sprite, got %d", len(sprites))
+	}
+	if len(sprites[1].Draws) != 2 || sprites[1].Count() != 2 || sprites[1].Draws[1].Address != 0x213 {
+		t.Errorf("Expected the sprite to be drawn from 0x210 and 0x213, got %+v", sprites[1].Draws)
+	}
+
+	var listing strings.Builder
+	WriteSpriteListing(&listing, sprites)
+	if !strings.Contains(listing.String(), "0x000 (font)") || !strings.Contains(listing.String(), "0x210, 0x213") {
+		t.Errorf("Expected the listing to show every address, got\n%s", listing.String())
+	}
+
+	sheet := SpriteSheet(sprites, Palettes[DefaultPalette], 2)
+	// Two cells of 9x6 pixels plus a border, doubled
+	if bounds := sheet.Bounds(); bounds.Dx() != 2*(2*9+1) || bounds.Dy() != 2*(6+1) {
+		t.Errorf("Unexpected sheet size %v", bounds)
+	}
+	// The top left pixel of the second sprite is on
+	if index := sheet.ColorIndexAt(2+9*2, 2); index != 2 {
+		t.Errorf("Expected an on pixel, got color %d", index)
+	}
+}
@@ -0,0 +1,117 @@
+package interpreter
+
+import (
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"slices"
+)
+
+// State is a snapshot of the machine, to go back to later. The random numbers
+// CXNN gives aren't part of it.
+type State struct {
+	Memory     [memorySize]byte
+	V          [16]byte
+	I, PC      uint16
+	Stack      []uint16
+	DelayTimer byte
+	SoundTimer byte
+	// The display, a byte per pixel
+	Width, Height int
+	Pixels        []byte
+	Cycles        uint64
+}
+
+// SaveState takes a snapshot of the machine.
+func (chip8 *CHIP8) SaveState() *State {
+	state := &State{
+		Memory:     chip8.memory,
+		V:          chip8.V,
+		I:          chip8.I,
+		PC:         chip8.pc,
+		Stack:      slices.Clone(chip8.stack),
+		DelayTimer: chip8.delayTimer,
+		SoundTimer: chip8.soundTimer,
+		Width:      chip8.display.width(),
+		Height:     chip8.display.height(),
+		Cycles:     chip8.cycles,
+	}
+	state.Pixels = make([]byte, state.Width*state.Height)
+	chip8.display.content.Expand(0, state.Pixels)
+	return state
+}
+
+// LoadState puts the machine back the way it was when the state was saved.
+func (chip8 *CHIP8) LoadState(state *State) error {
+	if state.Width != chip8.display.width() || state.Height != chip8.display.height() || len(state.Pixels) != state.Width*state.Height {
+		return fmt.Errorf("state is for a %dx%d display, not %dx%d", state.Width, state.Height, chip8.display.width(), chip8.display.height())
+	}
+	chip8.memory = state.Memory
+	chip8.V = state.V
+	chip8.I = state.I
+	chip8.pc = state.PC
+	chip8.stack = slices.Clone(state.Stack)
+	chip8.delayTimer = state.DelayTimer
+	chip8.soundTimer = state.SoundTimer
+	chip8.cycles = state.Cycles
+	chip8.restartIPS()
+	chip8.display.content.Pack(0, state.Pixels)
+	chip8.display.dirty = true
+	return nil
+}
+
+// Hash sums up the machine, to check two machines are in the same state.
+func (state *State) Hash() uint64 {
+	h := fnv.New64a()
+	h.Write(state.Memory[:])
+	h.Write(state.V[:])
+	binary.Write(h, binary.LittleEndian, []uint16{state.I, state.PC})
+	binary.Write(h, binary.LittleEndian, state.Stack)
+	h.Write([]byte{state.DelayTimer, state.SoundTimer})
+	h.Write(state.Pixels)
+	return h.Sum64()
+}
+
+// Write saves the state to a file, or anywhere else.
+func (state *State) Write(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(state)
+}
+
+// ReadState reads a state written by Write.
+func ReadState(r io.Reader) (*State, error) {
+	state := &State{}
+	if err := gob.NewDecoder(r).Decode(state); err != nil {
+		return nil, fmt.Errorf("not a saved state: %w", err)
+	}
+	return state, nil
+}
+
+// SaveStateFile writes a snapshot of the machine to a file.
+func (chip8 *CHIP8) SaveStateFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := chip8.SaveState().Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadStateFile restores the machine from a file written by SaveStateFile.
+func (chip8 *CHIP8) LoadStateFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	state, err := ReadState(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return chip8.LoadState(state)
+}
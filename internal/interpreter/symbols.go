@@ -0,0 +1,121 @@
+package interpreter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SourceLine is a line of assembler source.
+type SourceLine struct {
+	File string
+	Line int
+}
+
+// SymbolMap ties program addresses to the assembler source lines and labels they
+// came from.
+type SymbolMap struct {
+	lines  map[uint16]SourceLine
+	labels map[uint16]string
+}
+
+// LoadSymbolMap reads a symbol map file. Source files named relative to the map
+// are taken to be beside it.
+//
+// Each line is an address followed by either a source line or a label:
+//
+//	# Comments start with a hash
+//	0x200 main
+//	0x200 pong.8o:12
+//	0x202 pong.8o:13
+func LoadSymbolMap(path string) (*SymbolMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	symbols, err := ParseSymbolMap(f, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return symbols, nil
+}
+
+// ParseSymbolMap reads a symbol map, resolving relative source files against dir.
+func ParseSymbolMap(r io.Reader, dir string) (*SymbolMap, error) {
+	symbols := &SymbolMap{lines: map[uint16]SourceLine{}, labels: map[uint16]string{}}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		address, symbol, ok := strings.Cut(line, " ")
+		symbol = strings.TrimSpace(symbol)
+		addr, err := strconv.ParseUint(address, 0, 16)
+		if !ok || symbol == "" || err != nil || addr >= memorySize {
+			return nil, fmt.Errorf("line %d: expected an address and a source line or label, got %q", n, line)
+		}
+
+		// Source lines end in a line number, and file names may have colons on Windows
+		if i := strings.LastIndex(symbol, ":"); i > 0 {
+			if number, err := strconv.Atoi(symbol[i+1:]); err == nil {
+				file := symbol[:i]
+				if !filepath.IsAbs(file) {
+					file = filepath.Join(dir, file)
+				}
+				symbols.lines[uint16(addr)] = SourceLine{File: filepath.Clean(file), Line: number}
+				continue
+			}
+		}
+		symbols.labels[uint16(addr)] = symbol
+	}
+	return symbols, scanner.Err()
+}
+
+// Source returns the source line an address was assembled from.
+func (m *SymbolMap) Source(addr uint16) (SourceLine, bool) {
+	if m == nil {
+		return SourceLine{}, false
+	}
+	line, ok := m.lines[addr]
+	return line, ok
+}
+
+// Addresses returns the addresses assembled from a source line, lowest first.
+func (m *SymbolMap) Addresses(file string, line int) []uint16 {
+	if m == nil {
+		return nil
+	}
+	file = filepath.Clean(file)
+	var addrs []uint16
+	for addr, source := range m.lines {
+		if source.Line == line && source.File == file {
+			addrs = append(addrs, addr)
+		}
+	}
+	slices.Sort(addrs)
+	return addrs
+}
+
+// Label names the code at an address by the closest label at or before it, like
+// "main+4".
+func (m *SymbolMap) Label(addr uint16) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	for start := int(addr); start >= 0; start-- {
+		if label, ok := m.labels[uint16(start)]; ok {
+			if start == int(addr) {
+				return label, true
+			}
+			return fmt.Sprintf("%s+%d", label, int(addr)-start), true
+		}
+	}
+	return "", false
+}
@@ -3,6 +3,13 @@ package interpreter
 // From https://rosepinetheme.com/palette/ingredients/
 
 import (
+	"encoding/hex"
+	"fmt"
+	"image/color"
+	"regexp"
+	"sort"
+	"strings"
+
 	"github.com/charmbracelet/lipgloss"
 )
 
@@ -20,3 +27,87 @@ var Colors = map[string]lipgloss.Color{
 	"Foam":    lipgloss.Color("#9ccfd8"),
 	"Iris":    lipgloss.Color("#c4a7e7"),
 }
+
+// Palette holds the colors for every combination of the two XO-CHIP bitplanes:
+// neither plane (off), plane 1 (on), plane 2, and both planes.
+// Original CHIP-8 only uses the first two.
+type Palette [4]lipgloss.Color
+
+const DefaultPalette = "rose-pine"
+
+var Palettes = map[string]Palette{
+	"rose-pine": {Colors["Iris"], Colors["Pine"], Colors["Love"], Colors["Gold"]},
+	// Monochrome P1 phosphor of early terminals
+	"green-phosphor": {"#0c1a0c", "#33ff33", "#1e8c1e", "#a8ffa8"},
+	// Amber P3 phosphor monitors
+	"amber": {"#1a0f00", "#ffb000", "#b36b00", "#ffd580"},
+	// The original Game Boy's four shades of green
+	"gameboy": {"#9bbc0f", "#0f380f", "#306230", "#8bac0f"},
+	// The defaults of John Earnest's Octo
+	"octo": {"#996600", "#ffcc00", "#ff6600", "#662200"},
+}
+
+var hexColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// ParseColor accepts either a #RRGGBB hex value or the name of a color in Colors.
+func ParseColor(s string) (lipgloss.Color, error) {
+	if hexColorPattern.MatchString(s) {
+		return lipgloss.Color(s), nil
+	}
+	for name, color := range Colors {
+		if strings.EqualFold(name, s) {
+			return color, nil
+		}
+	}
+	return "", fmt.Errorf("unknown color %q: use a #RRGGBB value or one of %s", s, strings.Join(sortedKeys(Colors), ", "))
+}
+
+// toRGBA converts a color without going through the terminal's color profile,
+// which turns lipgloss colors black when stdout isn't a color terminal.
+func toRGBA(c color.Color) color.RGBA {
+	if c, ok := c.(lipgloss.Color); ok && hexColorPattern.MatchString(string(c)) {
+		var rgb [3]byte
+		hex.Decode(rgb[:], []byte(c[1:]))
+		return color.RGBA{rgb[0], rgb[1], rgb[2], 0xFF}
+	}
+	r, g, b, a := c.RGBA()
+	return color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}
+}
+
+// ResolvePalette returns the palette named in the options, with any explicitly
+// configured on or off colors layered on top.
+func (opts *CHIP8Options) ResolvePalette() (Palette, error) {
+	name := opts.Palette
+	if name == "" {
+		name = DefaultPalette
+	}
+	palette, ok := Palettes[strings.ToLower(name)]
+	if !ok {
+		return Palette{}, fmt.Errorf("unknown palette %q: use one of %s", name, strings.Join(sortedKeys(Palettes), ", "))
+	}
+
+	if opts.OffColor != "" {
+		color, err := ParseColor(opts.OffColor)
+		if err != nil {
+			return Palette{}, fmt.Errorf("off_color: %w", err)
+		}
+		palette[0] = color
+	}
+	if opts.OnColor != "" {
+		color, err := ParseColor(opts.OnColor)
+		if err != nil {
+			return Palette{}, fmt.Errorf("on_color: %w", err)
+		}
+		palette[1] = color
+	}
+	return palette, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
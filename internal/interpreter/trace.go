@@ -0,0 +1,265 @@
+package interpreter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Trace formats
+const (
+	// One JSON object per line
+	TraceJSONL = "jsonl"
+	// Fixed size records, after a header
+	TraceBinary = "binary"
+)
+
+// TraceFormats lists the supported trace formats.
+var TraceFormats = []string{TraceJSONL, TraceBinary}
+
+// TraceFormatFor guesses the format of a trace file from its extension: binary
+// for .bin, otherwise JSONL.
+func TraceFormatFor(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".bin") {
+		return TraceBinary
+	}
+	return TraceJSONL
+}
+
+// Binary traces start with this, then a version byte
+var traceMagic = []byte("C8TR")
+
+const traceVersion = 1
+
+// TraceRecord is the machine state as an instruction is about to execute.
+type TraceRecord struct {
+	// Instructions executed before this one
+	Cycle    uint64   `json:"cycle"`
+	PC       uint16   `json:"pc"`
+	Opcode   uint16   `json:"opcode"`
+	Mnemonic string   `json:"mnemonic"`
+	V        [16]byte `json:"v"`
+	I        uint16   `json:"i"`
+	// Subroutines on the stack
+	SP uint8 `json:"sp"`
+	DT uint8 `json:"dt"`
+	ST uint8 `json:"st"`
+}
+
+// binaryTraceRecord is how a record is laid out in binary traces, little-endian.
+// The mnemonic is left out since it follows from the opcode.
+type binaryTraceRecord struct {
+	Cycle  uint64
+	PC     uint16
+	Opcode uint16
+	V      [16]byte
+	I      uint16
+	SP     uint8
+	DT     uint8
+	ST     uint8
+}
+
+// Tracer writes a record for every instruction executed.
+type Tracer struct {
+	w      *bufio.Writer
+	format string
+	json   *json.Encoder
+	err    error
+}
+
+// NewTracer starts a trace in the given format.
+func NewTracer(w io.Writer, format string) (*Tracer, error) {
+	if !slices.Contains(TraceFormats, format) {
+		return nil, fmt.Errorf("unknown trace format %q: use one of %s", format, strings.Join(TraceFormats, ", "))
+	}
+	t := &Tracer{w: bufio.NewWriter(w), format: format}
+	if format == TraceBinary {
+		t.w.Write(traceMagic)
+		t.w.WriteByte(traceVersion)
+	} else {
+		t.json = json.NewEncoder(t.w)
+	}
+	return t, nil
+}
+
+// record traces the instruction at the program counter, before it executes.
+func (t *Tracer) record(chip8 *CHIP8, pc uint16, instruction Instruction) {
+	if t.err != nil {
+		return
+	}
+	if t.format == TraceBinary {
+		t.err = binary.Write(t.w, binary.LittleEndian, binaryTraceRecord{
+			Cycle:  chip8.cycles,
+			PC:     pc,
+			Opcode: uint16(instruction),
+			V:      chip8.V,
+			I:      chip8.I,
+			SP:     uint8(len(chip8.stack)),
+			DT:     chip8.delayTimer,
+			ST:     chip8.soundTimer,
+		})
+		return
+	}
+	t.err = t.json.Encode(TraceRecord{
+		Cycle:    chip8.cycles,
+		PC:       pc,
+		Opcode:   uint16(instruction),
+		Mnemonic: instruction.Mnemonic(),
+		V:        chip8.V,
+		I:        chip8.I,
+		SP:       uint8(len(chip8.stack)),
+		DT:       chip8.delayTimer,
+		ST:       chip8.soundTimer,
+	})
+}
+
+// Close flushes the trace, reporting the first error writing it.
+func (t *Tracer) Close() error {
+	if err := t.w.Flush(); t.err == nil {
+		t.err = err
+	}
+	return t.err
+}
+
+// TraceReader reads back a trace in either format.
+type TraceReader struct {
+	r      *bufio.Reader
+	binary bool
+	line   int
+}
+
+// NewTraceReader reads a trace, telling the format from its contents.
+func NewTraceReader(r io.Reader) (*TraceReader, error) {
+	t := &TraceReader{r: bufio.NewReader(r)}
+	header, err := t.r.Peek(len(traceMagic) + 1)
+	if err == nil && bytes.Equal(header[:len(traceMagic)], traceMagic) {
+		if header[len(traceMagic)] != traceVersion {
+			return nil, fmt.Errorf("unsupported trace version %d", header[len(traceMagic)])
+		}
+		t.binary = true
+		t.r.Discard(len(header))
+	}
+	return t, nil
+}
+
+// Next returns the next record, or io.EOF at the end of the trace.
+func (t *TraceReader) Next() (TraceRecord, error) {
+	if t.binary {
+		var raw binaryTraceRecord
+		if err := binary.Read(t.r, binary.LittleEndian, &raw); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return TraceRecord{}, errors.New("trace ends partway through a record")
+			}
+			return TraceRecord{}, err
+		}
+		return TraceRecord{
+			Cycle:    raw.Cycle,
+			PC:       raw.PC,
+			Opcode:   raw.Opcode,
+			Mnemonic: Instruction(raw.Opcode).Mnemonic(),
+			V:        raw.V,
+			I:        raw.I,
+			SP:       raw.SP,
+			DT:       raw.DT,
+			ST:       raw.ST,
+		}, nil
+	}
+
+	for {
+		line, err := t.r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) == 0 {
+			if err != nil {
+				return TraceRecord{}, err
+			}
+			continue
+		}
+		t.line++
+		var record TraceRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return TraceRecord{}, fmt.Errorf("line %d: %w", t.line, err)
+		}
+		return record, nil
+	}
+}
+
+// TraceDifference is where two traces first disagree.
+type TraceDifference struct {
+	// Position of the records in their traces, from 0
+	Index int
+	A, B  TraceRecord
+	// Names of the fields that differ, or "end" if one trace stopped early
+	Fields []string
+}
+
+// DiffTraces compares two traces record by record, ignoring cycle counts and
+// mnemonics, which vary between emulators. Returns nil if they match.
+func DiffTraces(a, b *TraceReader) (*TraceDifference, error) {
+	for index := 0; ; index++ {
+		recordA, errA := a.Next()
+		recordB, errB := b.Next()
+		if errA != nil && errA != io.EOF {
+			return nil, fmt.Errorf("first trace: %w", errA)
+		}
+		if errB != nil && errB != io.EOF {
+			return nil, fmt.Errorf("second trace: %w", errB)
+		}
+		switch {
+		case errA == io.EOF && errB == io.EOF:
+			return nil, nil
+		case errA == io.EOF || errB == io.EOF:
+			return &TraceDifference{Index: index, A: recordA, B: recordB, Fields: []string{"end"}}, nil
+		}
+
+		if fields := recordA.differences(recordB); len(fields) > 0 {
+			return &TraceDifference{Index: index, A: recordA, B: recordB, Fields: fields}, nil
+		}
+	}
+}
+
+// differences lists the fields that differ between two records.
+func (r TraceRecord) differences(other TraceRecord) []string {
+	var fields []string
+	if r.PC != other.PC {
+		fields = append(fields, "pc")
+	}
+	if r.Opcode != other.Opcode {
+		fields = append(fields, "opcode")
+	}
+	for i := range r.V {
+		if r.V[i] != other.V[i] {
+			fields = append(fields, fmt.Sprintf("v%X", i))
+		}
+	}
+	if r.I != other.I {
+		fields = append(fields, "i")
+	}
+	if r.SP != other.SP {
+		fields = append(fields, "sp")
+	}
+	if r.DT != other.DT {
+		fields = append(fields, "dt")
+	}
+	if r.ST != other.ST {
+		fields = append(fields, "st")
+	}
+	return fields
+}
+
+// String shows the record like a line of a debugger.
+func (r TraceRecord) String() string {
+	var v strings.Builder
+	for i, value := range r.V {
+		if i > 0 {
+			v.WriteByte(' ')
+		}
+		fmt.Fprintf(&v, "%02X", value)
+	}
+	return fmt.Sprintf("#%d [%04X] %04X %-16s V=%s I=%04X SP=%d DT=%d ST=%d", r.Cycle, r.PC, r.Opcode, r.Mnemonic, v.String(), r.I, r.SP, r.DT, r.ST)
+}
@@ -0,0 +1,65 @@
+package interpreter
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestInstructionMnemonic(t *testing.T) {
+	tests := map[Instruction]string{
+		0x00E0: "CLS",
+		0x1228: "JP 0x228",
+		0x6310: "LD V3, 0x10",
+		0x8AB4: "ADD VA, VB",
+		0xD015: "DRW V0, V1, 5",
+		0xF265: "LD V2, [I]",
+		0x5121: "DW 0x5121",
+	}
+	for instruction, expected := range tests {
+		if got := instruction.Mnemonic(); got != expected {
+			t.Errorf("%04X: Expected %q, got %q", uint16(instruction), expected, got)
+		}
+	}
+}
+
+func TestTraceDiff(t *testing.T) {
+	// Record the same run in both formats, with a register changed partway through
+	trace := func(format string, changeAt uint64) *TraceReader {
+		var buf bytes.Buffer
+		tracer, err := NewTracer(&buf, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chip8 := &CHIP8{}
+		for chip8.cycles = 0; chip8.cycles < 10; chip8.cycles++ {
+			if chip8.cycles == changeAt {
+				chip8.V[3] = 0x10
+			}
+			tracer.record(chip8, programStartAddress+uint16(chip8.cycles)*2, 0x6310)
+		}
+		if err := tracer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		reader, err := NewTraceReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reader
+	}
+
+	diff, err := DiffTraces(trace(TraceJSONL, 20), trace(TraceBinary, 20))
+	if err != nil || diff != nil {
+		t.Errorf("Expected matching traces, got %+v (%v)", diff, err)
+	}
+
+	diff, err = DiffTraces(trace(TraceJSONL, 20), trace(TraceBinary, 4))
+	if err != nil || diff == nil {
+		t.Fatalf("Expected a difference, got %v", err)
+	}
+	if diff.Index != 4 || len(diff.Fields) != 1 || diff.Fields[0] != "v3" {
+		t.Errorf("Expected v3 to differ at record 4, got %v at %d", diff.Fields, diff.Index)
+	}
+	if diff.B.Mnemonic != "LD V3, 0x10" {
+		t.Errorf("Expected mnemonic from binary trace, got %q", diff.B.Mnemonic)
+	}
+}
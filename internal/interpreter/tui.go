@@ -1,7 +1,10 @@
 package interpreter
 
 import (
+	"bufio"
 	"errors"
+	"fmt"
+	"os"
 	"strings"
 	"time"
 
@@ -9,12 +12,29 @@ import (
 	"github.com/charmbracelet/lipgloss"
 )
 
-func RunTUI(chip8 *CHIP8, filename string) {
-	chip8.Logger.Info("Running TUI", "romFile", filename)
+func RunTUI(chip8 *CHIP8, filename string, graphics GraphicsMode) {
+	graphics = graphics.resolve()
+	chip8.Logger.Info("Running TUI", "romFile", filename, "graphics", graphics)
 
-	app := &App{Chip8: chip8}
+	app := &App{Chip8: chip8, graphics: graphics}
 
-	p := tea.NewProgram(app)
+	var opts []tea.ProgramOption
+	if graphics != GraphicsCells {
+		// BubbleTea's renderer truncates long lines, which mangles image escape
+		// sequences. Paint frames ourselves and only lean on BubbleTea for input.
+		opts = append(opts, tea.WithoutRenderer())
+		app.out = bufio.NewWriter(os.Stdout)
+		// Switch to the alternate screen and hide the cursor while running
+		os.Stdout.WriteString("\x1b[?1049h\x1b[?25l\x1b[2J")
+		defer os.Stdout.WriteString("\x1b[?25h\x1b[?1049l")
+	}
+
+	if stat, err := os.Stdin.Stat(); err == nil && stat.Mode()&os.ModeCharDevice == 0 {
+		// The ROM came from stdin, so read keys from the terminal instead
+		opts = append(opts, tea.WithInputTTY())
+	}
+
+	p := tea.NewProgram(app, opts...)
 	p.SetWindowTitle(filename)
 	if _, err := p.Run(); err != nil {
 		chip8.Logger.Fatalf("Could not start program :(\n%v\n", err)
@@ -32,8 +52,19 @@ type App struct {
 	CurrentInputDelay int
 	terminalHeight    int
 	terminalWidth     int
+	// How the display is painted. Anything but cells bypasses View.
+	graphics  GraphicsMode
+	out       *bufio.Writer
+	lastPaint time.Time
+	// Fast forward while the key is held, judged by key repeats
+	fastForwardUntil time.Time
+	// The memory viewer was drawn last paint, so closing it needs a clear
+	memoryWasOpen bool
 }
 
+// Longer than the delay between key repeats in most terminals
+const fastForwardHold = 300 * time.Millisecond
+
 type execMsg interface{}
 
 func (app *App) Init() tea.Cmd {
@@ -43,6 +74,7 @@ func (app *App) Init() tea.Cmd {
 }
 
 func (app *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	defer app.Chip8.lockDebugger()()
 
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
@@ -52,6 +84,7 @@ func (app *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		app.terminalHeight = msg.Height
 		app.terminalWidth = msg.Width
+		app.Chip8.display.dirty = true
 
 		if needsRepaint {
 			return app, tea.ClearScreen
@@ -59,11 +92,39 @@ func (app *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	// User pressed a key
 	case tea.KeyMsg:
-		if msg.String() == "ctrl+c" || msg.String() == "esc" {
+		if msg.String() != "ctrl+c" && app.Chip8.memoryViewerKey(msg.String()) {
+			break
+		}
+		switch msg.String() {
+		case "ctrl+c", "esc":
 			return app, tea.Quit
-		} else {
-			keypress, err := teaKeyToHex(msg)
-			if err == nil {
+		case "f5":
+			app.Chip8.togglePause()
+		case "f6":
+			app.Chip8.stepFrame()
+		case "f7":
+			app.Chip8.changeSpeed(-1)
+		case "f8":
+			app.Chip8.changeSpeed(1)
+		case "f9":
+			app.Chip8.Reset()
+			app.Chip8.notify("Reset")
+		case "f12":
+			app.Chip8.toggleCheats()
+		case "h":
+			app.Chip8.toggleLeaderboard()
+		case "tab":
+			// Terminals can't report releasing a key, so fast forward lasts as long
+			// as the key keeps repeating
+			app.fastForwardUntil = time.Now().Add(fastForwardHold)
+		default:
+			keypress, ok := app.Chip8.keypad.keys[msg.String()]
+			if !ok {
+				var err error
+				keypress, err = teaKeyToHex(msg)
+				ok = err == nil
+			}
+			if ok {
 				app.Chip8.Logger.Warnf("user pressing %X", keypress)
 				app.Chip8.pressedKeys = []byte{keypress}
 				app.Chip8.dirtyKeys = true
@@ -71,29 +132,6 @@ func (app *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 	}
-	elapsed := time.Since(lastDelayTimerUpdate)
-	if app.Chip8.delayTimer > 0 {
-		if elapsed >= decrementInterval {
-			app.Chip8.delayTimer--
-			elapsed -= decrementInterval
-			lastDelayTimerUpdate = lastDelayTimerUpdate.Add(decrementInterval)
-		}
-	}
-
-	elapsed = time.Since(lastSoundTimerUpdate)
-	if app.Chip8.soundTimer > 0 {
-		app.Chip8.beep.Play()
-		if elapsed >= decrementInterval {
-			app.Chip8.soundTimer--
-			elapsed -= decrementInterval
-			lastSoundTimerUpdate = lastSoundTimerUpdate.Add(decrementInterval)
-		}
-	} else {
-		if app.Chip8.beep.IsPlaying() {
-			app.Chip8.beep.Pause()
-			app.Chip8.beep.SetPosition(0)
-		}
-	}
 
 	// CurrentInputDelay prevents the pressed key from being cleared too quickly
 	if !app.Chip8.dirtyKeys && app.CurrentInputDelay == 0 {
@@ -102,9 +140,13 @@ func (app *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		app.CurrentInputDelay--
 	}
 
-	app.Chip8.stepInterpreter()
+	app.Chip8.setFastForward(time.Now().Before(app.fastForwardUntil))
+	app.Chip8.tick()
+	if app.graphics != GraphicsCells {
+		app.paint()
+	}
 
-	if int(app.Chip8.pc) == app.Chip8.programSize {
+	if app.Chip8.finished() {
 		return app, tea.Quit
 	}
 
@@ -115,19 +157,72 @@ func (app *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 func (app *App) View() string {
 	view := strings.Builder{}
-	for y := 0; y < DisplayHeight; y++ {
-		for x := 0; x < DisplayWidth; x++ {
-			if app.Chip8.display.content[x][y] != 0 {
-				s := lipgloss.NewStyle().SetString("  ").Background(Colors[app.Chip8.Options.OnColor])
+	frame := app.Chip8.display.present(app.Chip8.Options.FrameBlend)
+	width := app.Chip8.display.width()
+	for y := 0; y < app.Chip8.display.height(); y++ {
+		for x := 0; x < width; x++ {
+			switch intensity := frame[y*width+x]; intensity {
+			case 0xFF:
+				s := lipgloss.NewStyle().SetString("  ").Background(app.Chip8.display.palette[1])
+				view.WriteString(s.String())
+			case 0:
+				s := lipgloss.NewStyle().SetString("  ").Background(app.Chip8.display.palette[0])
 				view.WriteString(s.String())
-			} else {
-				s := lipgloss.NewStyle().SetString("  ").Background(Colors[app.Chip8.Options.OffColor])
+			default:
+				// Partially lit from frame blending
+				c := blendColors(app.Chip8.display.palette[0], app.Chip8.display.palette[1], intensity)
+				s := lipgloss.NewStyle().SetString("  ").Background(lipgloss.Color(fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)))
 				view.WriteString(s.String())
 			}
 		}
 		view.WriteRune('\n')
 	}
-	return view.String()
+	view.WriteString(app.Chip8.notification())
+	if lines := app.Chip8.leaderboardLines(); len(lines) > 0 {
+		view.WriteString("\n" + strings.Join(lines, "\n"))
+	}
+	if !app.Chip8.memview.open {
+		return view.String()
+	}
+
+	// Beside the display if there's room, otherwise below it
+	memory := app.Chip8.memoryViewText()
+	if app.terminalWidth >= width*2+2+lipgloss.Width(memory) {
+		return lipgloss.JoinHorizontal(lipgloss.Top, view.String(), "  ", memory)
+	}
+	return view.String() + "\n" + memory
+}
+
+// paint draws the display as an inline image, at most once per 60Hz frame and
+// only when the display has changed. Blended frames keep changing as old frames
+// fade out, so those are always repainted.
+func (app *App) paint() {
+	blend := app.Chip8.Options.FrameBlend
+	memory := app.Chip8.memview.open
+	if (!app.Chip8.display.dirty && !blend.enabled() && !memory && !app.memoryWasOpen) || time.Since(app.lastPaint) < decrementInterval {
+		return
+	}
+	app.lastPaint = time.Now()
+	app.Chip8.display.dirty = false
+
+	// Always draw from the top left corner
+	app.out.WriteString("\x1b[H")
+	if memory != app.memoryWasOpen {
+		app.out.WriteString("\x1b[2J")
+		app.memoryWasOpen = memory
+	}
+	if memory {
+		// The memory viewer goes above the image, since where the image ends in
+		// text rows isn't known
+		for _, line := range strings.Split(app.Chip8.memoryViewText(), "\n") {
+			app.out.WriteString(line + "\x1b[K\r\n")
+		}
+	}
+	img := app.Chip8.display.image(app.Chip8.Options.DisplayScaleFactor, blend)
+	if err := writeImage(app.out, app.graphics, img); err != nil {
+		app.Chip8.Logger.Warn("Failed to draw frame", "graphics", app.graphics, "err", err)
+	}
+	app.out.Flush()
 }
 
 // Convert keypad key to hex value
@@ -0,0 +1,400 @@
+package interpreter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// What a watchpoint watches
+type watchKind int
+
+const (
+	// Instructions reading or writing a range of memory
+	watchRead watchKind = iota
+	watchWrite
+	watchAccess
+	// Instructions changing a register
+	watchRegister
+	// A condition becoming true
+	watchCondition
+)
+
+// Watchpoint stops the interpreter when the program touches some memory or a
+// register, or when a condition becomes true. Parse them with ParseWatchpoint.
+type Watchpoint struct {
+	// As written, for messages
+	Spec string
+
+	kind       watchKind
+	start, end uint16
+	register   string
+	// Only trigger when this is true, if set
+	condition expression
+	// Whether a condition was true after the last instruction, so it only
+	// triggers as it becomes true
+	wasTrue bool
+}
+
+// ParseWatchpoint parses a watchpoint, which is one of:
+//
+//	read|write|access ADDR[-ADDR] [if CONDITION]   memory accessed by FX33, FX55, FX65 or DXYN
+//	V0-VF|I|DT|ST [if CONDITION]                   a register changed by an instruction
+//	CONDITION                                      a condition becoming true
+//
+// Conditions compare registers (V0-VF, I, DT, ST, PC, SP), memory ([ADDR]) and
+// numbers, like "V3 == 0x10 && [0x300] > 2".
+func ParseWatchpoint(spec string) (*Watchpoint, error) {
+	w := &Watchpoint{Spec: spec}
+	target, condition, hasCondition := strings.Cut(spec, " if ")
+	if hasCondition {
+		var err error
+		if w.condition, err = parseExpression(condition); err != nil {
+			return nil, fmt.Errorf("watchpoint %q: %w", spec, err)
+		}
+	}
+
+	fields := strings.Fields(target)
+	switch {
+	case len(fields) == 2 && (fields[0] == "read" || fields[0] == "write" || fields[0] == "access"):
+		w.kind = map[string]watchKind{"read": watchRead, "write": watchWrite, "access": watchAccess}[fields[0]]
+		from, to, isRange := strings.Cut(fields[1], "-")
+		start, err := strconv.ParseUint(from, 0, 16)
+		end := start
+		if err == nil && isRange {
+			end, err = strconv.ParseUint(to, 0, 16)
+		}
+		if err != nil || start > end || end >= memorySize {
+			return nil, fmt.Errorf("watchpoint %q: invalid address range %q", spec, fields[1])
+		}
+		w.start, w.end = uint16(start), uint16(end)
+
+	case len(fields) == 1 && isWatchableRegister(strings.ToUpper(fields[0])):
+		w.kind = watchRegister
+		w.register = strings.ToUpper(fields[0])
+
+	case hasCondition:
+		return nil, fmt.Errorf("watchpoint %q: can't watch %q, use read, write or access with an address, or a register", spec, target)
+
+	default:
+		w.kind = watchCondition
+		var err error
+		if w.condition, err = parseExpression(spec); err != nil {
+			return nil, fmt.Errorf("watchpoint %q: %w", spec, err)
+		}
+	}
+	return w, nil
+}
+
+func isWatchableRegister(name string) bool {
+	if len(name) == 2 && name[0] == 'V' {
+		_, err := strconv.ParseUint(name[1:], 16, 4)
+		return err == nil
+	}
+	return name == "I" || name == "DT" || name == "ST"
+}
+
+// WatchHit describes a watchpoint triggering.
+type WatchHit struct {
+	Watchpoint *Watchpoint
+	// The instruction that triggered it
+	PC          uint16
+	Instruction Instruction
+	// What it accessed or changed, from and to
+	Detail string
+}
+
+func (hit WatchHit) String() string {
+	message := fmt.Sprintf("Watch %q hit at %04X (%s)", hit.Watchpoint.Spec, hit.PC, hit.Instruction.Mnemonic())
+	if hit.Detail != "" {
+		message += ": " + hit.Detail
+	}
+	return message
+}
+
+// registerState is the registers a watchpoint can watch, before an instruction
+type registerState struct {
+	V      [16]byte
+	I      uint16
+	DT, ST byte
+}
+
+func (r registerState) get(name string) uint16 {
+	switch name {
+	case "I":
+		return r.I
+	case "DT":
+		return uint16(r.DT)
+	case "ST":
+		return uint16(r.ST)
+	}
+	index, _ := strconv.ParseUint(name[1:], 16, 4)
+	return uint16(r.V[index])
+}
+
+func (ch8 *CHIP8) registerState() registerState {
+	return registerState{V: ch8.V, I: ch8.I, DT: ch8.delayTimer, ST: ch8.soundTimer}
+}
+
+// watchMemory checks an instruction's access to length bytes at addr against
+// the watchpoints.
+func (ch8 *CHIP8) watchMemory(addr uint16, length uint16, write bool) {
+	if length == 0 {
+		return
+	}
+	for _, w := range ch8.Watchpoints {
+		if w.kind > watchAccess || (w.kind == watchRead && write) || (w.kind == watchWrite && !write) {
+			continue
+		}
+		if addr > w.end || addr+length-1 < w.start {
+			continue
+		}
+		if w.condition != nil && w.condition(ch8) == 0 {
+			continue
+		}
+		access := "read"
+		if write {
+			access = "write"
+		}
+		ch8.watchHit(w, fmt.Sprintf("%s %d bytes at %04X", access, length, addr))
+	}
+}
+
+// watchInstruction checks register and condition watchpoints after an
+// instruction has run.
+func (ch8 *CHIP8) watchInstruction(before registerState) {
+	after := ch8.registerState()
+	for _, w := range ch8.Watchpoints {
+		switch w.kind {
+		case watchRegister:
+			from, to := before.get(w.register), after.get(w.register)
+			if from != to && (w.condition == nil || w.condition(ch8) != 0) {
+				ch8.watchHit(w, fmt.Sprintf("%s %X -> %X", w.register, from, to))
+			}
+		case watchCondition:
+			isTrue := w.condition(ch8) != 0
+			if isTrue && !w.wasTrue {
+				ch8.watchHit(w, "")
+			}
+			w.wasTrue = isTrue
+		}
+	}
+}
+
+// watchHit reports a watchpoint triggering: to an attached debugger, OnWatch, or
+// by pausing.
+func (ch8 *CHIP8) watchHit(w *Watchpoint, detail string) {
+	hit := WatchHit{Watchpoint: w, PC: ch8.lastPC, Instruction: ch8.lastInstruction, Detail: detail}
+	if ch8.debug != nil && ch8.debug.attached {
+		// Let the debugger know once the instruction is done
+		ch8.debug.watchHit = &hit
+		return
+	}
+	if ch8.OnWatch != nil {
+		ch8.OnWatch(hit)
+		return
+	}
+	ch8.notify("%s", hit)
+	ch8.control.paused = true
+	ch8.control.watchBreak = true
+}
+
+// An expression compiled to a function of the machine state
+type expression func(ch8 *CHIP8) int
+
+// parseExpression compiles a condition. Comparisons and logic give 1 or 0, like C.
+func parseExpression(source string) (expression, error) {
+	p := &expressionParser{}
+	if err := p.tokenize(source); err != nil {
+		return nil, err
+	}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("empty condition")
+	}
+	expr, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in condition", p.tokens[p.pos])
+	}
+	return expr, nil
+}
+
+type expressionParser struct {
+	tokens []string
+	pos    int
+}
+
+// Longest first, so "<=" isn't read as "<"
+var expressionOperators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "+", "-", "*", "&", "|", "^", "!", "(", ")", "[", "]"}
+
+func (p *expressionParser) tokenize(source string) error {
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+			continue
+		case isAlphanumeric(c):
+			start := i
+			for i < len(source) && isAlphanumeric(source[i]) {
+				i++
+			}
+			p.tokens = append(p.tokens, source[start:i])
+			continue
+		}
+		matched := false
+		for _, op := range expressionOperators {
+			if strings.HasPrefix(source[i:], op) {
+				p.tokens = append(p.tokens, op)
+				i += len(op)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("unexpected %q in condition", c)
+		}
+	}
+	return nil
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func (p *expressionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *expressionParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+// binary parses operands separated by any of the operators, left to right.
+func (p *expressionParser) binary(operand func() (expression, error), operators map[string]func(a, b int) int) (expression, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		apply, ok := operators[p.peek()]
+		if !ok {
+			return left, nil
+		}
+		p.next()
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(ch8 *CHIP8) int { return apply(l(ch8), right(ch8)) }
+	}
+}
+
+func truth(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (p *expressionParser) or() (expression, error) {
+	return p.binary(p.and, map[string]func(a, b int) int{
+		"||": func(a, b int) int { return truth(a != 0 || b != 0) },
+	})
+}
+
+func (p *expressionParser) and() (expression, error) {
+	return p.binary(p.comparison, map[string]func(a, b int) int{
+		"&&": func(a, b int) int { return truth(a != 0 && b != 0) },
+	})
+}
+
+func (p *expressionParser) comparison() (expression, error) {
+	return p.binary(p.arithmetic, map[string]func(a, b int) int{
+		"==": func(a, b int) int { return truth(a == b) },
+		"!=": func(a, b int) int { return truth(a != b) },
+		"<":  func(a, b int) int { return truth(a < b) },
+		"<=": func(a, b int) int { return truth(a <= b) },
+		">":  func(a, b int) int { return truth(a > b) },
+		">=": func(a, b int) int { return truth(a >= b) },
+	})
+}
+
+func (p *expressionParser) arithmetic() (expression, error) {
+	return p.binary(p.product, map[string]func(a, b int) int{
+		"+": func(a, b int) int { return a + b },
+		"-": func(a, b int) int { return a - b },
+		"&": func(a, b int) int { return a & b },
+		"|": func(a, b int) int { return a | b },
+		"^": func(a, b int) int { return a ^ b },
+	})
+}
+
+func (p *expressionParser) product() (expression, error) {
+	return p.binary(p.unary, map[string]func(a, b int) int{
+		"*": func(a, b int) int { return a * b },
+	})
+}
+
+func (p *expressionParser) unary() (expression, error) {
+	switch p.peek() {
+	case "!":
+		p.next()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(ch8 *CHIP8) int { return truth(operand(ch8) == 0) }, nil
+	case "-":
+		p.next()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(ch8 *CHIP8) int { return -operand(ch8) }, nil
+	}
+	return p.primary()
+}
+
+func (p *expressionParser) primary() (expression, error) {
+	token := p.next()
+	switch token {
+	case "":
+		return nil, fmt.Errorf("condition ends early")
+	case "(", "[":
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		closing := map[string]string{"(": ")", "[": "]"}[token]
+		if p.next() != closing {
+			return nil, fmt.Errorf("missing %q in condition", closing)
+		}
+		if token == "(" {
+			return inner, nil
+		}
+		// Memory, wrapping at the end like the interpreter's addresses
+		return func(ch8 *CHIP8) int { return int(ch8.memory[uint16(inner(ch8))%memorySize]) }, nil
+	}
+
+	if value, err := strconv.ParseInt(token, 0, 32); err == nil {
+		return func(*CHIP8) int { return int(value) }, nil
+	}
+	switch name := strings.ToUpper(token); {
+	case name == "PC":
+		return func(ch8 *CHIP8) int { return int(ch8.pc) }, nil
+	case name == "SP":
+		return func(ch8 *CHIP8) int { return len(ch8.stack) }, nil
+	case isWatchableRegister(name):
+		return func(ch8 *CHIP8) int { return int(ch8.registerState().get(name)) }, nil
+	}
+	return nil, fmt.Errorf("unknown %q in condition", token)
+}
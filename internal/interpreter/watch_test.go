@@ -0,0 +1,76 @@
+package interpreter
+
+import "testing"
+
+func TestParseExpression(t *testing.T) {
+	chip8 := &CHIP8{pc: 0x202, I: 0x300, V: [16]byte{3: 0x10, 0xF: 1}}
+	chip8.memory[0x300] = 7
+
+	tests := map[string]int{
+		"V3 == 0x10":                 1,
+		"v3 != 16":                   0,
+		"[I] + 1 == 8 && VF":         1,
+		"[0x300] > 7 || !(PC < 512)": 1,
+		"-V3 + 0x20 == 0x10":         1,
+		"V3 & 0x30 == 0x10":          1,
+		"[I] * 10 + VF":              71,
+	}
+	for source, expected := range tests {
+		expr, err := parseExpression(source)
+		if err != nil {
+			t.Errorf("%q: Unexpected error: %v", source, err)
+			continue
+		}
+		if got := expr(chip8); got != expected {
+			t.Errorf("%q: Expected %d, got %d", source, expected, got)
+		}
+	}
+
+	for _, source := range []string{"", "V3 ==", "(V3", "VG == 1", "V3 = 1"} {
+		if _, err := parseExpression(source); err == nil {
+			t.Errorf("%q: Expected error", source)
+		}
+	}
+}
+
+func TestWatchpoints(t *testing.T) {
+	var hits []string
+	chip8 := &CHIP8{OnWatch: func(hit WatchHit) { hits = append(hits, hit.Watchpoint.Spec) }}
+	for _, spec := range []string{"write 0x300-0x302", "read 0x400 if V0 == 1", "V3", "V3 == 0x10"} {
+		w, err := ParseWatchpoint(spec)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		chip8.Watchpoints = append(chip8.Watchpoints, w)
+	}
+
+	chip8.watchMemory(0x2FE, 3, true)
+	chip8.watchMemory(0x300, 3, false)
+	chip8.watchMemory(0x400, 1, false)
+	chip8.V[0] = 1
+	chip8.watchMemory(0x3FF, 2, false)
+
+	// Only the first change to 0x10 counts for the condition
+	before := chip8.registerState()
+	chip8.V[3] = 0x10
+	chip8.watchInstruction(before)
+	before = chip8.registerState()
+	chip8.V[3] = 0x10
+	chip8.watchInstruction(before)
+
+	expected := []string{"write 0x300-0x302", "read 0x400 if V0 == 1", "V3", "V3 == 0x10"}
+	if len(hits) != len(expected) {
+		t.Fatalf("Expected hits %v, got %v", expected, hits)
+	}
+	for i := range hits {
+		if hits[i] != expected[i] {
+			t.Errorf("Expected hits %v, got %v", expected, hits)
+		}
+	}
+
+	for _, spec := range []string{"write 0x2000", "read 0x300-0x200", "PC if V0 == 1"} {
+		if _, err := ParseWatchpoint(spec); err == nil {
+			t.Errorf("%q: Expected error", spec)
+		}
+	}
+}
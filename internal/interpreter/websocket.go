@@ -0,0 +1,210 @@
+package interpreter
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// From RFC 6455, mixed into the handshake to prove the server speaks WebSocket
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// The largest message a viewer may send. Key presses are tiny.
+const maxWebSocketMessage = 64 << 10
+
+// The largest payload RFC 6455 allows in a ping, pong or close
+const maxControlPayload = 125
+
+// WebSocket opcodes
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// wsConn is the server end of a WebSocket, with just enough of RFC 6455 for the
+// remote viewer: whole text messages each way, pings and closing.
+type wsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	// Replies to pings and closes come from the reading goroutine
+	writeMu sync.Mutex
+}
+
+// upgradeWebSocket takes over an HTTP request asking for a WebSocket.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if !headerHas(r.Header, "Connection", "upgrade") || !headerHas(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "Expected a WebSocket", http.StatusBadRequest)
+		return nil, errors.New("not a WebSocket request")
+	}
+	// Browsers let any page open a WebSocket to localhost, so only pages served
+	// from here may take the controller seat. Clients that aren't browsers don't
+	// send an Origin.
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || !strings.EqualFold(u.Host, r.Host) {
+			http.Error(w, "Cross origin WebSockets aren't allowed", http.StatusForbidden)
+			return nil, fmt.Errorf("WebSocket from another origin: %s", origin)
+		}
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported WebSocket version")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Can't upgrade this connection", http.StatusInternalServerError)
+		return nil, errors.New("connection can't be hijacked")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, reader: rw.Reader}, nil
+}
+
+// headerHas reports whether a comma separated header lists a token.
+func headerHas(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage waits for the next text or binary message, answering pings along
+// the way. It returns io.EOF once the other end closes.
+func (c *wsConn) ReadMessage() ([]byte, error) {
+	var message []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.writeFrame(wsClose, nil)
+			return nil, io.EOF
+		case wsText, wsBinary, wsContinuation:
+			message = append(message, payload...)
+			if len(message) > maxWebSocketMessage {
+				return nil, errors.New("WebSocket message too large")
+			}
+			if fin {
+				return message, nil
+			}
+		default:
+			return nil, fmt.Errorf("unknown WebSocket opcode %d", opcode)
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, opcode = header[0]&0x80 != 0, header[0]&0x0F
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, errors.New("WebSocket clients must mask their frames")
+	}
+
+	length := uint64(header[1] & 0x7F)
+	// Control frames can't be split up, and are short enough for one length byte
+	if opcode&0x8 != 0 && (!fin || length > maxControlPayload) {
+		return false, 0, nil, errors.New("WebSocket control frames must be whole and short")
+	}
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if length > maxWebSocketMessage {
+		return false, 0, nil, errors.New("WebSocket message too large")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage sends a text message.
+func (c *wsConn) WriteMessage(data []byte) error {
+	return c.writeFrame(wsText, data)
+}
+
+// writeFrame sends a whole message in one frame. Servers don't mask.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	header := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		header = append(header, byte(length))
+	case length <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Close hangs up without the closing handshake.
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,83 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+type WindowOptions struct {
+	// Let the window be resized by the user
+	Resizable bool `mapstructure:"resizable"`
+	// Only scale the display by whole numbers, so every pixel is the same size
+	IntegerScaling bool `mapstructure:"integer_scaling"`
+	// Start in fullscreen. Toggle with F11 or Alt+Enter.
+	Fullscreen bool `mapstructure:"fullscreen"`
+	// Color of the bars around the display when it doesn't fill the window
+	BorderColor string `mapstructure:"border_color"`
+	// Minimum space between the display and the window edges, in pixels
+	Padding int `mapstructure:"padding"`
+	// Save the window's geometry on exit, to restore it next time
+	Remember bool `mapstructure:"remember"`
+	// The window geometry. A zero size picks one from the display scale factor.
+	Width  int `mapstructure:"width"`
+	Height int `mapstructure:"height"`
+	X      int `mapstructure:"x"`
+	Y      int `mapstructure:"y"`
+}
+
+func DefaultWindowOptions() WindowOptions {
+	return WindowOptions{
+		Resizable:   true,
+		BorderColor: "#000000",
+		Remember:    true,
+	}
+}
+
+// Validate checks the border color and padding.
+func (opts WindowOptions) Validate() error {
+	if _, err := ParseColor(opts.BorderColor); err != nil {
+		return fmt.Errorf("border_color: %w", err)
+	}
+	if opts.Padding < 0 {
+		return fmt.Errorf("padding must not be negative, got %d", opts.Padding)
+	}
+	return nil
+}
+
+// fit scales a width x height display to fill as much of the screen as possible
+// without changing its aspect ratio, centering it. Returns the scale and the
+// position of the display's top left corner.
+func (opts WindowOptions) fit(screenWidth, screenHeight, width, height int) (scale, x, y float64) {
+	availableWidth := float64(screenWidth - 2*opts.Padding)
+	availableHeight := float64(screenHeight - 2*opts.Padding)
+	scale = math.Min(availableWidth/float64(width), availableHeight/float64(height))
+	if opts.IntegerScaling {
+		scale = math.Floor(scale)
+	}
+	// Always show something, even in a tiny window
+	scale = math.Max(scale, 1)
+
+	x = math.Floor((float64(screenWidth) - float64(width)*scale) / 2)
+	y = math.Floor((float64(screenHeight) - float64(height)*scale) / 2)
+	return scale, x, y
+}
+
+// updateWindow handles the fullscreen hotkeys and remembers the window geometry.
+func (chip8 *CHIP8) updateWindow() {
+	altEnter := ebiten.IsKeyPressed(ebiten.KeyAlt) && inpututil.IsKeyJustPressed(ebiten.KeyEnter)
+	if inpututil.IsKeyJustPressed(ebiten.KeyF11) || altEnter {
+		ebiten.SetFullscreen(!ebiten.IsFullscreen())
+		chip8.notify("Fullscreen %s", onOff(!chip8.Options.Window.Fullscreen))
+	}
+
+	window := &chip8.Options.Window
+	window.Fullscreen = ebiten.IsFullscreen()
+	if !window.Fullscreen {
+		// Fullscreen reports the monitor's size, which isn't worth restoring
+		window.Width, window.Height = ebiten.WindowSize()
+		window.X, window.Y = ebiten.WindowPosition()
+	}
+}
@@ -0,0 +1,245 @@
+// Package gym turns CHIP-8 games into reinforcement learning environments, in
+// the style of Gym: Reset starts an episode, and Step holds keys for a few frames
+// then reports the display, the reward and whether the episode is over. Agents
+// in other languages can drive them with Serve.
+package gym
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/braheezy/chip-8/internal/interpreter"
+)
+
+// Action is the keys held during a step, one bit per keypad key: bit 0 for key 0
+// up to bit 15 for key F. 0 holds nothing.
+type Action = interpreter.Action
+
+// Options set how an Env plays and rewards a program.
+type Options struct {
+	// Frames each step holds its keys for, since agents rarely need to act every
+	// frame
+	FrameSkip int
+	// Rates how well the program is doing, reading registers and memory like a
+	// watchpoint condition, such as "[0x2F0]*10 + [0x2F1]" for BCD digits. The
+	// reward for a step is how much the score went up, so there's no reward
+	// without one.
+	Score string
+	// Ends the episode early when true, like "[0x2F2] == 0" when the last life is
+	// lost. Episodes also end when the program does.
+	Done string
+	// Cut episodes short after this many steps, unless 0
+	MaxSteps int
+}
+
+// Env is an environment playing one copy of a program. Every frame runs
+// unthrottled, so episodes go as fast as the interpreter can.
+type Env struct {
+	chip8     *interpreter.CHIP8
+	frameSkip int
+	maxSteps  int
+	score     interpreter.ScoreFunc
+	done      interpreter.DoneFunc
+	// The score after the last step, since the reward is how much it went up
+	last  float64
+	steps int
+	over  bool
+}
+
+// New makes an environment playing a program with the interpreter's default
+// settings.
+func New(program []byte, options Options) (*Env, error) {
+	return NewEnv(interpreter.NewCHIP8(&program, interpreter.DefaultCHIP8Options()), options)
+}
+
+// NewEnv makes an environment from an interpreter that's already set up, like
+// with settings from config.
+func NewEnv(chip8 *interpreter.CHIP8, options Options) (*Env, error) {
+	e := &Env{chip8: chip8, frameSkip: max(options.FrameSkip, 1), maxSteps: options.MaxSteps}
+	var err error
+	if options.Score != "" {
+		if e.score, err = interpreter.ParseScore(options.Score); err != nil {
+			return nil, err
+		}
+	}
+	if options.Done != "" {
+		if e.done, err = interpreter.ParseDone(options.Done); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// Observation is the display, one byte per pixel row by row, 1 for lit pixels.
+type Observation struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Pixels []byte `json:"pixels"`
+}
+
+// StepResult is what an agent learns from a step.
+type StepResult struct {
+	Observation Observation `json:"observation"`
+	Reward      float64     `json:"reward"`
+	Done        bool        `json:"done"`
+}
+
+// Reset starts a new episode from power on. CXNN is seeded with seed, so
+// episodes given the same seed and actions play out the same way.
+func (e *Env) Reset(seed int64) Observation {
+	e.chip8.Reset()
+	e.chip8.Seed(seed)
+	e.steps, e.over = 0, false
+	e.last = e.currentScore()
+	return e.observe()
+}
+
+// Step holds the action's keys for FrameSkip frames.
+func (e *Env) Step(action Action) (obs Observation, reward float64, done bool) {
+	if e.over {
+		return e.observe(), 0, true
+	}
+	for frame := 0; frame < e.frameSkip && !e.finished(); frame++ {
+		e.chip8.HoldKeys(action)
+		e.chip8.RunFrame()
+	}
+	e.steps++
+
+	score := e.currentScore()
+	reward, e.last = score-e.last, score
+	e.over = e.finished() || e.maxSteps > 0 && e.steps >= e.maxSteps
+	return e.observe(), reward, e.over
+}
+
+// finished reports whether the program has finished, or the game is over.
+func (e *Env) finished() bool {
+	return e.chip8.Finished() || e.done != nil && e.done(e.chip8)
+}
+
+func (e *Env) currentScore() float64 {
+	if e.score == nil {
+		return 0
+	}
+	return e.score(e.chip8)
+}
+
+func (e *Env) observe() Observation {
+	var obs Observation
+	obs.Width, obs.Height, obs.Pixels = e.chip8.Pixels()
+	return obs
+}
+
+// StepAll steps each environment with its action, for agents learning from
+// several games at once. They're stepped one after another, because the
+// interpreter's timers share state.
+func StepAll(envs []*Env, actions []Action) []StepResult {
+	results := make([]StepResult, len(envs))
+	for i, env := range envs {
+		results[i].Observation, results[i].Reward, results[i].Done = env.Step(actions[i])
+	}
+	return results
+}
+
+// request is a message from an agent. Ops are info, reset, step and close.
+// Reset and step act on one environment, picked with env, or on all of them at
+// once when given seeds or actions for each.
+type request struct {
+	Op      string   `json:"op"`
+	Env     int      `json:"env"`
+	Seed    int64    `json:"seed"`
+	Seeds   []int64  `json:"seeds"`
+	Action  Action   `json:"action"`
+	Actions []Action `json:"actions"`
+}
+
+// Info describes the environments being served.
+type Info struct {
+	Envs      int `json:"envs"`
+	Width     int `json:"width"`
+	Height    int `json:"height"`
+	Keys      int `json:"keys"`
+	FrameSkip int `json:"frame_skip"`
+}
+
+type response struct {
+	*Info
+	*StepResult
+	Results []StepResult `json:"results,omitempty"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// Serve lets an agent in another language drive the environments, with a JSON
+// object per line each way, until the agent closes them or disconnects.
+// Observation pixels are base64 encoded.
+//
+//	{"op": "info"}                  {"envs": 1, "width": 64, "height": 32, "keys": 16, "frame_skip": 4}
+//	{"op": "reset", "seed": 7}      {"observation": {...}, "reward": 0, "done": false}
+//	{"op": "step", "action": 2}     {"observation": {...}, "reward": 1, "done": false}
+//	{"op": "step", "actions": [2, 0]}  {"results": [{...}, {...}]}
+//	{"op": "close"}                 {}
+func Serve(conn io.ReadWriter, envs []*Env) error {
+	encoder := json.NewEncoder(conn)
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var req request
+		var resp response
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp = handle(envs, req)
+		}
+		if err := encoder.Encode(resp); err != nil {
+			return err
+		}
+		if req.Op == "close" {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+func handle(envs []*Env, req request) response {
+	if req.Env < 0 || req.Env >= len(envs) {
+		return response{Error: fmt.Sprintf("no env %d, there are %d", req.Env, len(envs))}
+	}
+	env := envs[req.Env]
+
+	switch req.Op {
+	case "info":
+		obs := env.observe()
+		return response{Info: &Info{
+			Envs:      len(envs),
+			Width:     obs.Width,
+			Height:    obs.Height,
+			Keys:      16,
+			FrameSkip: env.frameSkip,
+		}}
+	case "reset":
+		if req.Seeds == nil {
+			return response{StepResult: &StepResult{Observation: env.Reset(req.Seed)}}
+		}
+		if len(req.Seeds) != len(envs) {
+			return response{Error: fmt.Sprintf("got %d seeds for %d envs", len(req.Seeds), len(envs))}
+		}
+		results := make([]StepResult, len(envs))
+		for i, env := range envs {
+			results[i].Observation = env.Reset(req.Seeds[i])
+		}
+		return response{Results: results}
+	case "step":
+		if req.Actions == nil {
+			result := &StepResult{}
+			result.Observation, result.Reward, result.Done = env.Step(req.Action)
+			return response{StepResult: result}
+		}
+		if len(req.Actions) != len(envs) {
+			return response{Error: fmt.Sprintf("got %d actions for %d envs", len(req.Actions), len(envs))}
+		}
+		return response{Results: StepAll(envs, req.Actions)}
+	case "close":
+		return response{}
+	}
+	return response{Error: fmt.Sprintf("unknown op %q", req.Op)}
+}
@@ -0,0 +1,133 @@
+package gym
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/braheezy/chip-8/internal/interpreter"
+)
+
+// A game scoring a point whenever key 5 is held, taking two frames a round
+var pointsProgram = []byte{
+	0xA3, 0x00, // 200: LD I, 0x300
+	0x60, 0x05, // 202: LD V0, 5
+	0xE0, 0xA1, // 204: SKNP V0
+	0x71, 0x01, // 206: ADD V1, 1
+	0xC2, 0xFF, // 208: RND V2, 0xFF
+	0xF2, 0x55, // 20A: LD [I], V2
+	0x12, 0x00, // 20C: JP 0x200
+}
+
+func newPointsEnv(t *testing.T) *Env {
+	env, err := New(pointsProgram, Options{FrameSkip: 2, Score: "[0x301]", Done: "[0x301] == 2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+// random is the last random number the game stored.
+func random(env *Env) byte {
+	return env.chip8.SaveState().Memory[0x302]
+}
+
+func TestEnv(t *testing.T) {
+	env := newPointsEnv(t)
+	obs := env.Reset(7)
+	if obs.Width != interpreter.DisplayWidth || obs.Height != interpreter.DisplayHeight || len(obs.Pixels) != interpreter.DisplayWidth*interpreter.DisplayHeight {
+		t.Fatalf("Expected a %dx%d observation, got %dx%d with %d pixels", interpreter.DisplayWidth, interpreter.DisplayHeight, obs.Width, obs.Height, len(obs.Pixels))
+	}
+
+	const five = Action(1 << 5)
+	var rewards []float64
+	var randoms []byte
+	for _, action := range []Action{five, 0, five} {
+		_, reward, done := env.Step(action)
+		rewards = append(rewards, reward)
+		randoms = append(randoms, random(env))
+		if done != (len(rewards) == 3) {
+			t.Fatalf("Step %d: expected done only once two points are scored", len(rewards))
+		}
+	}
+	if want := []float64{1, 0, 1}; !slices.Equal(rewards, want) {
+		t.Errorf("Expected rewards %v, got %v", want, rewards)
+	}
+	if _, reward, done := env.Step(five); reward != 0 || !done {
+		t.Error("Expected steps after the episode to do nothing")
+	}
+
+	// The same seed plays out the same
+	env.Reset(7)
+	for i, action := range []Action{five, 0, five} {
+		env.Step(action)
+		if random(env) != randoms[i] {
+			t.Fatalf("Step %d: expected the same random numbers after reseeding", i)
+		}
+	}
+}
+
+func TestServe(t *testing.T) {
+	envs := []*Env{newPointsEnv(t), newPointsEnv(t)}
+	requests := strings.Join([]string{
+		`{"op": "info"}`,
+		`{"op": "reset", "seeds": [1, 2]}`,
+		`{"op": "step", "env": 1, "action": 32}`,
+		`{"op": "step", "actions": [32, 0]}`,
+		`{"op": "step", "env": 2}`,
+		`{"op": "jump"}`,
+		`{"op": "close"}`,
+		`{"op": "info"}`,
+	}, "\n")
+	var out bytes.Buffer
+	if err := Serve(struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader(requests), &out}, envs); err != nil {
+		t.Fatal(err)
+	}
+
+	var responses []map[string]any
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var response map[string]any
+		if err := decoder.Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, response)
+	}
+	if len(responses) != 7 {
+		t.Fatalf("Expected 7 responses, stopping at close, got %d", len(responses))
+	}
+	if responses[0]["envs"] != 2.0 || responses[0]["width"] != 64.0 || responses[0]["frame_skip"] != 2.0 {
+		t.Errorf("Unexpected info: %v", responses[0])
+	}
+	if results := responses[1]["results"].([]any); len(results) != 2 {
+		t.Errorf("Expected a reset result for each env, got %v", results)
+	}
+	if responses[2]["reward"] != 1.0 || responses[2]["done"] != false {
+		t.Errorf("Expected a point for env 1, got reward %v done %v", responses[2]["reward"], responses[2]["done"])
+	}
+	results := responses[3]["results"].([]any)
+	if results[0].(map[string]any)["reward"] != 1.0 || results[1].(map[string]any)["done"] != false {
+		t.Errorf("Unexpected batch step results: %v", results)
+	}
+	for _, i := range []int{4, 5} {
+		if responses[i]["error"] == nil {
+			t.Errorf("Expected an error for request %d, got %v", i, responses[i])
+		}
+	}
+	obs := responses[2]["observation"].(map[string]any)
+	if pixels, ok := obs["pixels"].(string); !ok || len(pixels) == 0 {
+		t.Errorf("Expected base64 pixels, got %v", obs["pixels"])
+	}
+}
+
+func TestNewBadExpression(t *testing.T) {
+	if _, err := New(pointsProgram, Options{Score: "[0x301"}); err == nil {
+		t.Error("Expected a bad score to be rejected")
+	}
+}